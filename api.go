@@ -2,12 +2,14 @@ package fishfish
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"net/url"
+	"sync"
 )
 
 const apiRoot = "https://api.fishfish.gg/v1"
@@ -20,9 +22,16 @@ const (
 	CategoryMalware  = "malware"
 )
 
+// Returned when the requested domain, url or user doesn't exist
+var ErrNotFound = errors.New("resource not found")
+
+// All categories known to the API
+var Categories = []Category{CategorySafe, CategoryPhishing, CategoryMalware}
+
 type RawClient struct {
 	primaryToken string
 	sessionToken SessionToken
+	tokenMx      sync.RWMutex
 	permissions  []APIPermission
 	apiUrl       string
 	httpClient   *http.Client
@@ -31,10 +40,15 @@ type RawClient struct {
 }
 
 func NewRaw(primaryToken string, permissions []APIPermission) (*RawClient, error) {
+	return NewRawWithAPIURL(apiRoot, primaryToken, permissions)
+}
+
+// Create a client for an API other than the official one, e.g. a proxy or a test server
+func NewRawWithAPIURL(apiURL, primaryToken string, permissions []APIPermission) (*RawClient, error) {
 	client := RawClient{
 		primaryToken: primaryToken,
 		permissions:  permissions,
-		apiUrl:       apiRoot,
+		apiUrl:       apiURL,
 		httpClient:   &http.Client{},
 	}
 
@@ -55,7 +69,17 @@ func NewRaw(primaryToken string, permissions []APIPermission) (*RawClient, error
 	return &client, nil
 }
 
+// Escape a domain or url so it is sent as a single path segment, e.g. /urls/https:%2F%2Fsites.example%2Fscam%3Fa=1
+// Joining the raw value would collapse its slashes and turn its query into part of the request's query.
+func escapePathSegment(name string) string {
+	return url.PathEscape(name)
+}
+
 func (c *RawClient) makeRequest(method, path string, query url.Values, body *bytes.Buffer, authType authType) (*http.Response, error) {
+	return c.makeRequestContext(context.Background(), method, path, query, body, authType)
+}
+
+func (c *RawClient) makeRequestContext(ctx context.Context, method, path string, query url.Values, body *bytes.Buffer, authType authType) (*http.Response, error) {
 
 	// Join base and request path
 	requestURL, err := url.JoinPath(c.apiUrl, path)
@@ -73,7 +97,7 @@ func (c *RawClient) makeRequest(method, path string, query url.Values, body *byt
 		body = &bytes.Buffer{}
 	}
 
-	req, err := http.NewRequest(method, fullRequestURL, body)
+	req, err := http.NewRequestWithContext(ctx, method, fullRequestURL, body)
 
 	if err != nil {
 		return nil, fmt.Errorf("unable to create http request: %s", err)
@@ -84,7 +108,7 @@ func (c *RawClient) makeRequest(method, path string, query url.Values, body *byt
 	case authTypePrimary:
 		req.Header.Set("Authorization", c.primaryToken)
 	case authTypeSession:
-		req.Header.Set("Authorization", c.sessionToken.Token)
+		req.Header.Set("Authorization", c.GetSessionToken().Token)
 	case authTypeNone:
 		// No authorization, do nothing
 	}
@@ -99,9 +123,14 @@ func (c *RawClient) makeRequest(method, path string, query url.Values, body *byt
 		return nil, fmt.Errorf("error sending http request: %s", err)
 	}
 
+	// Error responses are only inspected for their status code
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		res.Body.Close()
+	}
+
 	// Return response with error for further function-specific checks
 	if res.StatusCode == 404 {
-		return res, errors.New("resource not found")
+		return res, ErrNotFound
 	} else if res.StatusCode == 401 {
 		return res, errors.New("invalid FishFish API Token")
 	} else if res.StatusCode == 403 {
@@ -1,11 +1,15 @@
 package fishfish_test
 
 import (
+	"encoding/json"
 	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"strings"
 	"testing"
 
-	"github.com/existentiality/fishfish-go"
+	"github.com/existagon/fishfish-go"
 )
 
 var primaryKey = os.Getenv("FISHFISH_API_KEY")
@@ -48,3 +52,52 @@ func mustPanic(err error) {
 		panic(err)
 	}
 }
+
+// Serve the public endpoints of the API from the specified entries
+func newTestAPI(t *testing.T, domains []fishfish.Domain, urls []fishfish.URL) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body any
+
+		switch {
+		case r.URL.Path == "/domains":
+			names := []string{}
+			for _, d := range domains {
+				if string(d.Category) == r.URL.Query().Get("category") {
+					names = append(names, d.Domain)
+				}
+			}
+			body = names
+		case r.URL.Path == "/urls":
+			names := []string{}
+			for _, u := range urls {
+				if string(u.Category) == r.URL.Query().Get("category") {
+					names = append(names, u.URL)
+				}
+			}
+			body = names
+		case strings.HasPrefix(r.URL.Path, "/domains/"):
+			for _, d := range domains {
+				if d.Domain == strings.TrimPrefix(r.URL.Path, "/domains/") {
+					body = d
+				}
+			}
+		case strings.HasPrefix(r.URL.Path, "/urls/"):
+			for _, u := range urls {
+				if u.URL == strings.TrimPrefix(r.URL.Path, "/urls/") {
+					body = u
+				}
+			}
+		}
+
+		if body == nil {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		json.NewEncoder(w).Encode(body)
+	}))
+
+	t.Cleanup(server.Close)
+
+	return server
+}
@@ -47,7 +47,7 @@ func (c *RawClient) CreateSessionToken() (*SessionToken, error) {
 
 	if err != nil {
 		// Special 403 case for CreateSessionToken
-		if res.StatusCode == 403 {
+		if res != nil && res.StatusCode == 403 {
 			return nil, fmt.Errorf("unauthorized for specified permission(s)")
 		}
 
@@ -99,7 +99,7 @@ func (c *RawClient) CreateMainToken(userID int64, options CreateMainTokenRequest
 	}
 
 	path := fmt.Sprintf("/users/%d/tokens", userID)
-	res, err := c.makeRequest("GET", path, nil, bytes.NewBuffer(body), authTypeSession)
+	res, err := c.makeRequest("POST", path, nil, bytes.NewBuffer(body), authTypeSession)
 
 	if err != nil {
 		return nil, err
@@ -122,9 +122,19 @@ func (c *RawClient) DeleteMainToken(userID, tokenID int64) error {
 // Allow external refresh of the session token
 
 func (c *RawClient) SetSessionToken(token SessionToken) {
+	c.tokenMx.Lock()
+	defer c.tokenMx.Unlock()
+
 	c.sessionToken = token
 }
 
+func (c *RawClient) GetSessionToken() SessionToken {
+	c.tokenMx.RLock()
+	defer c.tokenMx.RUnlock()
+
+	return c.sessionToken
+}
+
 // Check if the client has the specified permission
 func (c *RawClient) HasPermission(permission APIPermission) bool {
 	for _, v := range c.permissions {
@@ -3,228 +3,721 @@ package fishfish
 import (
 	"context"
 	"fmt"
+	"math/rand"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
 type AutoSyncClient struct {
-	raw           RawClient
-	cache         domainCache
-	cacheTicker   *time.Ticker
-	sessionTicker *time.Ticker
-	context       syncContext
+	raw     *RawClient
+	cache   domainCache
+	options AutoSyncOptions
+	context syncContext
+	random  *rand.Rand
+	status  *syncStatus
+	// Built from the cache when first needed after it changes
+	heuristics heuristicsIndex
+	overrides  atomic.Pointer[Overrides]
+	// Replaced by SetJournal while the stream is running
+	journal atomic.Pointer[Journal]
+	feeds   feedCaches
 }
 
 type domainCache struct {
 	mx          sync.RWMutex
 	domainIndex map[string]Domain
 	urlIndex    map[string]URL
+	suffixIndex *suffixIndex
+	// Names of listed URLs by their canonical host and path, several URLs can share one, e.g. http and https
+	urlExpressionIndex map[string]map[string]bool
+	// Phishing and malware domains in filter storage mode, the other indexes are left empty
+	filter *CountingBloomFilter
+	// How often events added each name since the filter was built, only these can be removed without
+	// decrementing counters of other names
+	filterAdded map[string]int
+	// Incremented on every change, so derived indexes know when to rebuild
+	generation uint64
+	// Incremented when safe domains or targets change, so the heuristics know when to rebuild
+	protectedGeneration uint64
 }
 
+// Configuration for an AutoSync client, zero values use the defaults
+type AutoSyncOptions struct {
+	// How often the whole cache is refetched, defaults to one hour
+	SyncInterval time.Duration
+	// Maximum random delay added to each full sync, so many clients don't sync at the same time
+	// The initial sync is delayed by up to SyncJitter as well, so clients started together don't sync together.
+	SyncJitter time.Duration
+	// How long before the session token expires it is refreshed, defaults to 15 minutes
+	TokenRefreshLead time.Duration
+	// Maximum time the initial sync may take, zero waits indefinitely
+	InitialSyncTimeout time.Duration
+	// Only update the cache with full syncs, without receiving events from a stream
+	DisableStream bool
+	// Where stream events are received from
+	// Defaults to the WebSocket, or polling the public endpoints if no primary token is provided
+	Source EventSource
+	// Record every event received from the stream
+	Journal *Journal
+	// Use an API other than the official one
+	APIURL string
+	// How entries are kept in memory, defaults to StorageModeFull
+	Storage StorageMode
+	// The false positive rate of the filter in filter storage mode, defaults to 0.1%
+	FilterFalsePositiveRate float64
+	// The minimum number of domains the filter is sized for, it is resized on every full sync
+	FilterCapacity int
+	// Other blocklists merged with FishFish data in Check, not available in filter storage mode
+	Feeds []Feed
+	// Names of feeds, including FeedNameFishFish, from the highest precedence to the lowest
+	// The verdict comes from the first feed listing an input. Defaults to FishFish, then Feeds in order.
+	FeedPrecedence []string
+	// How often feeds are refetched, defaults to SyncInterval
+	FeedInterval time.Duration
+	// Maximum time fetching each feed may take, defaults to one minute
+	FeedTimeout time.Duration
+	// Local rules that take precedence over synced data in Check, can be replaced later with SetOverrides
+	Overrides *Overrides
+	// Don't flag unknown domains that look like safe domains or targets in Check
+	DisableHeuristics bool
+	// Called with errors that happen after startup, which are retried automatically
+	// Called from multiple goroutines, so it must be safe for concurrent use
+	OnError func(err error)
+}
+
+const (
+	defaultSyncInterval     = time.Hour
+	defaultTokenRefreshLead = time.Minute * 15
+	// Session tokens expire after an hour, used when the API doesn't tell us when
+	defaultTokenLifetime = time.Hour
+	// Avoid hammering the API if a token is about to expire or already has
+	minTokenRefreshDelay = time.Second * 10
+	tokenRetryDelay      = time.Minute
+	defaultFeedTimeout   = time.Minute
+	minStreamBackoff     = time.Second
+	maxStreamBackoff     = time.Minute
+)
+
+// Anonymous clients can't use the WebSocket, so changes are polled instead
+const anonymousPollInterval = time.Minute * 5
+
 type syncContext struct {
 	ctx    context.Context
 	cancel context.CancelFunc
+	// Closed once everything started by StartAutoSync has finished
+	done chan struct{}
 }
 
 func NewAutoSync(primaryToken string, permissions []APIPermission) (*AutoSyncClient, error) {
-	rawClient, err := NewRaw(primaryToken, permissions)
+	return NewAutoSyncWithOptions(primaryToken, permissions, AutoSyncOptions{})
+}
+
+// Create an AutoSync client that receives updates from the specified source instead of the WebSocket
+// A nil source uses the WebSocket, or polls the public endpoints if no primary token is provided
+func NewAutoSyncWithSource(primaryToken string, permissions []APIPermission, source EventSource) (*AutoSyncClient, error) {
+	return NewAutoSyncWithOptions(primaryToken, permissions, AutoSyncOptions{Source: source})
+}
+
+func NewAutoSyncWithOptions(primaryToken string, permissions []APIPermission, options AutoSyncOptions) (*AutoSyncClient, error) {
+	if options.SyncInterval < 0 || options.SyncJitter < 0 || options.TokenRefreshLead < 0 || options.InitialSyncTimeout < 0 || options.FeedInterval < 0 || options.FeedTimeout < 0 {
+		return nil, fmt.Errorf("autosync intervals must not be negative")
+	}
+
+	switch options.Storage {
+	case "":
+		options.Storage = StorageModeFull
+	case StorageModeFull, StorageModeFilter:
+	default:
+		return nil, fmt.Errorf("unknown storage mode: %s", options.Storage)
+	}
+
+	// Feed entries are only kept in full
+	if options.Storage == StorageModeFilter && len(options.Feeds) > 0 {
+		return nil, fmt.Errorf("feeds can't be used in filter storage mode")
+	}
+
+	if options.FilterFalsePositiveRate == 0 {
+		options.FilterFalsePositiveRate = defaultFilterFalsePositiveRate
+	}
+	if options.FilterFalsePositiveRate < 0 || options.FilterFalsePositiveRate >= 1 || options.FilterCapacity < 0 {
+		return nil, fmt.Errorf("invalid filter options")
+	}
+
+	if options.APIURL == "" {
+		options.APIURL = apiRoot
+	}
+
+	rawClient, err := NewRawWithAPIURL(options.APIURL, primaryToken, permissions)
 
 	if err != nil {
 		return nil, err
 	}
 
+	if options.SyncInterval == 0 {
+		options.SyncInterval = defaultSyncInterval
+	}
+	if options.TokenRefreshLead == 0 {
+		options.TokenRefreshLead = defaultTokenRefreshLead
+	}
+	if options.FeedInterval == 0 {
+		options.FeedInterval = options.SyncInterval
+	}
+	if options.FeedTimeout == 0 {
+		options.FeedTimeout = defaultFeedTimeout
+	}
+
+	feedNames := map[string]bool{FeedNameFishFish: true}
+	for _, feed := range options.Feeds {
+		if feedNames[feed.Name()] {
+			return nil, fmt.Errorf("duplicate feed name: %s", feed.Name())
+		}
+
+		feedNames[feed.Name()] = true
+	}
+
+	if options.Source == nil && rawClient.defaultAuthType == authTypeNone {
+		options.Source = NewPollingSource(rawClient, anonymousPollInterval)
+	} else if options.Source == nil {
+		options.Source = NewWebSocketSource(rawClient)
+	}
+
 	client := AutoSyncClient{
-		raw:   *rawClient,
-		cache: domainCache{},
+		raw: rawClient,
+		cache: domainCache{
+			domainIndex:        map[string]Domain{},
+			urlIndex:           map[string]URL{},
+			suffixIndex:        newSuffixIndex(),
+			urlExpressionIndex: map[string]map[string]bool{},
+		},
+		options: options,
+		random:  rand.New(rand.NewSource(time.Now().UnixNano())),
+		status:  newSyncStatus(),
+		feeds:   feedCaches{caches: map[string]*domainCache{}, synced: map[string]time.Time{}},
+	}
+
+	client.overrides.Store(options.Overrides)
+	client.journal.Store(options.Journal)
+
+	if options.Storage == StorageModeFilter {
+		if client.cache.filter, err = client.newDomainFilter(nil); err != nil {
+			return nil, err
+		}
+		client.cache.filterAdded = map[string]int{}
 	}
 
 	return &client, nil
 }
 
+// Replace the cache with a full fetch of all domains and urls
+// Without a primary token, only the name and category of each entry are synced
 func (c *AutoSyncClient) ForceSync() error {
-	c.cache.mx.Lock()
-	defer c.cache.mx.Unlock()
+	return c.forceSync(context.Background())
+}
 
-	domains, err := c.raw.GetDomainsFull()
+func (c *AutoSyncClient) forceSync(ctx context.Context) error {
+	domains, urls, err := fetchSnapshot(ctx, c.raw)
 
 	if err != nil {
 		return fmt.Errorf("failed to sync: %s", err)
 	}
 
-	domainArr := *domains
-	c.cache.domainIndex = map[string]Domain{}
+	if err := c.replaceCache(domains, urls); err != nil {
+		return fmt.Errorf("failed to sync: %s", err)
+	}
+
+	c.status.recordSync(time.Now())
+
+	return nil
+}
 
-	// Index domains in map for faster lookup
-	for i, domain := range domainArr {
-		c.cache.domainIndex[domain.Domain] = domainArr[i]
+// Replace every cached domain and url, e.g. after a full fetch
+func (c *AutoSyncClient) replaceCache(domains map[string]Domain, urls map[string]URL) error {
+	if c.options.Storage == StorageModeFilter {
+		filter, err := c.newDomainFilter(domains)
+
+		if err != nil {
+			return err
+		}
+
+		c.cache.mx.Lock()
+		c.cache.filter = filter
+		c.cache.filterAdded = map[string]int{}
+		c.cache.generation++
+		c.cache.mx.Unlock()
+
+		return nil
 	}
 
+	suffixIndex := newSuffixIndexFromDomains(domains)
+	urlExpressionIndex := newURLExpressionIndex(urls)
+
+	c.cache.mx.Lock()
+	c.cache.domainIndex = domains
+	c.cache.urlIndex = urls
+	c.cache.suffixIndex = suffixIndex
+	c.cache.urlExpressionIndex = urlExpressionIndex
+	c.cache.generation++
+	c.cache.protectedGeneration++
+	c.cache.mx.Unlock()
+
 	return nil
 }
 
-func (c *AutoSyncClient) StartAutoSync() {
-	context, cancel := context.WithCancel(context.Background())
-	c.context.ctx = context
-	c.context.cancel = cancel
+// Time until the next full sync, including jitter
+func (c *AutoSyncClient) nextSyncDelay() time.Duration {
+	return c.options.SyncInterval + c.syncJitter()
+}
 
-	// Force update the cache every hour
-	c.cacheTicker = time.NewTicker(time.Hour)
-	// Session tokens expire after an hour, refresh 15 minutes early just in case
-	c.sessionTicker = time.NewTicker(time.Second * 10)
+// A random delay of up to SyncJitter
+func (c *AutoSyncClient) syncJitter() time.Duration {
+	if c.options.SyncJitter <= 0 {
+		return 0
+	}
 
-	// Generate Session Token
-	// The client should already be able to successfully create a token from initialization
-	token, _ := c.raw.CreateSessionToken()
-	c.raw.SetSessionToken(*token)
+	return time.Duration(c.random.Int63n(int64(c.options.SyncJitter)))
+}
+
+// Time until the session token should be refreshed, based on when it expires
+func (c *AutoSyncClient) nextTokenRefreshDelay(now time.Time) time.Duration {
+	expires := c.raw.GetSessionToken().Expires
+	var delay time.Duration
 
-	// Initial Sync
-	c.ForceSync()
+	if expires > 0 {
+		delay = time.Unix(expires, 0).Sub(now) - c.options.TokenRefreshLead
+	} else {
+		delay = defaultTokenLifetime - c.options.TokenRefreshLead
+	}
+
+	if delay < minTokenRefreshDelay {
+		delay = minTokenRefreshDelay
+	}
+
+	return delay
+}
+
+// Start syncing in the background, returning once the initial sync has finished
+// Errors are reported to AutoSyncOptions.OnError, use Run for a blocking alternative
+func (c *AutoSyncClient) StartAutoSync() {
+	ctx, cancel := context.WithCancel(context.Background())
+	c.context = syncContext{
+		ctx:    ctx,
+		cancel: cancel,
+		done:   make(chan struct{}),
+	}
+
+	started := make(chan struct{})
 
-	// Start automatically syncing domains/urls
 	go func(client *AutoSyncClient) {
-		for {
-			select {
-			case <-c.cacheTicker.C:
-				c.ForceSync()
-			case <-c.context.ctx.Done():
-				return
-			}
+		defer close(client.context.done)
+
+		if err := client.run(ctx, started); err != nil {
+			client.reportError(err)
 		}
 	}(c)
 
-	// Start automatically refreshing the session token
-	go func(client *AutoSyncClient) {
-		for {
-			select {
-			case <-c.sessionTicker.C:
-				token, _ := c.raw.CreateSessionToken()
-				c.raw.SetSessionToken(*token)
-			case <-c.context.ctx.Done():
-				return
-			}
+	<-started
+}
+
+// Stop syncing and wait for everything started by StartAutoSync to finish
+func (c *AutoSyncClient) StopAutoSync() {
+	if c.context.cancel == nil {
+		return
+	}
+
+	c.context.cancel()
+	<-c.context.done
+}
+
+// Keep the cache synced until ctx is cancelled
+// Errors during startup, such as failing to create a session token or the initial sync, are returned immediately.
+// Errors after startup are reported to AutoSyncOptions.OnError and retried.
+// Run only returns once everything it started has finished, returning nil if ctx was cancelled.
+func (c *AutoSyncClient) Run(ctx context.Context) error {
+	return c.run(ctx, nil)
+}
+
+// started is closed once startup has finished, whether it succeeded or not
+func (c *AutoSyncClient) run(ctx context.Context, started chan struct{}) error {
+	startErr := c.startup(ctx)
+
+	if started != nil {
+		close(started)
+	}
+
+	if startErr != nil {
+		c.status.recordError(startErr, time.Now())
+		return startErr
+	}
+
+	var wg sync.WaitGroup
+
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		c.syncLoop(ctx)
+	}()
+	go func() {
+		defer wg.Done()
+		c.tokenLoop(ctx)
+	}()
+
+	if len(c.options.Feeds) > 0 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			c.feedLoop(ctx)
+		}()
+	}
+
+	if !c.options.DisableStream {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			c.streamLoop(ctx)
+		}()
+	}
+
+	<-ctx.Done()
+	wg.Wait()
+
+	return nil
+}
+
+// Create a fresh session token and fill the cache
+func (c *AutoSyncClient) startup(ctx context.Context) error {
+	if jitter := c.syncJitter(); jitter > 0 {
+		select {
+		case <-time.After(jitter):
+		case <-ctx.Done():
+			return fmt.Errorf("initial sync failed: %s", ctx.Err())
 		}
-	}(c)
+	}
 
-	// Start the websocket to add new domains
-	go func(client *AutoSyncClient) {
-		ch := make(chan WSEvent)
-		go client.raw.ConnectWS(c.context.ctx, ch)
+	if c.raw.primaryToken != "" {
+		token, err := c.raw.CreateSessionToken()
+
+		if err != nil {
+			return fmt.Errorf("failed to create session token: %s", err)
+		}
+
+		c.raw.SetSessionToken(*token)
+	}
+
+	initialCtx := ctx
+	if c.options.InitialSyncTimeout > 0 {
+		var cancel context.CancelFunc
+		initialCtx, cancel = context.WithTimeout(ctx, c.options.InitialSyncTimeout)
+		defer cancel()
+	}
 
-		for {
-			data := <-ch
+	if err := c.forceSync(initialCtx); err != nil {
+		return fmt.Errorf("initial sync failed: %s", err)
+	}
 
-			if data.Data == nil {
-				// WebSocket was closed
-				return
+	// FishFish data is enough to start, feeds that fail are retried later
+	if err := c.SyncFeeds(initialCtx); err != nil {
+		c.reportError(err)
+	}
+
+	return nil
+}
+
+// Periodically replace the whole cache
+func (c *AutoSyncClient) syncLoop(ctx context.Context) {
+	timer := time.NewTimer(c.nextSyncDelay())
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-timer.C:
+			if err := c.forceSync(ctx); err != nil && ctx.Err() == nil {
+				c.reportError(err)
 			}
+			timer.Reset(c.nextSyncDelay())
+		case <-ctx.Done():
+			return
+		}
+	}
+}
 
-			c.cache.mx.Lock()
+// Refresh the session token before it expires
+// Anonymous clients don't have one
+func (c *AutoSyncClient) tokenLoop(ctx context.Context) {
+	if c.raw.primaryToken == "" {
+		return
+	}
 
-			dataAsMap := data.Data.(map[string]interface{})
+	timer := time.NewTimer(c.nextTokenRefreshDelay(time.Now()))
+	defer timer.Stop()
 
-			switch data.Type {
-			case WSEventTypeDomainCreate:
-				createData, err := JSONStructToMap[WSCreateDomainData](dataAsMap)
+	for {
+		select {
+		case <-timer.C:
+			token, err := c.raw.CreateSessionToken()
 
-				if err != nil {
-					continue
-				}
+			if err != nil {
+				c.reportError(fmt.Errorf("failed to refresh session token: %s", err))
+				timer.Reset(tokenRetryDelay)
+				continue
+			}
 
-				now := time.Now().Unix()
-				domain := Domain{
-					Domain:      createData.Domain,
-					Description: createData.Description,
-					Category:    createData.Category,
-					Target:      createData.Target,
-					Added:       now,
-					Checked:     now,
-				}
-				c.cache.domainIndex[domain.Domain] = domain
-			case WSEventTypeDomainUpdate:
-				updateData, err := JSONStructToMap[WSUpdateDomainData](dataAsMap)
+			c.raw.SetSessionToken(*token)
+			timer.Reset(c.nextTokenRefreshDelay(time.Now()))
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// Apply events from the source, reconnecting with a backoff if it fails
+// A source that finishes without an error is not restarted
+func (c *AutoSyncClient) streamLoop(ctx context.Context) {
+	backoff := minStreamBackoff
 
-				if err != nil {
-					continue
+	for {
+		ch := make(chan WSEvent)
+		sourceErr := make(chan error, 1)
+
+		// Sources that don't report connecting are connected once they deliver an event
+		sourceCtx := withConnectedHook(ctx, func() {
+			c.status.setStreamConnected(true)
+		})
+		sourceCtx = withErrorHook(sourceCtx, func(err error) {
+			c.reportError(fmt.Errorf("event source error: %s", err))
+		})
+		sourceCtx = withBaselineHook(sourceCtx, c.cachedSnapshot)
+
+		go func() {
+			sourceErr <- c.options.Source.Run(sourceCtx, ch)
+			// Source was closed
+			close(ch)
+		}()
+
+		for data := range ch {
+			received := time.Now()
+			// Receiving events means the source is healthy again
+			backoff = minStreamBackoff
+			c.status.setStreamConnected(true)
+			c.status.recordEvent(received)
+
+			if journal := c.journal.Load(); journal != nil {
+				// The event is written before it is applied, a failed write is reported but still applied
+				if _, err := journal.AppendAt(data, received); err != nil {
+					c.reportError(fmt.Errorf("failed to journal event: %s", err))
 				}
+			}
 
-				currentDomain := c.cache.domainIndex[updateData.Domain]
+			if err := c.applyEvent(data, received); err != nil {
+				c.reportError(fmt.Errorf("failed to apply %s event: %s", data.Type, err))
+			}
+		}
 
-				if updateData.Category != "" {
-					currentDomain.Category = updateData.Category
-				}
-				if updateData.Description != "" {
-					currentDomain.Description = updateData.Description
-				}
-				if updateData.Target != "" {
-					currentDomain.Target = updateData.Target
-				}
-				currentDomain.Checked = updateData.Checked
-			case WSEventTypeDomainDelete:
-				deleteData, err := JSONStructToMap[WSDeleteDomainData](dataAsMap)
+		err := <-sourceErr
+		c.status.setStreamConnected(false)
 
-				if err != nil {
-					continue
-				}
+		if ctx.Err() != nil || err == nil {
+			return
+		}
 
-				delete(c.cache.domainIndex, deleteData.Domain)
-			case WSEventTypeURLCreate:
-				createData, err := JSONStructToMap[WSCreateURLData](dataAsMap)
+		c.reportError(fmt.Errorf("event source failed: %s", err))
 
-				if err != nil {
-					continue
-				}
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return
+		}
 
-				now := time.Now().Unix()
-				url := URL{
-					URL:         createData.URL,
-					Description: createData.Description,
-					Category:    createData.Category,
-					Target:      createData.Target,
-					Added:       now,
-					Checked:     now,
-				}
+		backoff *= 2
+		if backoff > maxStreamBackoff {
+			backoff = maxStreamBackoff
+		}
+	}
+}
 
-				c.cache.urlIndex[url.URL] = url
-			case WSEventTypeURLUpdate:
-				updateData, err := JSONStructToMap[WSUpdateURLData](dataAsMap)
+// A copy of every cached domain and url, so sources can start from the last sync instead of fetching again
+// Filter storage mode doesn't keep the entries.
+func (c *AutoSyncClient) cachedSnapshot() (map[string]Domain, map[string]URL, bool) {
+	if c.options.Storage == StorageModeFilter {
+		return nil, nil, false
+	}
 
-				if err != nil {
-					continue
-				}
+	c.cache.mx.RLock()
+	defer c.cache.mx.RUnlock()
 
-				currentURL := c.cache.urlIndex[updateData.URL]
+	domains := make(map[string]Domain, len(c.cache.domainIndex))
+	for name, domain := range c.cache.domainIndex {
+		domains[name] = domain
+	}
 
-				if updateData.Category != "" {
-					currentURL.Category = updateData.Category
-				}
-				if updateData.Description != "" {
-					currentURL.Description = updateData.Description
-				}
-				if updateData.Target != "" {
-					currentURL.Target = updateData.Target
-				}
-				currentURL.Checked = updateData.Checked
-				c.cache.urlIndex[currentURL.URL] = currentURL
+	urls := make(map[string]URL, len(c.cache.urlIndex))
+	for name, url := range c.cache.urlIndex {
+		urls[name] = url
+	}
 
-			case WSEventTypeURLDelete:
-				deleteData, err := JSONStructToMap[WSDeleteURLData](dataAsMap)
+	return domains, urls, true
+}
 
-				if err != nil {
-					continue
-				}
+func (c *AutoSyncClient) reportError(err error) {
+	c.status.recordError(err, time.Now())
 
-				delete(c.cache.urlIndex, deleteData.URL)
-			}
+	if c.options.OnError != nil {
+		c.options.OnError(err)
+	}
+}
 
-			c.cache.mx.Unlock()
+// Apply a stream event to the cache as if it had been received from the WebSocket
+func (c *AutoSyncClient) ApplyEvent(event WSEvent) error {
+	return c.applyEvent(event, time.Now())
+}
+
+func (c *AutoSyncClient) applyEvent(event WSEvent, received time.Time) error {
+	c.cache.mx.Lock()
+	defer c.cache.mx.Unlock()
+
+	c.cache.generation++
+
+	if c.cache.filter != nil {
+		return c.cache.applyFilterEvent(event)
+	}
+
+	switch event.Type {
+	case WSEventTypeDomainCreate:
+		createData, err := decodeEventData[WSCreateDomainData](event.Data)
+
+		if err != nil {
+			return err
 		}
-	}(c)
+
+		now := received.Unix()
+		domain := Domain{
+			Domain:      createData.Domain,
+			Description: createData.Description,
+			Category:    createData.Category,
+			Target:      createData.Target,
+			Added:       now,
+			Checked:     now,
+		}
+		c.cache.updateProtected(domainProtection(c.cache.domainIndex[domain.Domain]), domainProtection(domain))
+		c.cache.domainIndex[domain.Domain] = domain
+		c.cache.suffixIndex.insert(domain.Domain)
+	case WSEventTypeDomainUpdate:
+		updateData, err := decodeEventData[WSUpdateDomainData](event.Data)
+
+		if err != nil {
+			return err
+		}
+
+		currentDomain := c.cache.domainIndex[updateData.Domain]
+		currentDomain.Domain = updateData.Domain
+
+		if updateData.Category != "" {
+			currentDomain.Category = updateData.Category
+		}
+		if updateData.Description != "" {
+			currentDomain.Description = updateData.Description
+		}
+		if updateData.Target != "" {
+			currentDomain.Target = updateData.Target
+		}
+		currentDomain.Checked = updateData.Checked
+		c.cache.updateProtected(domainProtection(c.cache.domainIndex[currentDomain.Domain]), domainProtection(currentDomain))
+		c.cache.domainIndex[currentDomain.Domain] = currentDomain
+		c.cache.suffixIndex.insert(currentDomain.Domain)
+	case WSEventTypeDomainDelete:
+		deleteData, err := decodeEventData[WSDeleteDomainData](event.Data)
+
+		if err != nil {
+			return err
+		}
+
+		c.cache.updateProtected(domainProtection(c.cache.domainIndex[deleteData.Domain]), protection{})
+		delete(c.cache.domainIndex, deleteData.Domain)
+		c.cache.suffixIndex.remove(deleteData.Domain)
+	case WSEventTypeURLCreate:
+		createData, err := decodeEventData[WSCreateURLData](event.Data)
+
+		if err != nil {
+			return err
+		}
+
+		now := received.Unix()
+		url := URL{
+			URL:         createData.URL,
+			Description: createData.Description,
+			Category:    createData.Category,
+			Target:      createData.Target,
+			Added:       now,
+			Checked:     now,
+		}
+
+		c.cache.updateProtected(protection{target: c.cache.urlIndex[url.URL].Target}, protection{target: url.Target})
+		c.cache.urlIndex[url.URL] = url
+		c.cache.indexURL(url.URL)
+	case WSEventTypeURLUpdate:
+		updateData, err := decodeEventData[WSUpdateURLData](event.Data)
+
+		if err != nil {
+			return err
+		}
+
+		currentURL := c.cache.urlIndex[updateData.URL]
+		currentURL.URL = updateData.URL
+
+		if updateData.Category != "" {
+			currentURL.Category = updateData.Category
+		}
+		if updateData.Description != "" {
+			currentURL.Description = updateData.Description
+		}
+		if updateData.Target != "" {
+			currentURL.Target = updateData.Target
+		}
+		currentURL.Checked = updateData.Checked
+		c.cache.updateProtected(protection{target: c.cache.urlIndex[currentURL.URL].Target}, protection{target: currentURL.Target})
+		c.cache.urlIndex[currentURL.URL] = currentURL
+		c.cache.indexURL(currentURL.URL)
+	case WSEventTypeURLDelete:
+		deleteData, err := decodeEventData[WSDeleteURLData](event.Data)
+
+		if err != nil {
+			return err
+		}
+
+		c.cache.updateProtected(protection{target: c.cache.urlIndex[deleteData.URL].Target}, protection{})
+		delete(c.cache.urlIndex, deleteData.URL)
+		c.cache.unindexURL(deleteData.URL)
+	default:
+		return fmt.Errorf("unknown event type: %s", event.Type)
+	}
+
+	return nil
 }
 
-func (c *AutoSyncClient) StopAutoSync() {
-	c.cacheTicker.Stop()
-	c.sessionTicker.Stop()
-	c.context.cancel()
+// Must be called with the cache locked
+func (c *domainCache) indexURL(name string) {
+	addURLExpression(c.urlExpressionIndex, name)
+}
+
+// Must be called with the cache locked
+func (c *domainCache) unindexURL(name string) {
+	key, ok := urlIndexKey(name)
+
+	if !ok {
+		return
+	}
+
+	// Other listed URLs may share the same canonical form
+	delete(c.urlExpressionIndex[key], name)
+
+	if len(c.urlExpressionIndex[key]) == 0 {
+		delete(c.urlExpressionIndex, key)
+	}
+}
+
+// Record every event received from the stream in the specified journal
+func (c *AutoSyncClient) SetJournal(journal *Journal) {
+	c.journal.Store(journal)
 }
 
 func (c *AutoSyncClient) GetDomains() []Domain {
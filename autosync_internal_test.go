@@ -0,0 +1,71 @@
+package fishfish
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestNextSyncDelay(t *testing.T) {
+	client, err := NewAutoSyncWithOptions("", []APIPermission{}, AutoSyncOptions{SyncInterval: time.Minute, SyncJitter: time.Second})
+	mustPanicInternal(err)
+
+	for i := 0; i < 1000; i++ {
+		if delay := client.nextSyncDelay(); delay < time.Minute || delay >= time.Minute+time.Second {
+			panic(fmt.Errorf("expected a delay between 1m and 1m1s, got %s", delay))
+		}
+
+		if jitter := client.syncJitter(); jitter < 0 || jitter >= time.Second {
+			panic(fmt.Errorf("expected a jitter below 1s, got %s", jitter))
+		}
+	}
+
+	client, err = NewAutoSyncWithOptions("", []APIPermission{}, AutoSyncOptions{SyncInterval: time.Minute})
+	mustPanicInternal(err)
+
+	if delay := client.nextSyncDelay(); delay != time.Minute {
+		panic(fmt.Errorf("expected exactly 1m without jitter, got %s", delay))
+	}
+}
+
+func TestNextTokenRefreshDelay(t *testing.T) {
+	client, err := NewAutoSyncWithOptions("", []APIPermission{}, AutoSyncOptions{TokenRefreshLead: time.Minute * 10})
+	mustPanicInternal(err)
+
+	now := time.Unix(1700000000, 0)
+
+	tests := []struct {
+		expires  int64
+		expected time.Duration
+	}{
+		{now.Add(time.Hour).Unix(), time.Minute * 50},
+		// Tokens without an expiry are assumed to last an hour
+		{0, defaultTokenLifetime - time.Minute*10},
+		// Tokens about to expire, or already expired, aren't refreshed in a tight loop
+		{now.Add(time.Minute * 5).Unix(), minTokenRefreshDelay},
+		{now.Add(-time.Minute).Unix(), minTokenRefreshDelay},
+	}
+
+	for _, test := range tests {
+		client.raw.SetSessionToken(SessionToken{Token: "session", Expires: test.expires})
+
+		if delay := client.nextTokenRefreshDelay(now); delay != test.expected {
+			panic(fmt.Errorf("expires %d: expected %s, got %s", test.expires, test.expected, delay))
+		}
+	}
+
+	// The lead defaults to 15 minutes
+	client, err = NewAutoSyncWithOptions("", []APIPermission{}, AutoSyncOptions{})
+	mustPanicInternal(err)
+	client.raw.SetSessionToken(SessionToken{Token: "session", Expires: now.Add(time.Hour).Unix()})
+
+	if delay := client.nextTokenRefreshDelay(now); delay != time.Minute*45 {
+		panic(fmt.Errorf("expected the default lead to refresh after 45m, got %s", delay))
+	}
+}
+
+func mustPanicInternal(err error) {
+	if err != nil {
+		panic(err)
+	}
+}
@@ -1,11 +1,15 @@
 package fishfish_test
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"testing"
 	"time"
 
-	"github.com/existentiality/fishfish-go"
+	"github.com/existagon/fishfish-go"
 )
 
 var autoClient *fishfish.AutoSyncClient
@@ -29,7 +33,10 @@ func TestAutoSyncForceSync(t *testing.T) {
 func TestAutoSyncStart(t *testing.T) {
 	autoClient.StartAutoSync()
 
-	time.Sleep(time.Second * 10)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+
+	mustPanic(autoClient.WaitReady(ctx))
 }
 
 func TestAutoSyncGetDomains(t *testing.T) {
@@ -63,3 +70,231 @@ func TestAutoSyncGetDomain(t *testing.T) {
 func TestAutoSyncStop(t *testing.T) {
 	autoClient.StopAutoSync()
 }
+
+func TestAutoSyncRun(t *testing.T) {
+	api := newTestAPI(t, []fishfish.Domain{{Domain: "phish.example", Category: fishfish.CategoryPhishing}}, nil)
+
+	client, err := fishfish.NewAutoSyncWithOptions("", []fishfish.APIPermission{}, fishfish.AutoSyncOptions{
+		APIURL: api.URL,
+		Source: fishfish.NewChannelSource(make(chan fishfish.WSEvent)),
+	})
+	mustPanic(err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+
+	go func() {
+		done <- client.Run(ctx)
+	}()
+
+	mustPanic(client.WaitReady(ctx))
+
+	_, err = client.GetDomain("phish.example")
+	mustPanic(err)
+
+	res := httptest.NewRecorder()
+	client.HealthHandler(time.Hour).ServeHTTP(res, httptest.NewRequest("GET", "/healthz", nil))
+
+	if res.Code != http.StatusOK {
+		panic(fmt.Errorf("expected health status 200, got %d", res.Code))
+	}
+
+	if status := client.Status(); status.Domains[fishfish.CategoryPhishing] != 1 {
+		panic(fmt.Errorf("expected 1 phishing domain in status, got %v", status.Domains))
+	}
+
+	cancel()
+
+	if err := <-done; err != nil {
+		panic(fmt.Errorf("expected nil error after cancelling, got %s", err))
+	}
+}
+
+func TestAutoSyncRunStartupError(t *testing.T) {
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer api.Close()
+
+	client, err := fishfish.NewAutoSyncWithOptions("", []fishfish.APIPermission{}, fishfish.AutoSyncOptions{APIURL: api.URL})
+	mustPanic(err)
+
+	if err := client.Run(context.Background()); err == nil {
+		panic("expected startup error")
+	}
+
+	res := httptest.NewRecorder()
+	client.HealthHandler(0).ServeHTTP(res, httptest.NewRequest("GET", "/healthz", nil))
+
+	if res.Code != http.StatusServiceUnavailable {
+		panic(fmt.Errorf("expected health status 503, got %d", res.Code))
+	}
+}
+
+func TestAutoSyncRunUnreachableAPI(t *testing.T) {
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(fishfish.SessionToken{Token: "session", Expires: time.Now().Add(time.Hour).Unix()})
+	}))
+
+	client, err := fishfish.NewAutoSyncWithOptions("primary", []fishfish.APIPermission{}, fishfish.AutoSyncOptions{APIURL: api.URL})
+	mustPanic(err)
+
+	// Creating the session token on startup now fails to connect
+	api.Close()
+
+	if err := client.Run(context.Background()); err == nil {
+		panic("expected startup error")
+	}
+
+	if status := client.Status(); status.LastError == "" {
+		panic(fmt.Errorf("expected the startup error in status, got %+v", status))
+	}
+}
+
+// Never connects, like a WebSocket that can't reach the API
+type unreachableSource struct{}
+
+func (unreachableSource) Run(ctx context.Context, ch chan fishfish.WSEvent) error {
+	<-ctx.Done()
+	return nil
+}
+
+func TestAutoSyncStreamConnected(t *testing.T) {
+	api := newTestAPI(t, nil, nil)
+
+	for _, test := range []struct {
+		source    fishfish.EventSource
+		connected bool
+	}{
+		{unreachableSource{}, false},
+		{fishfish.NewChannelSource(make(chan fishfish.WSEvent)), true},
+	} {
+		client, err := fishfish.NewAutoSyncWithOptions("", []fishfish.APIPermission{}, fishfish.AutoSyncOptions{APIURL: api.URL, Source: test.source})
+		mustPanic(err)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan error)
+
+		go func() {
+			done <- client.Run(ctx)
+		}()
+
+		mustPanic(client.WaitReady(ctx))
+
+		// The source connects asynchronously
+		deadline := time.Now().Add(time.Second)
+		for !client.Status().StreamConnected && time.Now().Before(deadline) {
+			time.Sleep(10 * time.Millisecond)
+		}
+
+		if connected := client.Status().StreamConnected; connected != test.connected {
+			panic(fmt.Errorf("%T: expected stream connected %t, got %t", test.source, test.connected, connected))
+		}
+
+		cancel()
+		mustPanic(<-done)
+	}
+}
+
+// Create an AutoSync client with the specified entries, without contacting the API
+func newTestAutoSync(domains []fishfish.Domain, urls []fishfish.URL) *fishfish.AutoSyncClient {
+	client, err := fishfish.NewAutoSync("", []fishfish.APIPermission{})
+	mustPanic(err)
+
+	for _, d := range domains {
+		mustPanic(client.ApplyEvent(fishfish.WSEvent{Type: fishfish.WSEventTypeDomainCreate, Data: fishfish.WSCreateDomainData{
+			Domain:      d.Domain,
+			Description: d.Description,
+			Category:    d.Category,
+			Target:      d.Target,
+		}}))
+	}
+
+	for _, u := range urls {
+		mustPanic(client.ApplyEvent(fishfish.WSEvent{Type: fishfish.WSEventTypeURLCreate, Data: fishfish.WSCreateURLData{
+			URL:         u.URL,
+			Description: u.Description,
+			Category:    u.Category,
+			Target:      u.Target,
+		}}))
+	}
+
+	return client
+}
+
+func TestAutoSyncInitialSyncTimeout(t *testing.T) {
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Never answers before the client gives up
+		<-r.Context().Done()
+	}))
+	defer api.Close()
+
+	client, err := fishfish.NewAutoSyncWithOptions("", []fishfish.APIPermission{}, fishfish.AutoSyncOptions{
+		APIURL:             api.URL,
+		InitialSyncTimeout: time.Millisecond * 50,
+	})
+	mustPanic(err)
+
+	started := time.Now()
+
+	if err := client.Run(context.Background()); err == nil {
+		panic("expected the initial sync to time out")
+	}
+
+	if elapsed := time.Since(started); elapsed > time.Second*5 {
+		panic(fmt.Errorf("expected the initial sync to time out after 50ms, took %s", elapsed))
+	}
+}
+
+func TestAutoSyncInitialSyncJitter(t *testing.T) {
+	requests := make(chan struct{}, 100)
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests <- struct{}{}
+		json.NewEncoder(w).Encode([]string{})
+	}))
+	defer api.Close()
+
+	client, err := fishfish.NewAutoSyncWithOptions("", []fishfish.APIPermission{}, fishfish.AutoSyncOptions{
+		APIURL:     api.URL,
+		SyncJitter: time.Hour,
+	})
+	mustPanic(err)
+
+	// The initial sync waits for its jitter, which is almost certainly longer than this
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*50)
+	defer cancel()
+
+	if err := client.Run(ctx); err == nil {
+		panic("expected startup to be cancelled while waiting for the jitter")
+	}
+
+	if len(requests) != 0 {
+		panic(fmt.Errorf("expected no requests before the jitter, got %d", len(requests)))
+	}
+}
+
+func TestAutoSyncDisableStream(t *testing.T) {
+	api := newTestAPI(t, nil, nil)
+	events := make(chan fishfish.WSEvent)
+
+	client, err := fishfish.NewAutoSyncWithOptions("", []fishfish.APIPermission{}, fishfish.AutoSyncOptions{
+		APIURL:        api.URL,
+		Source:        fishfish.NewChannelSource(events),
+		DisableStream: true,
+	})
+	mustPanic(err)
+
+	client.StartAutoSync()
+	defer client.StopAutoSync()
+
+	// Nothing receives from the source
+	select {
+	case events <- fishfish.WSEvent{Type: fishfish.WSEventTypeDomainCreate, Data: fishfish.WSCreateDomainData{Domain: "phish.example", Category: fishfish.CategoryPhishing}}:
+		panic("expected the source not to be started")
+	case <-time.After(time.Millisecond * 100):
+	}
+
+	if status := client.Status(); status.StreamConnected {
+		panic("expected the stream not to be connected")
+	}
+}
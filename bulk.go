@@ -0,0 +1,50 @@
+package fishfish
+
+// The outcome of submitting one entry of a bulk submission
+type BulkResult struct {
+	// The refanged name that was submitted
+	Name string
+	Err  error
+}
+
+// Add many domains, one request at a time in sorted order
+// Defanged names are refanged first, entries that refang to an already submitted name are skipped.
+func (c *RawClient) AddDomains(domains map[string]CreateDomainRequest) []BulkResult {
+	results := []BulkResult{}
+	submitted := map[string]bool{}
+
+	for _, name := range sortedKeys(domains) {
+		refanged := normalizeHost(name)
+
+		if submitted[refanged] {
+			continue
+		}
+
+		submitted[refanged] = true
+		_, err := c.AddDomain(refanged, domains[name])
+		results = append(results, BulkResult{Name: refanged, Err: err})
+	}
+
+	return results
+}
+
+// Add many urls, one request at a time in sorted order
+// Defanged urls are refanged first, entries that refang to an already submitted url are skipped.
+func (c *RawClient) AddURLs(urls map[string]CreateURLRequest) []BulkResult {
+	results := []BulkResult{}
+	submitted := map[string]bool{}
+
+	for _, name := range sortedKeys(urls) {
+		refanged := Refang(name)
+
+		if submitted[refanged] {
+			continue
+		}
+
+		submitted[refanged] = true
+		_, err := c.AddURL(refanged, urls[name])
+		results = append(results, BulkResult{Name: refanged, Err: err})
+	}
+
+	return results
+}
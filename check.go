@@ -0,0 +1,214 @@
+package fishfish
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+)
+
+type InputKind string
+
+const (
+	InputKindDomain = "domain"
+	InputKindURL    = "url"
+)
+
+type VerdictSource string
+
+const (
+	// The verdict is based on the local AutoSync cache
+	VerdictSourceCache = "cache"
+	// The verdict is based on a request to the API
+	VerdictSourceAPI = "api"
+	// The verdict is based on a local override, see Overrides
+	VerdictSourceOverride = "override"
+	// The input isn't listed, but looks like it imitates a safe domain or target
+	VerdictSourceHeuristic = "heuristic"
+)
+
+// The result of checking a domain, url or bare host
+type Verdict struct {
+	Input string    `json:"input"`
+	Kind  InputKind `json:"kind"`
+	// The normalized host of the input
+	Host string `json:"host"`
+	// Whether a listed entry applies to the input
+	// Unknown inputs have no category, which is not the same as being listed as safe.
+	Known    bool     `json:"known"`
+	Category Category `json:"category,omitempty"`
+	// The listed entry the verdict is based on, at most one of these is set
+	Domain    *Domain       `json:"domain,omitempty"`
+	URL       *URL          `json:"url,omitempty"`
+	MatchType MatchType     `json:"match_type,omitempty"`
+	Source    VerdictSource `json:"source"`
+	// When the data the verdict is based on was last updated
+	AsOf time.Time `json:"as_of"`
+	// The feeds listing the input, from the highest precedence to the lowest, see FeedNameFishFish
+	// The verdict is based on the entry of the first one.
+	Feeds []string `json:"feeds,omitempty"`
+	// The local rule the verdict is based on, only set for overrides
+	Override *Override `json:"override,omitempty"`
+	// Why an unknown input looks suspicious, only set by heuristics
+	Suspicion *Suspicion `json:"suspicion,omitempty"`
+	// Why the input couldn't be checked, e.g. invalid input or an unreachable API
+	Error string `json:"error,omitempty"`
+}
+
+// Whether the input is listed as phishing or malware
+func (v Verdict) Malicious() bool {
+	return v.Known && (v.Category == CategoryPhishing || v.Category == CategoryMalware)
+}
+
+// Whether the input is listed as safe
+func (v Verdict) Safe() bool {
+	return v.Known && v.Category == CategorySafe
+}
+
+// Whether the input isn't listed but looks like it imitates a safe domain or target
+func (v Verdict) Suspicious() bool {
+	return !v.Known && v.Suspicion != nil
+}
+
+// Parse input into a verdict to fill in, and the canonical URL if it is one
+func newVerdict(input string) (Verdict, *canonicalURL) {
+	verdict := Verdict{Input: input, Kind: InputKindDomain}
+	trimmed := Refang(strings.TrimSpace(input))
+
+	if strings.Contains(trimmed, "://") || strings.ContainsAny(trimmed, "/?") {
+		verdict.Kind = InputKindURL
+		parsed, err := parseCanonicalURL(trimmed)
+
+		if err != nil {
+			verdict.Error = fmt.Sprintf("invalid url: %s", err)
+			return verdict, nil
+		}
+
+		verdict.Host = parsed.host
+		return verdict, parsed
+	}
+
+	host, err := canonicalHost(trimmed)
+
+	if err != nil {
+		verdict.Error = fmt.Sprintf("invalid domain: %s", err)
+	}
+
+	verdict.Host = host
+
+	return verdict, nil
+}
+
+func (v *Verdict) setDomain(domain Domain, matchType MatchType) {
+	v.Known = true
+	v.Category = domain.Category
+	v.Domain = &domain
+	v.MatchType = matchType
+}
+
+func (v *Verdict) setURL(url URL, matchType MatchType) {
+	v.Known = true
+	v.Category = url.Category
+	v.URL = &url
+	v.MatchType = matchType
+}
+
+// Check a domain, url or bare host against the cache
+// Overrides take precedence over everything else.
+// URLs are matched with MatchURL and domains with MatchDomain, against FishFish data and any other feeds.
+// In filter storage mode only domains are checked, possible matches are confirmed with the API.
+// Unknown inputs that look like a safe domain or target are marked as suspicious, unless heuristics are disabled.
+func (c *AutoSyncClient) Check(ctx context.Context, input string) Verdict {
+	verdict, parsed := newVerdict(input)
+	verdict.Source = VerdictSourceCache
+	verdict.AsOf = c.status.dataAsOf()
+
+	if verdict.Error != "" {
+		return verdict
+	}
+
+	if c.applyOverrides(&verdict, parsed) {
+		return verdict
+	}
+
+	if c.options.Storage == StorageModeFilter {
+		c.checkFilter(ctx, &verdict)
+	} else {
+		c.checkFeeds(&verdict, parsed)
+	}
+
+	if !verdict.Known && !c.options.DisableHeuristics {
+		if suspicion, ok := c.detectSuspicion(verdict.Host); ok {
+			verdict.Suspicion = suspicion
+			verdict.Source = VerdictSourceHeuristic
+		}
+	}
+
+	return verdict
+}
+
+// Check a domain, url or bare host using the API
+// URLs are looked up as given and in canonical form, then their host and its parent domains are looked up
+// down to the registrable domain. This can take several requests, prefer the AutoSync client for frequent checks.
+func (c *RawClient) Check(ctx context.Context, input string) Verdict {
+	verdict, parsed := newVerdict(input)
+	verdict.Source = VerdictSourceAPI
+	verdict.AsOf = time.Now()
+
+	if verdict.Error != "" {
+		return verdict
+	}
+
+	if parsed != nil {
+		candidates := []string{Refang(strings.TrimSpace(input))}
+		if canonical := parsed.String(); canonical != candidates[0] {
+			candidates = append(candidates, canonical)
+		}
+
+		for _, candidate := range candidates {
+			url, err := c.getURL(ctx, candidate)
+
+			if err == nil {
+				verdict.setURL(*url, MatchTypeExact)
+				return verdict
+			}
+
+			if !errors.Is(err, ErrNotFound) {
+				verdict.Error = err.Error()
+				return verdict
+			}
+		}
+	}
+
+	labels := []string{verdict.Host}
+	suffixLen := 0
+
+	// IP addresses have no parent domains
+	if net.ParseIP(verdict.Host) == nil {
+		labels = strings.Split(verdict.Host, ".")
+		suffixLen, _ = DefaultPublicSuffixList().suffixLabels(labels)
+	}
+
+	for i := 0; i < len(labels)-suffixLen || i == 0; i++ {
+		domain, err := c.getDomain(ctx, strings.Join(labels[i:], "."))
+
+		if err == nil {
+			matchType := MatchType(MatchTypeExact)
+			if i > 0 {
+				matchType = MatchTypeParent
+			}
+
+			verdict.setDomain(*domain, matchType)
+			return verdict
+		}
+
+		if !errors.Is(err, ErrNotFound) {
+			verdict.Error = err.Error()
+			return verdict
+		}
+	}
+
+	return verdict
+}
@@ -0,0 +1,113 @@
+package fishfish_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/existagon/fishfish-go"
+)
+
+func TestAutoSyncCheck(t *testing.T) {
+	client := newTestAutoSync([]fishfish.Domain{
+		{Domain: "steamcommunity-gift.ru", Category: fishfish.CategoryPhishing},
+		{Domain: "discord.com", Category: fishfish.CategorySafe},
+	}, []fishfish.URL{
+		{URL: "https://sites.example/scam", Category: fishfish.CategoryMalware},
+	})
+
+	tests := []struct {
+		input     string
+		kind      fishfish.InputKind
+		category  fishfish.Category
+		matchType fishfish.MatchType
+	}{
+		{"login.steamcommunity-gift.ru", fishfish.InputKindDomain, fishfish.CategoryPhishing, fishfish.MatchTypeParent},
+		{"https://steamcommunity-gift.ru/trade", fishfish.InputKindURL, fishfish.CategoryPhishing, fishfish.MatchTypeExact},
+		{"sites.example/scam/page", fishfish.InputKindURL, fishfish.CategoryMalware, fishfish.MatchTypePrefix},
+		{"Discord.com", fishfish.InputKindDomain, fishfish.CategorySafe, fishfish.MatchTypeExact},
+	}
+
+	for _, test := range tests {
+		verdict := client.Check(context.Background(), test.input)
+
+		if !verdict.Known || verdict.Kind != test.kind || verdict.Category != test.category || verdict.MatchType != test.matchType {
+			panic(fmt.Errorf("%s: unexpected verdict %+v", test.input, verdict))
+		}
+	}
+
+	unknown := client.Check(context.Background(), "example.org")
+	if unknown.Known || unknown.Safe() || unknown.Malicious() || unknown.Source != fishfish.VerdictSourceCache {
+		panic(fmt.Errorf("expected an unknown verdict, got %+v", unknown))
+	}
+}
+
+func TestRawCheck(t *testing.T) {
+	api := newTestAPI(t, []fishfish.Domain{{Domain: "steamcommunity-gift.ru", Category: fishfish.CategoryPhishing}}, nil)
+
+	client, err := fishfish.NewRawWithAPIURL(api.URL, "", []fishfish.APIPermission{})
+	mustPanic(err)
+
+	verdict := client.Check(context.Background(), "login.steamcommunity-gift.ru")
+
+	if !verdict.Malicious() || verdict.MatchType != fishfish.MatchTypeParent || verdict.Source != fishfish.VerdictSourceAPI {
+		panic(fmt.Errorf("unexpected verdict %+v", verdict))
+	}
+
+	verdict = client.Check(context.Background(), "example.org")
+
+	if verdict.Known || verdict.Error != "" {
+		panic(fmt.Errorf("expected an unknown verdict, got %+v", verdict))
+	}
+}
+
+func TestRawCheckIP(t *testing.T) {
+	requested := []string{}
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requested = append(requested, r.URL.Path)
+		http.NotFound(w, r)
+	}))
+	t.Cleanup(api.Close)
+
+	client, err := fishfish.NewRawWithAPIURL(api.URL, "", []fishfish.APIPermission{})
+	mustPanic(err)
+
+	// IP addresses have no parent domains to look up
+	if verdict := client.Check(context.Background(), "1.2.3.4"); verdict.Known || verdict.Error != "" {
+		panic(fmt.Errorf("expected an unknown verdict, got %+v", verdict))
+	}
+
+	if len(requested) != 1 || requested[0] != "/domains/1.2.3.4" {
+		panic(fmt.Errorf("expected only the address to be looked up, got %v", requested))
+	}
+}
+
+func TestRawCheckURLPath(t *testing.T) {
+	requested := []string{}
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requested = append(requested, r.URL.EscapedPath()+"?"+r.URL.RawQuery)
+
+		if r.URL.Path != "/urls/https://phish.example/login?x=1" {
+			http.NotFound(w, r)
+			return
+		}
+
+		json.NewEncoder(w).Encode(fishfish.URL{URL: "https://phish.example/login?x=1", Category: fishfish.CategoryPhishing})
+	}))
+	t.Cleanup(api.Close)
+
+	client, err := fishfish.NewRawWithAPIURL(api.URL, "", []fishfish.APIPermission{})
+	mustPanic(err)
+
+	// The url is sent as one path segment, its slashes and query kept intact
+	if verdict := client.Check(context.Background(), "https://phish.example/login?x=1"); !verdict.Malicious() || verdict.MatchType != fishfish.MatchTypeExact {
+		panic(fmt.Errorf("expected the listed url to match, got %+v", verdict))
+	}
+
+	if len(requested) != 1 || requested[0] != "/urls/https:%2F%2Fphish.example%2Flogin%3Fx=1?" {
+		panic(fmt.Errorf("unexpected requests %v", requested))
+	}
+}
@@ -0,0 +1,164 @@
+// Command fishfish-server keeps one synced cache of FishFish data and answers lookups over HTTP,
+// so services in any language can share it instead of each syncing their own.
+//
+// Credentials are read from FISHFISH_API_KEY and FISHFISH_API_URL. See fishfish.NewHandler for the endpoints.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/existagon/fishfish-go"
+)
+
+// How long to wait before retrying a failed initial sync while serving from a snapshot
+const syncRetryDelay = time.Minute
+
+func main() {
+	addr := flag.String("addr", "127.0.0.1:8080", "address to listen on")
+	maxBatch := flag.Int("max-batch", 1000, "maximum number of inputs of a batch check")
+	maxSyncAge := flag.Duration("max-sync-age", 0, "report unhealthy if the last sync is older than this, 0 disables it")
+	overridesPath := flag.String("overrides", "", "path of a local overrides file")
+	snapshotPath := flag.String("snapshot", "", "serve from this snapshot until the first sync finishes, and save it on shutdown unless -filter is set")
+	filter := flag.Bool("filter", false, "keep phishing and malware domains in a compact filter instead of in full")
+	flag.Parse()
+
+	options := fishfish.AutoSyncOptions{
+		APIURL: os.Getenv("FISHFISH_API_URL"),
+		OnError: func(err error) {
+			log.Printf("sync error: %s", err)
+		},
+	}
+
+	if *filter {
+		options.Storage = fishfish.StorageModeFilter
+	}
+
+	if *overridesPath != "" {
+		overrides, err := fishfish.LoadOverridesFile(*overridesPath)
+
+		if err != nil {
+			log.Fatalf("failed to load overrides: %s", err)
+		}
+
+		options.Overrides = overrides
+	}
+
+	client, err := fishfish.NewAutoSyncWithOptions(os.Getenv("FISHFISH_API_KEY"), []fishfish.APIPermission{}, options)
+
+	if err != nil {
+		log.Fatalf("failed to create client: %s", err)
+	}
+
+	if *snapshotPath != "" {
+		if snapshot, err := fishfish.LoadSnapshotFile(*snapshotPath); err == nil {
+			if err := client.LoadSnapshot(*snapshot); err != nil {
+				log.Fatal(err)
+			}
+
+			log.Printf("loaded %d domains and %d urls from the snapshot", len(snapshot.Domains), len(snapshot.URLs))
+		} else if !errors.Is(err, os.ErrNotExist) {
+			log.Fatalf("failed to load snapshot: %s", err)
+		}
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	server := &http.Server{
+		Addr:              *addr,
+		Handler:           fishfish.NewHandler(client, fishfish.HandlerOptions{MaxBatchSize: *maxBatch, MaxSyncAge: *maxSyncAge}),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	synced := make(chan error, 1)
+	go func() {
+		for {
+			err := client.Run(ctx)
+
+			if ctx.Err() != nil {
+				synced <- nil
+				return
+			}
+
+			// Without a snapshot there is nothing to serve until the API is reachable
+			if err == nil || client.Status().SnapshotGenerated.IsZero() {
+				synced <- err
+				return
+			}
+
+			log.Printf("failed to sync, serving from the snapshot and retrying in %s: %s", syncRetryDelay, err)
+
+			select {
+			case <-time.After(syncRetryDelay):
+			case <-ctx.Done():
+				synced <- nil
+				return
+			}
+		}
+	}()
+
+	served := make(chan error, 1)
+	go func() {
+		log.Printf("listening on %s", *addr)
+		served <- server.ListenAndServe()
+	}()
+
+	var syncErr, serveErr error
+	syncDone := false
+
+	select {
+	case syncErr = <-synced:
+		syncDone = true
+	case serveErr = <-served:
+		log.Printf("failed to serve: %s", serveErr)
+	case <-ctx.Done():
+	}
+
+	stop()
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		log.Printf("failed to shut down: %s", err)
+	}
+
+	// Only save data that reflects the API, not the snapshot that was loaded
+	select {
+	case <-client.Ready():
+		if *snapshotPath == "" {
+			break
+		}
+
+		// Filter storage doesn't keep the entries, so saving would replace the snapshot with an empty one
+		if *filter {
+			log.Printf("not saving the snapshot in filter storage mode")
+			break
+		}
+
+		if err := client.Snapshot().Save(*snapshotPath); err != nil {
+			log.Printf("failed to save snapshot: %s", err)
+		}
+	default:
+	}
+
+	if !syncDone {
+		syncErr = <-synced
+	}
+
+	if syncErr != nil {
+		log.Printf("failed to sync: %s", syncErr)
+	}
+
+	if syncErr != nil || serveErr != nil {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,239 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/existagon/fishfish-go"
+)
+
+func parsePermissions(value string) []fishfish.APIPermission {
+	permissions := []fishfish.APIPermission{}
+
+	for _, permission := range splitList(value) {
+		permissions = append(permissions, fishfish.APIPermission(permission))
+	}
+
+	return permissions
+}
+
+// Parse the ids of a user and optionally a token from the arguments
+func parseIDs(args []string, count int) ([]int64, error) {
+	if len(args) != count {
+		return nil, errUsage
+	}
+
+	ids := make([]int64, 0, count)
+
+	for _, arg := range args {
+		id, err := strconv.ParseInt(arg, 10, 64)
+
+		if err != nil {
+			return nil, fmt.Errorf("invalid id %q", arg)
+		}
+
+		ids = append(ids, id)
+	}
+
+	return ids, nil
+}
+
+func runToken(ctx context.Context, c *cli, args []string) error {
+	if len(args) == 0 {
+		return errUsage
+	}
+
+	flags := newFlagSet("token "+args[0], c.stderr)
+	permissions := flags.String("permissions", "", "comma separated permissions: domains, urls, admin")
+
+	if err := flags.Parse(args[1:]); err != nil {
+		return errUsage
+	}
+
+	if args[0] == "session" {
+		if flags.NArg() != 0 {
+			return errUsage
+		}
+
+		if c.config.Token == "" {
+			return errNoToken
+		}
+
+		// Creating the client creates a session token for the requested permissions
+		client, err := fishfish.NewRawWithAPIURL(c.config.APIURL, c.config.Token, parsePermissions(*permissions))
+
+		if err != nil {
+			return err
+		}
+
+		token := client.GetSessionToken()
+
+		return c.print(token, func(w io.Writer) {
+			fmt.Fprintln(w, "TOKEN\tEXPIRES")
+			fmt.Fprintf(w, "%s\t%s\n", token.Token, formatUnix(token.Expires))
+		})
+	}
+
+	client, err := c.raw(fishfish.APIPermissionAdmin)
+
+	if err != nil {
+		return err
+	}
+
+	switch args[0] {
+	case "get":
+		ids, err := parseIDs(flags.Args(), 2)
+
+		if err != nil {
+			return err
+		}
+
+		token, err := client.GetMainToken(ids[0], ids[1])
+
+		if err != nil {
+			return err
+		}
+
+		return c.print(token, func(w io.Writer) {
+			fmt.Fprintln(w, "ID\tPERMISSIONS")
+			fmt.Fprintf(w, "%d\t%s\n", token.ID, joinPermissions(token.Permissions))
+		})
+	case "create":
+		ids, err := parseIDs(flags.Args(), 1)
+
+		if err != nil {
+			return err
+		}
+
+		token, err := client.CreateMainToken(ids[0], fishfish.CreateMainTokenRequest{Permissions: parsePermissions(*permissions)})
+
+		if err != nil {
+			return err
+		}
+
+		return c.print(token, func(w io.Writer) {
+			fmt.Fprintln(w, "ID\tTOKEN\tEXPIRES")
+			fmt.Fprintf(w, "%d\t%s\t%s\n", token.ID, token.Token, formatUnix(token.Expires))
+		})
+	case "delete":
+		ids, err := parseIDs(flags.Args(), 2)
+
+		if err != nil {
+			return err
+		}
+
+		if err := client.DeleteMainToken(ids[0], ids[1]); err != nil {
+			return err
+		}
+
+		fmt.Fprintf(c.stderr, "deleted token %d of user %d\n", ids[1], ids[0])
+
+		return nil
+	}
+
+	return errUsage
+}
+
+func joinPermissions(permissions []fishfish.APIPermission) string {
+	values := make([]string, 0, len(permissions))
+	for _, permission := range permissions {
+		values = append(values, string(permission))
+	}
+
+	return strings.Join(values, ",")
+}
+
+func runUser(ctx context.Context, c *cli, args []string) error {
+	if len(args) == 0 {
+		return errUsage
+	}
+
+	flags := newFlagSet("user "+args[0], c.stderr)
+	username := flags.String("username", "", "the name of the user")
+	externalID := flags.String("external-id", "", "the id of the user in an external service, e.g. Discord")
+	permissions := flags.String("permissions", "", "comma separated permissions: domains, urls, admin")
+
+	if err := flags.Parse(args[1:]); err != nil {
+		return errUsage
+	}
+
+	client, err := c.raw(fishfish.APIPermissionAdmin)
+
+	if err != nil {
+		return err
+	}
+
+	if args[0] == "create" {
+		if flags.NArg() != 0 || *username == "" {
+			return errUsage
+		}
+
+		user, err := client.CreateUser(fishfish.CreateUserRequest{Username: *username, ExternalServiceID: *externalID})
+
+		if err != nil {
+			return err
+		}
+
+		return c.printUser(user)
+	}
+
+	ids, err := parseIDs(flags.Args(), 1)
+
+	if err != nil {
+		return err
+	}
+
+	switch args[0] {
+	case "get":
+		user, err := client.GetUser(ids[0])
+
+		if err != nil {
+			return err
+		}
+
+		return c.printUser(user)
+	case "update":
+		// The API replaces both fields, so unset flags keep the current values
+		user, err := client.GetUser(ids[0])
+
+		if err != nil {
+			return err
+		}
+
+		update := fishfish.UpdateUserRequest{Username: user.Username, Permissions: user.Permissions}
+		if *username != "" {
+			update.Username = *username
+		}
+		if *permissions != "" {
+			update.Permissions = parsePermissions(*permissions)
+		}
+
+		if err := client.UpdateUser(ids[0], update); err != nil {
+			return err
+		}
+
+		fmt.Fprintf(c.stderr, "updated user %d\n", ids[0])
+
+		return nil
+	case "delete":
+		if err := client.DeleteUser(ids[0]); err != nil {
+			return err
+		}
+
+		fmt.Fprintf(c.stderr, "deleted user %d\n", ids[0])
+
+		return nil
+	}
+
+	return errUsage
+}
+
+func (c *cli) printUser(user *fishfish.User) error {
+	return c.print(user, func(w io.Writer) {
+		fmt.Fprintln(w, "ID\tUSERNAME\tEXTERNAL ID\tPERMISSIONS")
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\n", user.ID, user.Username, user.ExternalServiceID, joinPermissions(user.Permissions))
+	})
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/existagon/fishfish-go"
+)
+
+// The arguments, or every non-empty line of stdin if there are none
+func inputs(args []string, stdin io.Reader) ([]string, error) {
+	if len(args) > 0 {
+		return args, nil
+	}
+
+	lines := []string{}
+	scanner := bufio.NewScanner(stdin)
+
+	for scanner.Scan() {
+		if line := strings.TrimSpace(scanner.Text()); line != "" {
+			lines = append(lines, line)
+		}
+	}
+
+	return lines, scanner.Err()
+}
+
+func runCheck(ctx context.Context, c *cli, args []string) error {
+	flags := newFlagSet("check", c.stderr)
+	snapshotPath := flags.String("snapshot", "", "check against a saved snapshot instead of the API")
+
+	if err := flags.Parse(args); err != nil {
+		return errUsage
+	}
+
+	values, err := inputs(flags.Args(), c.stdin)
+
+	if err != nil {
+		return err
+	}
+
+	var checker fishfish.Checker
+
+	if *snapshotPath != "" {
+		if checker, _, err = loadSnapshot(*snapshotPath); err != nil {
+			return err
+		}
+	} else if checker, err = c.raw(); err != nil {
+		return err
+	}
+
+	return c.printVerdicts(ctx, checker, values)
+}
+
+func (c *cli) printVerdicts(ctx context.Context, checker fishfish.Checker, values []string) error {
+	verdicts := make([]fishfish.Verdict, 0, len(values))
+	for _, value := range values {
+		verdicts = append(verdicts, checker.Check(ctx, value))
+	}
+
+	return c.print(verdicts, func(w io.Writer) {
+		fmt.Fprintln(w, "INPUT\tKIND\tVERDICT\tMATCH\tSOURCE")
+		for _, verdict := range verdicts {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", verdict.Input, verdict.Kind, describeVerdict(verdict), verdict.MatchType, verdict.Source)
+		}
+	})
+}
+
+// A short description of a verdict for tables
+func describeVerdict(verdict fishfish.Verdict) string {
+	switch {
+	case verdict.Error != "":
+		return "error: " + verdict.Error
+	case verdict.Known:
+		return string(verdict.Category)
+	case verdict.Suspicion != nil:
+		return fmt.Sprintf("suspected %s of %s", verdict.Suspicion.Kind, verdict.Suspicion.Of)
+	}
+
+	return "unknown"
+}
+
+func runScan(ctx context.Context, c *cli, args []string) error {
+	flags := newFlagSet("scan", c.stderr)
+	resolve := flags.Bool("resolve", false, "follow redirects of links that aren't listed")
+
+	if err := flags.Parse(args); err != nil {
+		return errUsage
+	}
+
+	text := strings.Join(flags.Args(), " ")
+
+	if flags.NArg() == 0 {
+		data, err := io.ReadAll(c.stdin)
+
+		if err != nil {
+			return err
+		}
+
+		text = string(data)
+	}
+
+	client, err := c.raw()
+
+	if err != nil {
+		return err
+	}
+
+	scanner := fishfish.NewScanner(client)
+	scanner.DefangOutput = true
+
+	if *resolve {
+		scanner.Resolver = fishfish.NewRedirectResolver(client)
+	}
+
+	findings := scanner.Scan(ctx, text)
+
+	return c.print(findings, func(w io.Writer) {
+		fmt.Fprintln(w, "LINK\tVERDICT\tREDIRECTS TO")
+		for _, finding := range findings {
+			final := ""
+			if finding.Redirects != nil && len(finding.Redirects.Hops) > 1 {
+				final = fishfish.Defang(finding.Redirects.Final())
+			}
+
+			fmt.Fprintf(w, "%s\t%s\t%s\n", finding.Defanged, describeVerdict(finding.Verdict), final)
+		}
+	})
+}
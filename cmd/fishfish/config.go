@@ -0,0 +1,126 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"text/tabwriter"
+
+	"github.com/existagon/fishfish-go"
+)
+
+// Settings read from the config file, the environment takes precedence
+type config struct {
+	// A main token, FISHFISH_API_KEY
+	Token string `json:"token,omitempty"`
+	// FISHFISH_API_URL, defaults to the official API
+	APIURL string `json:"api_url,omitempty"`
+}
+
+// Load the config file and apply the environment
+// A missing file is only an error if its path was given explicitly.
+func loadConfig(path string, getenv func(string) string) (config, error) {
+	conf := config{}
+	explicit := path != ""
+
+	if !explicit {
+		if dir, err := os.UserConfigDir(); err == nil {
+			path = filepath.Join(dir, "fishfish", "config.json")
+		}
+	}
+
+	if path != "" {
+		data, err := os.ReadFile(path)
+
+		if err != nil && (explicit || !errors.Is(err, os.ErrNotExist)) {
+			return conf, err
+		}
+
+		if err == nil {
+			if err := json.Unmarshal(data, &conf); err != nil {
+				return conf, fmt.Errorf("failed to parse config %s: %s", path, err)
+			}
+		}
+	}
+
+	if token := getenv("FISHFISH_API_KEY"); token != "" {
+		conf.Token = token
+	}
+	if apiURL := getenv("FISHFISH_API_URL"); apiURL != "" {
+		conf.APIURL = apiURL
+	}
+	if conf.APIURL == "" {
+		conf.APIURL = "https://api.fishfish.gg/v1"
+	}
+
+	return conf, nil
+}
+
+type cli struct {
+	config config
+	json   bool
+	stdin  io.Reader
+	stdout io.Writer
+	stderr io.Writer
+}
+
+var errNoToken = errors.New("a token is required, set FISHFISH_API_KEY or token in the config file")
+
+// Create an API client with a session token for the specified permissions
+func (c *cli) raw(permissions ...fishfish.APIPermission) (*fishfish.RawClient, error) {
+	if len(permissions) > 0 && c.config.Token == "" {
+		return nil, errNoToken
+	}
+
+	return fishfish.NewRawWithAPIURL(c.config.APIURL, c.config.Token, permissions)
+}
+
+// Create an AutoSync client holding every domain and url, without keeping it in sync
+// Without a token, only the name and category of each entry are available.
+func (c *cli) synced(permissions ...fishfish.APIPermission) (*fishfish.AutoSyncClient, error) {
+	if len(permissions) > 0 && c.config.Token == "" {
+		return nil, errNoToken
+	}
+
+	client, err := fishfish.NewAutoSyncWithOptions(c.config.Token, permissions, fishfish.AutoSyncOptions{APIURL: c.config.APIURL, DisableHeuristics: true})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return client, client.ForceSync()
+}
+
+// Create an AutoSync client from a saved snapshot, without using the API
+func loadSnapshot(path string) (*fishfish.AutoSyncClient, *fishfish.Snapshot, error) {
+	snapshot, err := fishfish.LoadSnapshotFile(path)
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	client, err := fishfish.NewAutoSyncWithOptions("", []fishfish.APIPermission{}, fishfish.AutoSyncOptions{DisableStream: true})
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return client, snapshot, client.LoadSnapshot(*snapshot)
+}
+
+// Print value as JSON, or as a table written by table
+func (c *cli) print(value any, table func(w io.Writer)) error {
+	if c.json {
+		encoder := json.NewEncoder(c.stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(value)
+	}
+
+	w := tabwriter.NewWriter(c.stdout, 0, 4, 2, ' ', 0)
+	table(w)
+
+	return w.Flush()
+}
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/existagon/fishfish-go"
+)
+
+// Flags shared by adding and updating domains and urls
+type entryFlags struct {
+	category    *string
+	description *string
+	target      *string
+}
+
+// Parse the flags of a domain or url subcommand, which takes exactly one name
+func parseEntryArgs(name string, c *cli, args []string) (entryFlags, string, error) {
+	flags := newFlagSet(name, c.stderr)
+	entry := entryFlags{
+		category:    flags.String("category", "", "safe, phishing or malware"),
+		description: flags.String("description", "", "why the entry is listed"),
+		target:      flags.String("target", "", "the brand or service the entry imitates"),
+	}
+
+	if err := flags.Parse(args); err != nil || flags.NArg() != 1 {
+		return entry, "", errUsage
+	}
+
+	// Indicators are often pasted defanged
+	return entry, fishfish.Refang(flags.Arg(0)), nil
+}
+
+func formatUnix(seconds int64) string {
+	if seconds == 0 {
+		return ""
+	}
+
+	return time.Unix(seconds, 0).UTC().Format(time.RFC3339)
+}
+
+func runDomain(ctx context.Context, c *cli, args []string) error {
+	if len(args) == 0 {
+		return errUsage
+	}
+
+	entry, name, err := parseEntryArgs("domain "+args[0], c, args[1:])
+
+	if err != nil {
+		return err
+	}
+
+	if args[0] == "add" && *entry.category == "" {
+		return errUsage
+	}
+
+	if args[0] == "get" {
+		client, err := c.raw()
+
+		if err != nil {
+			return err
+		}
+
+		domain, err := client.GetDomain(name)
+
+		if err != nil {
+			return err
+		}
+
+		return c.printDomains([]fishfish.Domain{*domain})
+	}
+
+	client, err := c.raw(fishfish.APIPermissionDomains)
+
+	if err != nil {
+		return err
+	}
+
+	var domain *fishfish.Domain
+
+	switch args[0] {
+	case "add":
+		domain, err = client.AddDomain(name, fishfish.CreateDomainRequest{
+			Category: fishfish.Category(*entry.category), Description: *entry.description, Target: *entry.target,
+		})
+	case "update":
+		domain, err = client.UpdateDomain(name, fishfish.UpdateDomainRequest{
+			Category: fishfish.Category(*entry.category), Description: *entry.description, Target: *entry.target,
+		})
+	case "delete":
+		if err := client.DeleteDomain(name); err != nil {
+			return err
+		}
+
+		fmt.Fprintf(c.stderr, "deleted domain %s\n", name)
+		return nil
+	default:
+		return errUsage
+	}
+
+	if err != nil {
+		return err
+	}
+
+	return c.printDomains([]fishfish.Domain{*domain})
+}
+
+func runURL(ctx context.Context, c *cli, args []string) error {
+	if len(args) == 0 {
+		return errUsage
+	}
+
+	entry, name, err := parseEntryArgs("url "+args[0], c, args[1:])
+
+	if err != nil {
+		return err
+	}
+
+	if args[0] == "add" && *entry.category == "" {
+		return errUsage
+	}
+
+	if args[0] == "get" {
+		client, err := c.raw()
+
+		if err != nil {
+			return err
+		}
+
+		url, err := client.GetURL(name)
+
+		if err != nil {
+			return err
+		}
+
+		return c.printURLs([]fishfish.URL{*url})
+	}
+
+	client, err := c.raw(fishfish.APIPermissionURLs)
+
+	if err != nil {
+		return err
+	}
+
+	switch args[0] {
+	case "add":
+		url, err := client.AddURL(name, fishfish.CreateURLRequest{
+			Category: fishfish.Category(*entry.category), Description: *entry.description, Target: *entry.target,
+		})
+
+		if err != nil {
+			return err
+		}
+
+		return c.printURLs([]fishfish.URL{*url})
+	case "update":
+		err = client.UpdateURL(name, fishfish.UpdateURLRequest{
+			Category: fishfish.Category(*entry.category), Description: *entry.description, Target: *entry.target,
+		})
+	case "delete":
+		err = client.DeleteURL(name)
+	default:
+		return errUsage
+	}
+
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(c.stderr, "%sd url %s\n", args[0], name)
+
+	return nil
+}
+
+func (c *cli) printDomains(domains []fishfish.Domain) error {
+	return c.print(domains, func(w io.Writer) {
+		fmt.Fprintln(w, "DOMAIN\tCATEGORY\tTARGET\tDESCRIPTION\tADDED")
+		for _, domain := range domains {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", domain.Domain, domain.Category, domain.Target, domain.Description, formatUnix(domain.Added))
+		}
+	})
+}
+
+func (c *cli) printURLs(urls []fishfish.URL) error {
+	return c.print(urls, func(w io.Writer) {
+		fmt.Fprintln(w, "URL\tCATEGORY\tTARGET\tDESCRIPTION\tADDED")
+		for _, url := range urls {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", url.URL, url.Category, url.Target, url.Description, formatUnix(url.Added))
+		}
+	})
+}
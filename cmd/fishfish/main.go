@@ -0,0 +1,130 @@
+// Command fishfish looks up, checks and manages FishFish domains and urls
+//
+// Credentials are read from FISHFISH_API_KEY and FISHFISH_API_URL, or from the config file
+// at $XDG_CONFIG_HOME/fishfish/config.json. Run fishfish help for the list of commands.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"syscall"
+)
+
+type command struct {
+	usage       string
+	description string
+	run         func(ctx context.Context, c *cli, args []string) error
+}
+
+// Commands with subcommands dispatch on their first argument themselves
+var commands = map[string]command{
+	"check":     {"check [-snapshot path] [input ...]", "Check domains, urls or hosts, read from stdin if none are given", runCheck},
+	"scan":      {"scan [-resolve] [text ...]", "Find and check every link in text, read from stdin if none is given", runScan},
+	"domain":    {"domain get|add|update|delete [flags] name", "Manage a domain", runDomain},
+	"url":       {"url get|add|update|delete [flags] url", "Manage a url", runURL},
+	"token":     {"token session|get|create|delete [flags] [user] [token]", "Create session tokens and manage main tokens", runToken},
+	"user":      {"user get|create|update|delete [flags] [id]", "Manage users", runUser},
+	"watch":     {"watch", "Print events from the stream as they happen", runWatch},
+	"dump":      {"dump [-category category]", "Print every domain and url", runDump},
+	"export":    {"export [-format format] [-snapshot path] [-o path]", "Write a blocklist, STIX bundle or MISP event", runExport},
+	"snapshot":  {"snapshot save|load path [input ...]", "Save every domain and url to a file, or check inputs against a saved file", runSnapshot},
+	"import":    {"import [-format format] [-apply] path", "Plan adding entries from a file, and submit them with -apply", runImport},
+	"reconcile": {"reconcile [-apply] [-full] path", "Plan reaching a desired state file, and apply it with -apply", runReconcile},
+}
+
+// Returned by commands when their arguments are invalid, so usage is printed
+var errUsage = errors.New("invalid usage")
+
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	os.Exit(run(ctx, os.Args[1:], os.Stdin, os.Stdout, os.Stderr, os.Getenv))
+}
+
+// Run the command line, returning the exit code
+func run(ctx context.Context, args []string, stdin io.Reader, stdout, stderr io.Writer, getenv func(string) string) int {
+	flags := flag.NewFlagSet("fishfish", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	configPath := flags.String("config", "", "path of the config file")
+	jsonOutput := flags.Bool("json", false, "print JSON instead of tables")
+	flags.Usage = func() { printUsage(stderr) }
+
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	if flags.NArg() == 0 || flags.Arg(0) == "help" {
+		printUsage(stderr)
+		return 2
+	}
+
+	cmd, ok := commands[flags.Arg(0)]
+
+	if !ok {
+		fmt.Fprintf(stderr, "fishfish: unknown command %s\n", flags.Arg(0))
+		printUsage(stderr)
+		return 2
+	}
+
+	config, err := loadConfig(*configPath, getenv)
+
+	if err != nil {
+		fmt.Fprintf(stderr, "fishfish: %s\n", err)
+		return 1
+	}
+
+	c := &cli{config: config, json: *jsonOutput, stdin: stdin, stdout: stdout, stderr: stderr}
+
+	if err := cmd.run(ctx, c, flags.Args()[1:]); errors.Is(err, errUsage) || errors.Is(err, flag.ErrHelp) {
+		fmt.Fprintf(stderr, "usage: fishfish %s\n", cmd.usage)
+		return 2
+	} else if err != nil {
+		fmt.Fprintf(stderr, "fishfish: %s\n", err)
+		return 1
+	}
+
+	return 0
+}
+
+func printUsage(w io.Writer) {
+	fmt.Fprintln(w, "usage: fishfish [-config path] [-json] command [arguments]")
+	fmt.Fprintln(w, "\ncommands:")
+
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		fmt.Fprintf(w, "  %-10s %s\n", name, commands[name].description)
+	}
+}
+
+// A flag set for a command, which prints its usage through run instead of the flag package
+func newFlagSet(name string, stderr io.Writer) *flag.FlagSet {
+	flags := flag.NewFlagSet(name, flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	return flags
+}
+
+// Split a comma separated flag value, ignoring empty values
+func splitList(value string) []string {
+	values := []string{}
+
+	for _, v := range strings.Split(value, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			values = append(values, v)
+		}
+	}
+
+	return values
+}
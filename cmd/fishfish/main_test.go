@@ -0,0 +1,110 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/existagon/fishfish-go"
+)
+
+// Serve the public endpoints of the API with one phishing domain and one malware url
+func newTestAPI(t *testing.T) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body any
+
+		switch {
+		case r.URL.Path == "/domains" && r.URL.Query().Get("category") == fishfish.CategoryPhishing:
+			body = []string{"phish.example"}
+		case r.URL.Path == "/urls" && r.URL.Query().Get("category") == fishfish.CategoryMalware:
+			body = []string{"https://sites.example/dropper"}
+		case r.URL.Path == "/domains" || r.URL.Path == "/urls":
+			body = []string{}
+		case r.URL.Path == "/domains/phish.example":
+			body = fishfish.Domain{Domain: "phish.example", Category: fishfish.CategoryPhishing, Description: "steam phishing"}
+		}
+
+		if body == nil {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		json.NewEncoder(w).Encode(body)
+	}))
+
+	t.Cleanup(server.Close)
+
+	return server
+}
+
+func runTest(t *testing.T, server *httptest.Server, stdin string, args ...string) (string, string, int) {
+	stdout, stderr := &bytes.Buffer{}, &bytes.Buffer{}
+	env := map[string]string{"FISHFISH_API_URL": server.URL}
+
+	code := run(context.Background(), args, strings.NewReader(stdin), stdout, stderr, func(name string) string { return env[name] })
+
+	return stdout.String(), stderr.String(), code
+}
+
+func TestCLI(t *testing.T) {
+	server := newTestAPI(t)
+
+	// An explicit config path must exist
+	configPath := filepath.Join(t.TempDir(), "config.json")
+	mustPanic(os.WriteFile(configPath, []byte(`{"api_url": "http://127.0.0.1:1"}`), 0644))
+
+	if _, stderr, code := runTest(t, server, "", "-config", filepath.Join(t.TempDir(), "missing.json"), "dump"); code != 1 || !strings.Contains(stderr, "missing.json") {
+		panic(fmt.Errorf("expected a missing config error, got %d: %s", code, stderr))
+	}
+
+	// The environment takes precedence over the config file
+	if _, stderr, code := runTest(t, server, "", "-config", configPath, "dump"); code != 0 {
+		panic(fmt.Errorf("expected the api url from the environment, got %d: %s", code, stderr))
+	}
+
+	snapshotPath := filepath.Join(t.TempDir(), "snapshot.json")
+
+	tests := []struct {
+		args     []string
+		stdin    string
+		code     int
+		contains []string
+	}{
+		{[]string{"domain", "get", "phish.example"}, "", 0, []string{"phish.example", "phishing", "steam phishing"}},
+		{[]string{"check"}, "phish.example\nsub.phish.example\nok.example\n", 0, []string{"sub.phish.example  domain  phishing", "ok.example", "unknown"}},
+		{[]string{"snapshot", "save", snapshotPath}, "", 0, nil},
+		{[]string{"snapshot", "load", snapshotPath, "https://sites.example/dropper/x"}, "", 0, []string{"malware", "cache"}},
+		{[]string{"export", "-format", "dnsmasq", "-snapshot", snapshotPath}, "", 0, []string{"address=/phish.example/0.0.0.0"}},
+		{[]string{"-json", "dump", "-category", "malware"}, "", 0, []string{`"url": "https://sites.example/dropper"`}},
+		{[]string{"domain", "add", "new.example"}, "", 2, nil},
+		{[]string{"user", "get", "1"}, "", 1, nil},
+		{[]string{"nope"}, "", 2, nil},
+	}
+
+	for _, test := range tests {
+		stdout, stderr, code := runTest(t, server, test.stdin, append([]string{}, test.args...)...)
+
+		if code != test.code {
+			panic(fmt.Errorf("%v: expected exit code %d, got %d: %s", test.args, test.code, code, stderr))
+		}
+
+		for _, expected := range test.contains {
+			if !strings.Contains(stdout, expected) {
+				panic(fmt.Errorf("%v: expected output to contain %q, got:\n%s", test.args, expected, stdout))
+			}
+		}
+	}
+}
+
+func mustPanic(err error) {
+	if err != nil {
+		panic(err)
+	}
+}
@@ -0,0 +1,377 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/existagon/fishfish-go"
+)
+
+// The name of the entry an event is about and its category, if the event has one
+func describeEvent(event fishfish.WSEvent) (string, fishfish.Category) {
+	data, err := json.Marshal(event.Data)
+
+	if err != nil {
+		return "", ""
+	}
+
+	fields := struct {
+		Domain   string            `json:"domain"`
+		URL      string            `json:"url"`
+		Category fishfish.Category `json:"category"`
+	}{}
+
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return "", ""
+	}
+
+	if fields.URL != "" {
+		return fields.URL, fields.Category
+	}
+
+	return fields.Domain, fields.Category
+}
+
+func runWatch(ctx context.Context, c *cli, args []string) error {
+	if len(args) != 0 {
+		return errUsage
+	}
+
+	if c.config.Token == "" {
+		return errNoToken
+	}
+
+	client, err := c.raw()
+
+	if err != nil {
+		return err
+	}
+
+	ch := make(chan fishfish.WSEvent)
+	errs := make(chan error, 1)
+
+	go func() {
+		errs <- client.ConnectWS(ctx, ch)
+	}()
+
+	// Events are printed as they arrive, so JSON is written one object per line
+	encoder := json.NewEncoder(c.stdout)
+
+	for {
+		select {
+		case event := <-ch:
+			if c.json {
+				if err := encoder.Encode(event); err != nil {
+					return err
+				}
+				continue
+			}
+
+			name, category := describeEvent(event)
+			fmt.Fprintf(c.stdout, "%s  %-14s %s %s\n", time.Now().UTC().Format(time.RFC3339), event.Type, name, category)
+		case err := <-errs:
+			if ctx.Err() != nil {
+				return nil
+			}
+
+			return err
+		}
+	}
+}
+
+func runDump(ctx context.Context, c *cli, args []string) error {
+	flags := newFlagSet("dump", c.stderr)
+	category := flags.String("category", "", "only print entries of this category")
+
+	if err := flags.Parse(args); err != nil || flags.NArg() != 0 {
+		return errUsage
+	}
+
+	client, err := c.synced()
+
+	if err != nil {
+		return err
+	}
+
+	snapshot := client.Snapshot()
+
+	if *category != "" {
+		domains := []fishfish.Domain{}
+		for _, domain := range snapshot.Domains {
+			if string(domain.Category) == *category {
+				domains = append(domains, domain)
+			}
+		}
+
+		urls := []fishfish.URL{}
+		for _, url := range snapshot.URLs {
+			if string(url.Category) == *category {
+				urls = append(urls, url)
+			}
+		}
+
+		snapshot.Domains, snapshot.URLs = domains, urls
+	}
+
+	return c.print(snapshot, func(w io.Writer) {
+		fmt.Fprintln(w, "KIND\tNAME\tCATEGORY\tTARGET\tDESCRIPTION")
+		for _, domain := range snapshot.Domains {
+			fmt.Fprintf(w, "domain\t%s\t%s\t%s\t%s\n", domain.Domain, domain.Category, domain.Target, domain.Description)
+		}
+		for _, url := range snapshot.URLs {
+			fmt.Fprintf(w, "url\t%s\t%s\t%s\t%s\n", url.URL, url.Category, url.Target, url.Description)
+		}
+	})
+}
+
+func runExport(ctx context.Context, c *cli, args []string) error {
+	flags := newFlagSet("export", c.stderr)
+	format := flags.String("format", fishfish.ExportFormatHosts, "hosts, dnsmasq, unbound, rpz, adblock, pac, chrome, stix or misp")
+	categories := flags.String("categories", "", "comma separated categories, defaults to phishing and malware")
+	includeURLs := flags.Bool("urls", false, "also export urls, for formats that can express them")
+	snapshotPath := flags.String("snapshot", "", "export a saved snapshot instead of fetching from the API")
+	output := flags.String("o", "", "write to a file instead of stdout")
+
+	if err := flags.Parse(args); err != nil || flags.NArg() != 0 {
+		return errUsage
+	}
+
+	var client *fishfish.AutoSyncClient
+	var err error
+
+	if *snapshotPath != "" {
+		client, _, err = loadSnapshot(*snapshotPath)
+	} else {
+		client, err = c.synced()
+	}
+
+	if err != nil {
+		return err
+	}
+
+	selected := []fishfish.Category{}
+	for _, category := range splitList(*categories) {
+		selected = append(selected, fishfish.Category(category))
+	}
+
+	w := c.stdout
+
+	if *output != "" {
+		file, err := os.Create(*output)
+
+		if err != nil {
+			return err
+		}
+
+		defer file.Close()
+		w = file
+	}
+
+	out := bufio.NewWriter(w)
+	encoder := json.NewEncoder(out)
+	encoder.SetIndent("", "  ")
+
+	switch *format {
+	case "stix":
+		err = encoder.Encode(client.ExportSTIX(fishfish.ThreatIntelOptions{Categories: selected}))
+	case "misp":
+		err = encoder.Encode(client.ExportMISP(fishfish.ThreatIntelOptions{Categories: selected}))
+	default:
+		err = client.Export(out, fishfish.ExportOptions{
+			Format:      fishfish.ExportFormat(*format),
+			Categories:  selected,
+			IncludeURLs: *includeURLs,
+			Generated:   time.Now(),
+		})
+	}
+
+	if err != nil {
+		return err
+	}
+
+	return out.Flush()
+}
+
+func runSnapshot(ctx context.Context, c *cli, args []string) error {
+	if len(args) < 2 {
+		return errUsage
+	}
+
+	switch args[0] {
+	case "save":
+		if len(args) != 2 {
+			return errUsage
+		}
+
+		client, err := c.synced()
+
+		if err != nil {
+			return err
+		}
+
+		snapshot := client.Snapshot()
+
+		if err := snapshot.Save(args[1]); err != nil {
+			return err
+		}
+
+		fmt.Fprintf(c.stderr, "saved %d domains and %d urls to %s\n", len(snapshot.Domains), len(snapshot.URLs), args[1])
+
+		return nil
+	case "load":
+		client, snapshot, err := loadSnapshot(args[1])
+
+		if err != nil {
+			return err
+		}
+
+		fmt.Fprintf(c.stderr, "loaded %d domains and %d urls from %s\n", len(snapshot.Domains), len(snapshot.URLs), snapshot.Generated.Format(time.RFC3339))
+
+		if len(args) == 2 {
+			return nil
+		}
+
+		return c.printVerdicts(ctx, client, args[2:])
+	}
+
+	return errUsage
+}
+
+func runImport(ctx context.Context, c *cli, args []string) error {
+	flags := newFlagSet("import", c.stderr)
+	format := flags.String("format", fishfish.ImportFormatList, "list, csv, phishtank or openphish")
+	category := flags.String("category", "", "the category of entries that don't specify one, defaults to phishing")
+	description := flags.String("description", "", "the description of entries that don't specify one")
+	urlsAsDomains := flags.Bool("urls-as-domains", false, "import the host of each url as a domain")
+	apply := flags.Bool("apply", false, "submit the new entries instead of only printing the plan")
+
+	if err := flags.Parse(args); err != nil || flags.NArg() != 1 {
+		return errUsage
+	}
+
+	file, err := os.Open(flags.Arg(0))
+
+	if err != nil {
+		return err
+	}
+
+	defer file.Close()
+
+	entries, invalid, err := fishfish.ParseImport(file, fishfish.ImportOptions{
+		Format:        fishfish.ImportFormat(*format),
+		Category:      fishfish.Category(*category),
+		Description:   *description,
+		URLsAsDomains: *urlsAsDomains,
+	})
+
+	if err != nil {
+		return err
+	}
+
+	client, err := c.synced()
+
+	if err != nil {
+		return err
+	}
+
+	plan := client.PlanImport(entries, invalid)
+
+	if !*apply {
+		return c.print(plan, func(w io.Writer) { fmt.Fprint(w, plan.Diff()) })
+	}
+
+	raw, err := c.raw(fishfish.APIPermissionDomains, fishfish.APIPermissionURLs)
+
+	if err != nil {
+		return err
+	}
+
+	return c.printResults(plan.Submit(raw))
+}
+
+func runReconcile(ctx context.Context, c *cli, args []string) error {
+	flags := newFlagSet("reconcile", c.stderr)
+	apply := flags.Bool("apply", false, "apply the plan instead of only printing it")
+	fullFetch := flags.Bool("full", false, "fetch every entry at once instead of looking up each one")
+
+	if err := flags.Parse(args); err != nil || flags.NArg() != 1 {
+		return errUsage
+	}
+
+	desired, err := fishfish.LoadDesiredStateFile(flags.Arg(0))
+
+	if err != nil {
+		return err
+	}
+
+	var client *fishfish.RawClient
+
+	if *apply || *fullFetch {
+		client, err = c.raw(fishfish.APIPermissionDomains, fishfish.APIPermissionURLs)
+	} else {
+		client, err = c.raw()
+	}
+
+	if err != nil {
+		return err
+	}
+
+	plan, reconcileErr := client.Reconcile(ctx, *desired, fishfish.ReconcileOptions{DryRun: !*apply, FullFetch: *fullFetch})
+
+	if plan == nil {
+		return reconcileErr
+	}
+
+	if err := c.print(plan, func(w io.Writer) { fmt.Fprint(w, plan.String()) }); err != nil {
+		return err
+	}
+
+	if *apply && !c.json {
+		if err := c.printResults(plan.Results); err != nil {
+			return err
+		}
+	}
+
+	return reconcileErr
+}
+
+// Print the outcome of each submitted entry, returning an error if any failed
+func (c *cli) printResults(results []fishfish.BulkResult) error {
+	failed := 0
+
+	type result struct {
+		Name  string `json:"name"`
+		Error string `json:"error,omitempty"`
+	}
+
+	values := make([]result, 0, len(results))
+	for _, r := range results {
+		value := result{Name: r.Name}
+		if r.Err != nil {
+			value.Error = r.Err.Error()
+			failed++
+		}
+		values = append(values, value)
+	}
+
+	err := c.print(values, func(w io.Writer) {
+		fmt.Fprintln(w, "NAME\tRESULT")
+		for _, value := range values {
+			if value.Error == "" {
+				value.Error = "ok"
+			}
+			fmt.Fprintf(w, "%s\t%s\n", value.Name, value.Error)
+		}
+	})
+
+	if err == nil && failed > 0 {
+		return fmt.Errorf("%d of %d entries failed", failed, len(results))
+	}
+
+	return err
+}
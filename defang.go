@@ -0,0 +1,81 @@
+package fishfish
+
+import (
+	"regexp"
+	"strings"
+)
+
+// Separators written in brackets so indicators aren't clickable, e.g. evil[.]com or evil(dot)com
+var defangedSeparators = regexp.MustCompile(`(?i)\[\.\]|\(\.\)|\{\.\}|\[dot\]|\(dot\)|\{dot\}|\\\.` +
+	`|\[:\]|\[://\]|\[/\]|\[at\]|\(at\)|\[@\]`)
+
+// Schemes with letters replaced so indicators aren't clickable, e.g. hxxps:// or fxp://
+var defangedSchemes = regexp.MustCompile(`(?i)\b(h(?:xx|\*\*|tt)p(s?)|fxp)(\[:\]//|\[://\]|://)`)
+
+// Turn a defanged indicator such as hxxps://evil[.]com back into one that can be looked up
+// Text that isn't defanged is returned unchanged.
+func Refang(s string) string {
+	if !strings.ContainsAny(s, "[({\\*") && !strings.Contains(strings.ToLower(s), "xx") && !strings.Contains(strings.ToLower(s), "fxp") {
+		// Nothing to refang, skip the regular expressions
+		return s
+	}
+
+	s = defangedSchemes.ReplaceAllStringFunc(s, func(match string) string {
+		lower := strings.ToLower(match)
+
+		if strings.HasPrefix(lower, "fxp") {
+			return "ftp://"
+		}
+		if strings.HasPrefix(lower, "https") || strings.HasPrefix(lower, "hxxps") || strings.HasPrefix(lower, "h**ps") {
+			return "https://"
+		}
+
+		return "http://"
+	})
+
+	return defangedSeparators.ReplaceAllStringFunc(s, func(match string) string {
+		switch strings.ToLower(match) {
+		case "[:]":
+			return ":"
+		case "[://]":
+			return "://"
+		case "[/]":
+			return "/"
+		case "[at]", "(at)", "[@]":
+			return "@"
+		default:
+			return "."
+		}
+	})
+}
+
+// Make a domain or url safe to share by breaking its scheme and the dots of its host, e.g. hxxps://evil[.]com/login
+func Defang(s string) string {
+	scheme, rest, hasScheme := strings.Cut(s, "://")
+
+	if !hasScheme {
+		scheme, rest = "", s
+	}
+
+	host, path := rest, ""
+	if i := strings.IndexAny(rest, "/?#"); i >= 0 {
+		host, path = rest[:i], rest[i:]
+	}
+
+	host = strings.ReplaceAll(host, ".", "[.]")
+
+	if !hasScheme {
+		return host + path
+	}
+
+	switch strings.ToLower(scheme) {
+	case "http":
+		scheme = "hxxp"
+	case "https":
+		scheme = "hxxps"
+	case "ftp":
+		scheme = "fxp"
+	}
+
+	return scheme + "://" + host + path
+}
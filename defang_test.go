@@ -0,0 +1,75 @@
+package fishfish_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/existagon/fishfish-go"
+)
+
+func TestRefang(t *testing.T) {
+	tests := map[string]string{
+		"hxxps://evil[.]com/login":     "https://evil.com/login",
+		"hXXp[://]evil(dot)example[/]": "http://evil.example/",
+		"evil{.}example\\.org":         "evil.example.org",
+		"https[:]//evil[dot]com":       "https://evil.com",
+		"fxp://files[.]example":        "ftp://files.example",
+		"admin[at]evil[.]com":          "admin@evil.com",
+		"https://example.com/a(b)":     "https://example.com/a(b)",
+	}
+
+	for defanged, expected := range tests {
+		if refanged := fishfish.Refang(defanged); refanged != expected {
+			panic(fmt.Errorf("%s: expected %s, got %s", defanged, expected, refanged))
+		}
+	}
+
+	if defanged := fishfish.Defang("https://login.evil.com/a.html"); defanged != "hxxps://login[.]evil[.]com/a.html" {
+		panic(fmt.Errorf("unexpected defanged url %s", defanged))
+	}
+}
+
+func TestDefangedLookups(t *testing.T) {
+	client := newTestAutoSync([]fishfish.Domain{
+		{Domain: "evil.com", Category: fishfish.CategoryPhishing},
+	}, nil)
+
+	if verdict := client.Check(context.Background(), "hxxps://login.evil[.]com/"); !verdict.Malicious() {
+		panic(fmt.Errorf("expected defanged url to be malicious, got %+v", verdict))
+	}
+
+	scanner := fishfish.NewScanner(client)
+	scanner.DefangOutput = true
+
+	findings := scanner.Scan(context.Background(), "reported: hxxps://evil[.]com/claim and evil(dot)com")
+
+	if len(findings) != 2 {
+		panic(fmt.Errorf("expected 2 findings, got %v", findings))
+	}
+
+	for _, finding := range findings {
+		if !finding.Verdict.Malicious() || finding.Defanged == "" {
+			panic(fmt.Errorf("unexpected finding %+v", finding))
+		}
+	}
+
+	if findings[0].Link != "https://evil.com/claim" || findings[0].Defanged != "hxxps://evil[.]com/claim" {
+		panic(fmt.Errorf("unexpected link %s (%s)", findings[0].Link, findings[0].Defanged))
+	}
+}
+
+func TestRawClientDoesNotRefang(t *testing.T) {
+	// Only user input is refanged, the raw client looks up the exact name
+	api := newTestAPI(t, []fishfish.Domain{{Domain: "foo_(dot)_bar.example", Category: fishfish.CategorySafe}}, nil)
+
+	client, err := fishfish.NewRawWithAPIURL(api.URL, "", []fishfish.APIPermission{})
+	mustPanic(err)
+
+	domain, err := client.GetDomain("foo_(dot)_bar.example")
+	mustPanic(err)
+
+	if domain.Domain != "foo_(dot)_bar.example" {
+		panic(fmt.Errorf("unexpected domain %+v", domain))
+	}
+}
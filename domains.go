@@ -2,6 +2,7 @@ package fishfish
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -18,8 +19,12 @@ type Domain struct {
 }
 
 func (c *RawClient) GetDomain(domain string) (*Domain, error) {
-	path := fmt.Sprintf("/domains/%s", domain)
-	res, err := c.makeRequest("GET", path, nil, nil, c.defaultAuthType)
+	return c.getDomain(context.Background(), domain)
+}
+
+func (c *RawClient) getDomain(ctx context.Context, domain string) (*Domain, error) {
+	path := fmt.Sprintf("/domains/%s", escapePathSegment(domain))
+	res, err := c.makeRequestContext(ctx, "GET", path, nil, nil, c.defaultAuthType)
 
 	if err != nil {
 		return nil, err
@@ -29,10 +34,14 @@ func (c *RawClient) GetDomain(domain string) (*Domain, error) {
 }
 
 func (c *RawClient) GetDomains(category Category) (*[]string, error) {
+	return c.getDomains(context.Background(), category)
+}
+
+func (c *RawClient) getDomains(ctx context.Context, category Category) (*[]string, error) {
 	query := makeQuery(map[string]string{
 		"category": string(category),
 	})
-	res, err := c.makeRequest("GET", "/domains", query, nil, c.defaultAuthType)
+	res, err := c.makeRequestContext(ctx, "GET", "/domains", query, nil, c.defaultAuthType)
 
 	if err != nil {
 		return nil, err
@@ -42,13 +51,17 @@ func (c *RawClient) GetDomains(category Category) (*[]string, error) {
 }
 
 func (c *RawClient) GetDomainsFull() (*[]Domain, error) {
+	return c.getDomainsFull(context.Background())
+}
+
+func (c *RawClient) getDomainsFull(ctx context.Context) (*[]Domain, error) {
 	// Requires auth
 	if c.defaultAuthType == authTypeNone {
 		return nil, errors.New("GetDomainsFull requires authentication")
 	}
 
 	query := makeQuery(map[string]string{"full": strconv.FormatBool(true)})
-	res, err := c.makeRequest("GET", "/domains", query, nil, authTypeSession)
+	res, err := c.makeRequestContext(ctx, "GET", "/domains", query, nil, authTypeSession)
 
 	if err != nil {
 		return nil, err
@@ -74,7 +87,7 @@ func (c *RawClient) AddDomain(domain string, options CreateDomainRequest) (*Doma
 		return nil, fmt.Errorf("error creating body for AddDomain: %s", err)
 	}
 
-	path := fmt.Sprintf("/domains/%s", domain)
+	path := fmt.Sprintf("/domains/%s", escapePathSegment(domain))
 	res, err := c.makeRequest("POST", path, nil, bytes.NewBuffer(body), authTypeSession)
 
 	if err != nil {
@@ -101,7 +114,7 @@ func (c *RawClient) UpdateDomain(domain string, options UpdateDomainRequest) (*D
 		return nil, fmt.Errorf("error creating body for UpdateDomain: %s", err)
 	}
 
-	path := fmt.Sprintf("/domains/%s", domain)
+	path := fmt.Sprintf("/domains/%s", escapePathSegment(domain))
 	res, err := c.makeRequest("PATCH", path, nil, bytes.NewBuffer(body), authTypeSession)
 
 	if err != nil {
@@ -116,7 +129,7 @@ func (c *RawClient) DeleteDomain(domain string) error {
 		return errors.New("missing permission: domains")
 	}
 
-	path := fmt.Sprintf("/domains/%s", domain)
+	path := fmt.Sprintf("/domains/%s", escapePathSegment(domain))
 	_, err := c.makeRequest("DELETE", path, nil, nil, authTypeSession)
 
 	// No need to check if err is nil, only returning err
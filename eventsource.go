@@ -0,0 +1,330 @@
+package fishfish
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// A feed of stream events consumed by the AutoSync client
+type EventSource interface {
+	// Run blocks, writing events to ch until ctx is cancelled or the source is exhausted
+	Run(ctx context.Context, ch chan WSEvent) error
+}
+
+type connectedHookKey struct{}
+type errorHookKey struct{}
+type baselineHookKey struct{}
+
+// Call fn when a source running with the returned context reports that it is connected
+func withConnectedHook(ctx context.Context, fn func()) context.Context {
+	return context.WithValue(ctx, connectedHookKey{}, fn)
+}
+
+// Report that the source running with ctx is connected, e.g. once the WebSocket is open
+func notifyConnected(ctx context.Context) {
+	if fn, ok := ctx.Value(connectedHookKey{}).(func()); ok {
+		fn()
+	}
+}
+
+// Call fn with errors a source running with the returned context recovers from by itself
+func withErrorHook(ctx context.Context, fn func(err error)) context.Context {
+	return context.WithValue(ctx, errorHookKey{}, fn)
+}
+
+// Report an error the source running with ctx recovers from, e.g. a failed poll that is retried
+func notifyError(ctx context.Context, err error) {
+	if fn, ok := ctx.Value(errorHookKey{}).(func(error)); ok {
+		fn(err)
+	}
+}
+
+// Call fn for the entries a source running with the returned context starts from, instead of fetching them
+// fn returns false if it has none.
+func withBaselineHook(ctx context.Context, fn func() (map[string]Domain, map[string]URL, bool)) context.Context {
+	return context.WithValue(ctx, baselineHookKey{}, fn)
+}
+
+// The entries the client running the source already has, fetching them if it has none
+func fetchBaseline(ctx context.Context, client *RawClient) (map[string]Domain, map[string]URL, error) {
+	if fn, ok := ctx.Value(baselineHookKey{}).(func() (map[string]Domain, map[string]URL, bool)); ok {
+		if domains, urls, ok := fn(); ok {
+			return domains, urls, nil
+		}
+	}
+
+	return fetchSnapshot(ctx, client)
+}
+
+// Receives events from the FishFish API's WebSocket Stream
+type WebSocketSource struct {
+	Client *RawClient
+}
+
+func NewWebSocketSource(client *RawClient) *WebSocketSource {
+	return &WebSocketSource{Client: client}
+}
+
+func (s *WebSocketSource) Run(ctx context.Context, ch chan WSEvent) error {
+	err := s.Client.ConnectWS(ctx, ch)
+
+	// The stream never ends on its own, so it should be reconnected
+	if err == nil && ctx.Err() == nil {
+		return errors.New("websocket closed unexpectedly")
+	}
+
+	return err
+}
+
+// Periodically fetches all domains and urls, emitting events for every difference between fetches
+// Run by an AutoSync client, the first fetch is the client's own sync, and failed fetches are reported to
+// AutoSyncOptions.OnError and retried on the next tick.
+type PollingSource struct {
+	Client   *RawClient
+	Interval time.Duration
+	// Emit create events for every entry of the first fetch instead of using it as a baseline
+	EmitInitial bool
+}
+
+func NewPollingSource(client *RawClient, interval time.Duration) *PollingSource {
+	return &PollingSource{Client: client, Interval: interval}
+}
+
+func (s *PollingSource) Run(ctx context.Context, ch chan WSEvent) error {
+	if s.Interval <= 0 {
+		return errors.New("polling interval must be positive")
+	}
+
+	domains, urls, err := fetchBaseline(ctx, s.Client)
+
+	if err != nil {
+		return err
+	}
+
+	notifyConnected(ctx)
+
+	if s.EmitInitial {
+		events := diffSnapshot(map[string]Domain{}, domains, map[string]URL{}, urls)
+
+		if err := sendEvents(ctx, ch, events); err != nil {
+			return nil
+		}
+	}
+
+	ticker := time.NewTicker(s.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			newDomains, newURLs, err := fetchSnapshot(ctx, s.Client)
+
+			if err != nil {
+				// Keep the previous snapshot and try again on the next tick
+				if ctx.Err() == nil {
+					notifyError(ctx, fmt.Errorf("failed to poll: %s", err))
+				}
+				continue
+			}
+
+			events := diffSnapshot(domains, newDomains, urls, newURLs)
+			domains, urls = newDomains, newURLs
+
+			if err := sendEvents(ctx, ch, events); err != nil {
+				return nil
+			}
+		}
+	}
+}
+
+// Replays the events recorded in a journal file
+type JournalSource struct {
+	Path    string
+	Options ReplayOptions
+}
+
+func NewJournalSource(path string, options ReplayOptions) *JournalSource {
+	return &JournalSource{Path: path, Options: options}
+}
+
+func (s *JournalSource) Run(ctx context.Context, ch chan WSEvent) error {
+	notifyConnected(ctx)
+
+	err := ReplayJournal(ctx, s.Path, s.Options, func(entry JournalEntry) error {
+		return sendEvents(ctx, ch, []WSEvent{entry.Event})
+	})
+
+	if errors.Is(err, ctx.Err()) {
+		return nil
+	}
+
+	return err
+}
+
+// Forwards events written to an in-process channel, mostly useful for tests
+type ChannelSource struct {
+	Events chan WSEvent
+}
+
+func NewChannelSource(events chan WSEvent) *ChannelSource {
+	return &ChannelSource{Events: events}
+}
+
+func (s *ChannelSource) Run(ctx context.Context, ch chan WSEvent) error {
+	notifyConnected(ctx)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case event, ok := <-s.Events:
+			if !ok {
+				// Channel was closed
+				return nil
+			}
+
+			if err := sendEvents(ctx, ch, []WSEvent{event}); err != nil {
+				return nil
+			}
+		}
+	}
+}
+
+func sendEvents(ctx context.Context, ch chan WSEvent, events []WSEvent) error {
+	for _, event := range events {
+		select {
+		case ch <- event:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	return nil
+}
+
+// Fetch every domain and url, indexed by name
+// Without authentication, only the name and category of each entry are available
+func fetchSnapshot(ctx context.Context, client *RawClient) (map[string]Domain, map[string]URL, error) {
+	if client.defaultAuthType == authTypeNone {
+		return fetchCategorySnapshot(ctx, client)
+	}
+
+	domains, err := client.getDomainsFull(ctx)
+
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to fetch domains: %s", err)
+	}
+
+	urls, err := client.getURLsFull(ctx)
+
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to fetch urls: %s", err)
+	}
+
+	domainIndex := make(map[string]Domain, len(*domains))
+	for _, domain := range *domains {
+		domainIndex[domain.Domain] = domain
+	}
+
+	urlIndex := make(map[string]URL, len(*urls))
+	for _, url := range *urls {
+		urlIndex[url.URL] = url
+	}
+
+	return domainIndex, urlIndex, nil
+}
+
+// Fetch domains and urls using the public per-category endpoints
+func fetchCategorySnapshot(ctx context.Context, client *RawClient) (map[string]Domain, map[string]URL, error) {
+	domainIndex := map[string]Domain{}
+	urlIndex := map[string]URL{}
+
+	for _, category := range Categories {
+		domains, err := client.getDomains(ctx, category)
+
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to fetch %s domains: %s", category, err)
+		}
+
+		for _, name := range *domains {
+			domainIndex[name] = Domain{Domain: name, Category: category}
+		}
+
+		urls, err := client.getURLs(ctx, category)
+
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to fetch %s urls: %s", category, err)
+		}
+
+		for _, name := range *urls {
+			urlIndex[name] = URL{URL: name, Category: category}
+		}
+	}
+
+	return domainIndex, urlIndex, nil
+}
+
+// Create the stream events that turn the old snapshot into the new one
+func diffSnapshot(oldDomains, newDomains map[string]Domain, oldURLs, newURLs map[string]URL) []WSEvent {
+	events := []WSEvent{}
+
+	for name, domain := range newDomains {
+		old, ok := oldDomains[name]
+
+		if !ok {
+			events = append(events, WSEvent{Type: WSEventTypeDomainCreate, Data: WSCreateDomainData{
+				Domain:      domain.Domain,
+				Description: domain.Description,
+				Category:    domain.Category,
+				Target:      domain.Target,
+			}})
+		} else if old != domain {
+			events = append(events, WSEvent{Type: WSEventTypeDomainUpdate, Data: WSUpdateDomainData{
+				Domain:      domain.Domain,
+				Description: domain.Description,
+				Category:    domain.Category,
+				Target:      domain.Target,
+				Checked:     domain.Checked,
+			}})
+		}
+	}
+
+	for name := range oldDomains {
+		if _, ok := newDomains[name]; !ok {
+			events = append(events, WSEvent{Type: WSEventTypeDomainDelete, Data: WSDeleteDomainData{Domain: name}})
+		}
+	}
+
+	for name, url := range newURLs {
+		old, ok := oldURLs[name]
+
+		if !ok {
+			events = append(events, WSEvent{Type: WSEventTypeURLCreate, Data: WSCreateURLData{
+				URL:         url.URL,
+				Description: url.Description,
+				Category:    url.Category,
+				Target:      url.Target,
+			}})
+		} else if old != url {
+			events = append(events, WSEvent{Type: WSEventTypeURLUpdate, Data: WSUpdateURLData{
+				URL:         url.URL,
+				Description: url.Description,
+				Category:    url.Category,
+				Target:      url.Target,
+				Checked:     url.Checked,
+			}})
+		}
+	}
+
+	for name := range oldURLs {
+		if _, ok := newURLs[name]; !ok {
+			events = append(events, WSEvent{Type: WSEventTypeURLDelete, Data: WSDeleteURLData{URL: name}})
+		}
+	}
+
+	return events
+}
@@ -0,0 +1,53 @@
+package fishfish
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestDiffSnapshot(t *testing.T) {
+	oldDomains := map[string]Domain{
+		"kept.example":    {Domain: "kept.example", Category: CategoryPhishing},
+		"changed.example": {Domain: "changed.example", Category: CategoryPhishing},
+		"removed.example": {Domain: "removed.example", Category: CategoryMalware},
+	}
+	newDomains := map[string]Domain{
+		"kept.example":    {Domain: "kept.example", Category: CategoryPhishing},
+		"changed.example": {Domain: "changed.example", Category: CategorySafe},
+		"new.example":     {Domain: "new.example", Category: CategoryMalware, Target: "Steam"},
+	}
+	oldURLs := map[string]URL{
+		"https://sites.example/old": {URL: "https://sites.example/old", Category: CategoryPhishing},
+		"https://sites.example/a":   {URL: "https://sites.example/a", Category: CategoryPhishing},
+	}
+	newURLs := map[string]URL{
+		"https://sites.example/a":   {URL: "https://sites.example/a", Category: CategoryPhishing, Description: "Fake login"},
+		"https://sites.example/new": {URL: "https://sites.example/new", Category: CategoryMalware},
+	}
+
+	events := []string{}
+	for _, event := range diffSnapshot(oldDomains, newDomains, oldURLs, newURLs) {
+		events = append(events, fmt.Sprintf("%s %+v", event.Type, event.Data))
+	}
+	sort.Strings(events)
+
+	expected := []string{
+		fmt.Sprintf("%s %+v", WSEventTypeDomainCreate, WSCreateDomainData{Domain: "new.example", Category: CategoryMalware, Target: "Steam"}),
+		fmt.Sprintf("%s %+v", WSEventTypeDomainDelete, WSDeleteDomainData{Domain: "removed.example"}),
+		fmt.Sprintf("%s %+v", WSEventTypeDomainUpdate, WSUpdateDomainData{Domain: "changed.example", Category: CategorySafe}),
+		fmt.Sprintf("%s %+v", WSEventTypeURLCreate, WSCreateURLData{URL: "https://sites.example/new", Category: CategoryMalware}),
+		fmt.Sprintf("%s %+v", WSEventTypeURLDelete, WSDeleteURLData{URL: "https://sites.example/old"}),
+		fmt.Sprintf("%s %+v", WSEventTypeURLUpdate, WSUpdateURLData{URL: "https://sites.example/a", Category: CategoryPhishing, Description: "Fake login"}),
+	}
+	sort.Strings(expected)
+
+	if !reflect.DeepEqual(events, expected) {
+		panic(fmt.Errorf("expected events:\n%v\ngot:\n%v", expected, events))
+	}
+
+	if events := diffSnapshot(oldDomains, oldDomains, oldURLs, oldURLs); len(events) != 0 {
+		panic(fmt.Errorf("expected no events for an unchanged snapshot, got %v", events))
+	}
+}
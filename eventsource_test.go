@@ -0,0 +1,221 @@
+package fishfish_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/existagon/fishfish-go"
+)
+
+func TestChannelSource(t *testing.T) {
+	events := make(chan fishfish.WSEvent)
+
+	api := newTestAPI(t, nil, nil)
+	client, err := fishfish.NewAutoSyncWithOptions("", []fishfish.APIPermission{}, fishfish.AutoSyncOptions{
+		APIURL: api.URL,
+		Source: fishfish.NewChannelSource(events),
+	})
+	mustPanic(err)
+
+	client.StartAutoSync()
+	defer client.StopAutoSync()
+
+	events <- fishfish.WSEvent{Type: fishfish.WSEventTypeURLCreate, Data: fishfish.WSCreateURLData{
+		URL:      "https://phish.example/login",
+		Category: fishfish.CategoryPhishing,
+	}}
+	events <- fishfish.WSEvent{Type: fishfish.WSEventTypeURLUpdate, Data: fishfish.WSUpdateURLData{
+		URL:         "https://phish.example/login",
+		Description: "Fake login page",
+	}}
+
+	// Events are applied asynchronously
+	deadline := time.Now().Add(time.Second * 5)
+	for {
+		url, err := client.GetURL("https://phish.example/login")
+
+		if err == nil && url.Description == "Fake login page" {
+			break
+		}
+
+		if time.Now().After(deadline) {
+			panic(fmt.Errorf("url was not updated from the channel source: %v", err))
+		}
+
+		time.Sleep(time.Millisecond * 10)
+	}
+}
+
+func TestJournalSource(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.jsonl")
+
+	journal, err := fishfish.OpenJournal(path)
+	mustPanic(err)
+
+	_, err = journal.Append(fishfish.WSEvent{Type: fishfish.WSEventTypeDomainCreate, Data: fishfish.WSCreateDomainData{
+		Domain:   "malware.example",
+		Category: fishfish.CategoryMalware,
+	}})
+	mustPanic(err)
+	mustPanic(journal.Close())
+
+	ch := make(chan fishfish.WSEvent, 1)
+	err = fishfish.NewJournalSource(path, fishfish.ReplayOptions{}).Run(context.Background(), ch)
+	mustPanic(err)
+
+	event := <-ch
+	if event.Type != fishfish.WSEventTypeDomainCreate {
+		panic(fmt.Errorf("expected %s event, got %s", fishfish.WSEventTypeDomainCreate, event.Type))
+	}
+}
+
+// Serve the public per-category endpoints from domains that can be changed while the server runs
+type pollingTestAPI struct {
+	mx       sync.Mutex
+	domains  map[string]fishfish.Category
+	failing  bool
+	requests int
+}
+
+func (a *pollingTestAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	a.mx.Lock()
+	defer a.mx.Unlock()
+
+	a.requests++
+
+	if a.failing {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	names := []string{}
+	if r.URL.Path == "/domains" {
+		for name, category := range a.domains {
+			if string(category) == r.URL.Query().Get("category") {
+				names = append(names, name)
+			}
+		}
+	}
+
+	json.NewEncoder(w).Encode(names)
+}
+
+func (a *pollingTestAPI) update(fn func()) {
+	a.mx.Lock()
+	defer a.mx.Unlock()
+	fn()
+}
+
+// Wait until fn returns true, panicking after a few seconds
+func waitFor(description string, fn func() bool) {
+	deadline := time.Now().Add(time.Second * 5)
+
+	for !fn() {
+		if time.Now().After(deadline) {
+			panic(fmt.Errorf("timed out waiting for %s", description))
+		}
+
+		time.Sleep(time.Millisecond * 10)
+	}
+}
+
+func TestPollingSource(t *testing.T) {
+	api := &pollingTestAPI{domains: map[string]fishfish.Category{
+		"changed.example": fishfish.CategoryPhishing,
+		"removed.example": fishfish.CategoryMalware,
+	}}
+	server := httptest.NewServer(api)
+	defer server.Close()
+
+	raw, err := fishfish.NewRawWithAPIURL(server.URL, "", []fishfish.APIPermission{})
+	mustPanic(err)
+
+	errs := make(chan error, 100)
+	client, err := fishfish.NewAutoSyncWithOptions("", []fishfish.APIPermission{}, fishfish.AutoSyncOptions{
+		APIURL:  server.URL,
+		Source:  fishfish.NewPollingSource(raw, time.Millisecond*20),
+		OnError: func(err error) { errs <- err },
+	})
+	mustPanic(err)
+
+	client.StartAutoSync()
+	defer client.StopAutoSync()
+
+	waitFor("the source to connect", func() bool { return client.Status().StreamConnected })
+
+	api.update(func() {
+		api.domains["new.example"] = fishfish.CategoryPhishing
+		api.domains["changed.example"] = fishfish.CategorySafe
+		delete(api.domains, "removed.example")
+	})
+
+	waitFor("the changes to be polled", func() bool {
+		created, err := client.GetDomain("new.example")
+		if err != nil || created.Category != fishfish.CategoryPhishing {
+			return false
+		}
+
+		changed, err := client.GetDomain("changed.example")
+		if err != nil || changed.Category != fishfish.CategorySafe {
+			return false
+		}
+
+		_, err = client.GetDomain("removed.example")
+		return err != nil
+	})
+
+	// Failed polls are reported and keep the previous entries
+	api.update(func() { api.failing = true })
+
+	select {
+	case err := <-errs:
+		if !strings.Contains(err.Error(), "failed to poll") {
+			panic(fmt.Errorf("expected a polling error, got %s", err))
+		}
+	case <-time.After(time.Second * 5):
+		panic("expected the failed poll to be reported")
+	}
+
+	if status := client.Status(); !strings.Contains(status.LastError, "failed to poll") {
+		panic(fmt.Errorf("expected the polling error in status, got %q", status.LastError))
+	}
+
+	if _, err := client.GetDomain("new.example"); err != nil {
+		panic(fmt.Errorf("expected entries to be kept after a failed poll: %s", err))
+	}
+}
+
+func TestPollingSourceBaseline(t *testing.T) {
+	api := &pollingTestAPI{domains: map[string]fishfish.Category{"phish.example": fishfish.CategoryPhishing}}
+	server := httptest.NewServer(api)
+	defer server.Close()
+
+	raw, err := fishfish.NewRawWithAPIURL(server.URL, "", []fishfish.APIPermission{})
+	mustPanic(err)
+
+	client, err := fishfish.NewAutoSyncWithOptions("", []fishfish.APIPermission{}, fishfish.AutoSyncOptions{
+		APIURL: server.URL,
+		Source: fishfish.NewPollingSource(raw, time.Hour),
+	})
+	mustPanic(err)
+
+	client.StartAutoSync()
+	defer client.StopAutoSync()
+
+	waitFor("the source to connect", func() bool { return client.Status().StreamConnected })
+
+	// The source starts from the initial sync instead of fetching everything again
+	api.update(func() {
+		if expected := len(fishfish.Categories) * 2; api.requests != expected {
+			panic(fmt.Errorf("expected the %d requests of the initial sync, got %d", expected, api.requests))
+		}
+	})
+}
@@ -16,7 +16,7 @@ func main() {
 		panic(err)
 	}
 
-	// Start automatically syncing domains every 5 minutes
+	// Start receiving updates from the stream and fully resync every hour
 	ffClient.StartAutoSync()
 
 	// Get domain
@@ -0,0 +1,280 @@
+package fishfish
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"time"
+)
+
+type ExportFormat string
+
+const (
+	// A hosts file, only the listed names are blocked and not their subdomains
+	// Hosts files can't express wildcards, so wildcard domains are skipped.
+	ExportFormatHosts = "hosts"
+	// dnsmasq address lines, blocking domains and their subdomains
+	ExportFormatDnsmasq = "dnsmasq"
+	// Unbound local-zone lines answering NXDOMAIN for domains and their subdomains
+	ExportFormatUnbound = "unbound"
+	// A DNS Response Policy Zone answering NXDOMAIN for domains and their subdomains
+	ExportFormatRPZ = "rpz"
+	// An AdBlock Plus / uBlock Origin filter list, including urls if enabled
+	ExportFormatAdBlock = "adblock"
+	// A proxy auto-config file sending blocked hosts to an unreachable proxy, including urls if enabled
+	// Browsers only pass the host of https urls to PAC files, so url rules only apply to http.
+	ExportFormatPAC = "pac"
+	// A Chrome policy JSON with a URLBlocklist, including urls if enabled
+	ExportFormatChrome = "chrome"
+)
+
+var ExportFormats = []ExportFormat{
+	ExportFormatHosts, ExportFormatDnsmasq, ExportFormatUnbound, ExportFormatRPZ,
+	ExportFormatAdBlock, ExportFormatPAC, ExportFormatChrome,
+}
+
+const (
+	defaultSinkAddress = "0.0.0.0"
+	// Port 9 is the discard service, connections fail quickly
+	defaultBlockedProxy = "PROXY 127.0.0.1:9"
+	defaultRPZTTL       = 300
+)
+
+type ExportOptions struct {
+	Format ExportFormat
+	// Categories to include, defaults to phishing and malware
+	Categories []Category
+	// Also export urls, for formats that can express them
+	IncludeURLs bool
+	// The address blocked names resolve to in hosts and dnsmasq exports, defaults to 0.0.0.0
+	SinkAddress string
+	// The proxy blocked requests are sent to in PAC exports, defaults to an unreachable local proxy
+	BlockedProxy string
+	// Written in the header and used as the RPZ serial, zero leaves it out so the output only depends on the data
+	Generated time.Time
+}
+
+// Domains and urls selected for an export, sorted and without duplicates
+type exportEntries struct {
+	domains []string
+	// Without the scheme, e.g. sites.example/scam
+	urls []string
+	// Domains the format can't block without blocking other sites, or at all
+	skipped int
+}
+
+// Whether a format is read by a DNS server, which can only block names and not IP addresses or urls
+func isDNSExportFormat(format ExportFormat) bool {
+	switch format {
+	case ExportFormatHosts, ExportFormatDnsmasq, ExportFormatUnbound, ExportFormatRPZ:
+		return true
+	}
+
+	return false
+}
+
+func selectExportEntries(domains []Domain, urls []URL, options ExportOptions) exportEntries {
+	categories := options.Categories
+	if len(categories) == 0 {
+		categories = []Category{CategoryPhishing, CategoryMalware}
+	}
+
+	suffixes := DefaultPublicSuffixList()
+	skipped := 0
+
+	domainSet := map[string]bool{}
+	for _, domain := range domains {
+		if !containsValue(categories, domain.Category) {
+			continue
+		}
+
+		// Exporting a wildcard as its parent in a hosts file would block the parent instead of its subdomains
+		wildcard := strings.HasPrefix(domain.Domain, "*.")
+		if wildcard && options.Format == ExportFormatHosts {
+			skipped++
+			continue
+		}
+
+		// Every other format blocks subdomains, so wildcards are exported as their parent
+		name, err := canonicalHost(strings.TrimPrefix(domain.Domain, "*."))
+
+		if err != nil || name == "" {
+			continue
+		}
+
+		// An IP address isn't a name a DNS server is asked for
+		if net.ParseIP(name) != nil {
+			if isDNSExportFormat(options.Format) {
+				skipped++
+			} else {
+				domainSet[name] = true
+			}
+			continue
+		}
+
+		// Blocking a public suffix, e.g. from *.github.io, would block every site registered under it
+		if suffixes.IsPublicSuffix(name) {
+			skipped++
+			continue
+		}
+
+		domainSet[name] = true
+	}
+
+	urlSet := map[string]bool{}
+	if options.IncludeURLs && !isDNSExportFormat(options.Format) {
+		for _, url := range urls {
+			if !containsValue(categories, url.Category) {
+				continue
+			}
+
+			if parsed, err := parseCanonicalURL(url.URL); err == nil {
+				urlSet[parsed.hostPort()+parsed.pathQuery()] = true
+			}
+		}
+	}
+
+	return exportEntries{domains: sortedKeys(domainSet), urls: sortedKeys(urlSet), skipped: skipped}
+}
+
+// Write domains and urls as a blocklist, in sorted order so the same data always gives the same output
+func Export(w io.Writer, domains []Domain, urls []URL, options ExportOptions) error {
+	entries := selectExportEntries(domains, urls, options)
+	out := bufio.NewWriter(w)
+
+	header := func(comment string) {
+		fmt.Fprintf(out, "%s FishFish blocklist: %d domains, %d urls\n", comment, len(entries.domains), len(entries.urls))
+		if entries.skipped > 0 {
+			fmt.Fprintf(out, "%s Skipped: %d domains that can't be blocked exactly in this format\n", comment, entries.skipped)
+		}
+		if !options.Generated.IsZero() {
+			fmt.Fprintf(out, "%s Generated: %s\n", comment, options.Generated.UTC().Format(time.RFC3339))
+		}
+	}
+
+	sink := options.SinkAddress
+	if sink == "" {
+		sink = defaultSinkAddress
+	}
+
+	switch options.Format {
+	case ExportFormatHosts:
+		header("#")
+		for _, domain := range entries.domains {
+			fmt.Fprintf(out, "%s %s\n", sink, domain)
+		}
+	case ExportFormatDnsmasq:
+		header("#")
+		for _, domain := range entries.domains {
+			fmt.Fprintf(out, "address=/%s/%s\n", domain, sink)
+		}
+	case ExportFormatUnbound:
+		header("#")
+		for _, domain := range entries.domains {
+			fmt.Fprintf(out, "local-zone: \"%s.\" always_nxdomain\n", domain)
+		}
+	case ExportFormatRPZ:
+		writeRPZ(out, entries, options, header)
+	case ExportFormatAdBlock:
+		fmt.Fprintln(out, "[Adblock Plus 2.0]")
+		fmt.Fprintln(out, "! Title: FishFish")
+		header("!")
+		for _, domain := range entries.domains {
+			fmt.Fprintf(out, "||%s^\n", domain)
+		}
+		for _, url := range entries.urls {
+			fmt.Fprintf(out, "||%s\n", url)
+		}
+	case ExportFormatPAC:
+		if err := writePAC(out, entries, options, header); err != nil {
+			return err
+		}
+	case ExportFormatChrome:
+		blocklist := append(append([]string{}, entries.domains...), entries.urls...)
+		data, err := json.MarshalIndent(map[string][]string{"URLBlocklist": blocklist}, "", "  ")
+
+		if err != nil {
+			return err
+		}
+
+		out.Write(append(data, '\n'))
+	default:
+		return fmt.Errorf("unknown export format: %s", options.Format)
+	}
+
+	return out.Flush()
+}
+
+func writeRPZ(out *bufio.Writer, entries exportEntries, options ExportOptions, header func(string)) {
+	serial := int64(1)
+	if !options.Generated.IsZero() {
+		serial = options.Generated.Unix()
+	}
+
+	header(";")
+	fmt.Fprintf(out, "$TTL %d\n", defaultRPZTTL)
+	fmt.Fprintf(out, "@ IN SOA localhost. hostmaster.localhost. %d 3600 600 86400 %d\n", serial, defaultRPZTTL)
+	fmt.Fprintln(out, "@ IN NS localhost.")
+
+	// CNAME to the root answers NXDOMAIN
+	for _, domain := range entries.domains {
+		fmt.Fprintf(out, "%s CNAME .\n", domain)
+		fmt.Fprintf(out, "*.%s CNAME .\n", domain)
+	}
+}
+
+func writePAC(out *bufio.Writer, entries exportEntries, options ExportOptions, header func(string)) error {
+	proxy := options.BlockedProxy
+	if proxy == "" {
+		proxy = defaultBlockedProxy
+	}
+
+	domains, err := json.Marshal(entries.domains)
+
+	if err != nil {
+		return err
+	}
+
+	urls, err := json.Marshal(entries.urls)
+
+	if err != nil {
+		return err
+	}
+
+	proxyLiteral, err := json.Marshal(proxy)
+
+	if err != nil {
+		return err
+	}
+
+	header("//")
+	fmt.Fprintf(out, `var blockedDomains = %s;
+var blockedURLs = %s;
+
+function FindProxyForURL(url, host) {
+  host = host.toLowerCase();
+  for (var i = 0; i < blockedDomains.length; i++) {
+    if (host === blockedDomains[i] || dnsDomainIs(host, "." + blockedDomains[i])) {
+      return %s;
+    }
+  }
+  var stripped = url.replace(/^[a-z]+:\/\//i, "");
+  for (var j = 0; j < blockedURLs.length; j++) {
+    if (stripped.indexOf(blockedURLs[j]) === 0) {
+      return %s;
+    }
+  }
+  return "DIRECT";
+}
+`, domains, urls, proxyLiteral, proxyLiteral)
+
+	return nil
+}
+
+// Write the cached domains and urls as a blocklist, see Export
+func (c *AutoSyncClient) Export(w io.Writer, options ExportOptions) error {
+	return Export(w, c.GetDomains(), c.GetURLs(), options)
+}
@@ -0,0 +1,122 @@
+package fishfish_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/existagon/fishfish-go"
+)
+
+func TestExport(t *testing.T) {
+	domains := []fishfish.Domain{
+		{Domain: "steamcommunity-gift.ru", Category: fishfish.CategoryPhishing},
+		{Domain: "*.Malware.example", Category: fishfish.CategoryMalware},
+		{Domain: "discord.com", Category: fishfish.CategorySafe},
+	}
+	urls := []fishfish.URL{
+		{URL: "https://sites.example/scam/", Category: fishfish.CategoryPhishing},
+	}
+
+	tests := map[fishfish.ExportFormat][]string{
+		fishfish.ExportFormatHosts:   {"# Skipped: 1 domains", "\n0.0.0.0 steamcommunity-gift.ru\n"},
+		fishfish.ExportFormatDnsmasq: {"address=/malware.example/0.0.0.0\naddress=/steamcommunity-gift.ru/0.0.0.0\n"},
+		fishfish.ExportFormatUnbound: {"local-zone: \"malware.example.\" always_nxdomain\n"},
+		fishfish.ExportFormatRPZ:     {"$TTL 300\n", "steamcommunity-gift.ru CNAME .\n*.steamcommunity-gift.ru CNAME .\n"},
+		fishfish.ExportFormatAdBlock: {"[Adblock Plus 2.0]\n", "||malware.example^\n||steamcommunity-gift.ru^\n||sites.example/scam\n"},
+		fishfish.ExportFormatPAC:     {`var blockedDomains = ["malware.example","steamcommunity-gift.ru"];`, `var blockedURLs = ["sites.example/scam"];`, "function FindProxyForURL(url, host) {"},
+	}
+
+	for format, expected := range tests {
+		var first, second bytes.Buffer
+		options := fishfish.ExportOptions{Format: format, IncludeURLs: true}
+
+		mustPanic(fishfish.Export(&first, domains, urls, options))
+		mustPanic(fishfish.Export(&second, []fishfish.Domain{domains[2], domains[1], domains[0]}, urls, options))
+
+		if first.String() != second.String() {
+			panic(fmt.Errorf("%s: output depends on input order", format))
+		}
+
+		for _, part := range expected {
+			if !strings.Contains(first.String(), part) {
+				panic(fmt.Errorf("%s: expected %q in:\n%s", format, part, first.String()))
+			}
+		}
+
+		if format == fishfish.ExportFormatHosts && strings.Contains(first.String(), "malware.example") {
+			panic(fmt.Errorf("hosts: a wildcard must not block its parent:\n%s", first.String()))
+		}
+
+		if strings.Contains(first.String(), "discord.com") {
+			panic(fmt.Errorf("%s: safe domains should be excluded by default", format))
+		}
+	}
+
+	var chrome bytes.Buffer
+	mustPanic(fishfish.Export(&chrome, domains, urls, fishfish.ExportOptions{Format: fishfish.ExportFormatChrome, Categories: []fishfish.Category{fishfish.CategoryPhishing}}))
+
+	policy := map[string][]string{}
+	mustPanic(json.Unmarshal(chrome.Bytes(), &policy))
+
+	if fmt.Sprint(policy["URLBlocklist"]) != "[steamcommunity-gift.ru]" {
+		panic(fmt.Errorf("unexpected chrome policy %v", policy))
+	}
+
+	var rpz bytes.Buffer
+	generated := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	mustPanic(fishfish.Export(&rpz, domains, nil, fishfish.ExportOptions{Format: fishfish.ExportFormatRPZ, Generated: generated}))
+
+	if !strings.Contains(rpz.String(), fmt.Sprintf(" %d 3600 ", generated.Unix())) || !strings.Contains(rpz.String(), "; Generated: 2024-01-02T03:04:05Z") {
+		panic(fmt.Errorf("expected the generation time in the rpz output:\n%s", rpz.String()))
+	}
+
+	// Blocking github.io would block every site hosted on it
+	var dnsmasq bytes.Buffer
+	mustPanic(fishfish.Export(&dnsmasq, []fishfish.Domain{{Domain: "*.github.io", Category: fishfish.CategoryPhishing}}, nil, fishfish.ExportOptions{Format: fishfish.ExportFormatDnsmasq}))
+
+	if strings.Contains(dnsmasq.String(), "address=") || !strings.Contains(dnsmasq.String(), "# Skipped: 1 domains") {
+		panic(fmt.Errorf("expected the public suffix to be skipped:\n%s", dnsmasq.String()))
+	}
+
+	if err := fishfish.Export(&rpz, domains, nil, fishfish.ExportOptions{Format: "bind"}); err == nil {
+		panic(fmt.Errorf("expected an error for an unknown format"))
+	}
+}
+
+func TestExportHeaderCounts(t *testing.T) {
+	domains := []fishfish.Domain{
+		{Domain: "steamcommunity-gift.ru", Category: fishfish.CategoryPhishing},
+		{Domain: "203.0.113.7", Category: fishfish.CategoryMalware},
+	}
+	urls := []fishfish.URL{
+		{URL: "https://sites.example/scam", Category: fishfish.CategoryPhishing},
+	}
+
+	tests := map[fishfish.ExportFormat]string{
+		// DNS servers can't block IP addresses or urls
+		fishfish.ExportFormatHosts:   "# FishFish blocklist: 1 domains, 0 urls\n# Skipped: 1 domains",
+		fishfish.ExportFormatDnsmasq: "# FishFish blocklist: 1 domains, 0 urls\n# Skipped: 1 domains",
+		fishfish.ExportFormatUnbound: "# FishFish blocklist: 1 domains, 0 urls\n# Skipped: 1 domains",
+		fishfish.ExportFormatRPZ:     "; FishFish blocklist: 1 domains, 0 urls\n; Skipped: 1 domains",
+		fishfish.ExportFormatAdBlock: "! FishFish blocklist: 2 domains, 1 urls\n",
+		fishfish.ExportFormatPAC:     "// FishFish blocklist: 2 domains, 1 urls\n",
+	}
+
+	for format, expected := range tests {
+		var out bytes.Buffer
+		mustPanic(fishfish.Export(&out, domains, urls, fishfish.ExportOptions{Format: format, IncludeURLs: true}))
+
+		if !strings.Contains(out.String(), expected) {
+			panic(fmt.Errorf("%s: expected %q in:\n%s", format, expected, out.String()))
+		}
+
+		dns := format != fishfish.ExportFormatAdBlock && format != fishfish.ExportFormatPAC
+		if dns && strings.Contains(out.String(), "203.0.113.7") {
+			panic(fmt.Errorf("%s: an IP address must not be written as a name:\n%s", format, out.String()))
+		}
+	}
+}
@@ -0,0 +1,495 @@
+package fishfish
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The name FishFish data is reported under in verdicts and FeedPrecedence
+const FeedNameFishFish = "fishfish"
+
+// A blocklist other than FishFish, merged into an AutoSync client's lookups
+type Feed interface {
+	// A unique name, reported in verdicts of entries the feed lists
+	Name() string
+	// Fetch every entry of the feed
+	Fetch(ctx context.Context) ([]FeedEntry, error)
+}
+
+// A domain or url listed by a feed, exactly one of Domain and URL is set
+type FeedEntry struct {
+	Domain      string
+	URL         string
+	Category    Category
+	Description string
+	// The brand or service the entry imitates
+	Target string
+}
+
+type FeedFormat string
+
+const (
+	// A hosts file, e.g. 0.0.0.0 evil.com
+	FeedFormatHosts = "hosts"
+	// One domain or url per line
+	FeedFormatList = "list"
+	// A CSV file with a header row, see TextFeed for the columns
+	FeedFormatCSV = "csv"
+)
+
+// Hostnames in hosts files that are part of the system configuration rather than blocked
+var hostsFileReserved = map[string]bool{
+	"localhost":             true,
+	"localhost.localdomain": true,
+	"local":                 true,
+	"broadcasthost":         true,
+	"ip6-localhost":         true,
+	"ip6-loopback":          true,
+	"ip6-localnet":          true,
+	"ip6-mcastprefix":       true,
+	"ip6-allnodes":          true,
+	"ip6-allrouters":        true,
+	"0.0.0.0":               true,
+}
+
+// A feed read from a local file or an http(s) url
+// Blank lines and lines starting with #, ! or ; are ignored in hosts files and lists, defanged entries are refanged.
+type TextFeed struct {
+	FeedName string
+	// A file path, or an http or https url
+	Location string
+	Format   FeedFormat
+	// The category of entries that don't specify one, defaults to phishing
+	Category Category
+	// Used to fetch http feeds, defaults to http.DefaultClient
+	// Fetches have no timeout of their own, AutoSync clients limit them with AutoSyncOptions.FeedTimeout.
+	Client *http.Client
+	// CSV header names, default to domain, url, category, description and target
+	// Rows with a url are url entries, other rows are domain entries.
+	DomainColumn      string
+	URLColumn         string
+	CategoryColumn    string
+	DescriptionColumn string
+	TargetColumn      string
+}
+
+func NewTextFeed(name string, location string, format FeedFormat) *TextFeed {
+	return &TextFeed{FeedName: name, Location: location, Format: format}
+}
+
+func (f *TextFeed) Name() string {
+	return f.FeedName
+}
+
+func (f *TextFeed) open(ctx context.Context) (io.ReadCloser, error) {
+	if !strings.HasPrefix(f.Location, "http://") && !strings.HasPrefix(f.Location, "https://") {
+		return os.Open(f.Location)
+	}
+
+	client := f.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "GET", f.Location, nil)
+
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := client.Do(req)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		res.Body.Close()
+		return nil, fmt.Errorf("unexpected status %s", res.Status)
+	}
+
+	return res.Body, nil
+}
+
+func (f *TextFeed) Fetch(ctx context.Context) ([]FeedEntry, error) {
+	reader, err := f.open(ctx)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to open feed %s: %s", f.FeedName, err)
+	}
+
+	defer reader.Close()
+
+	category := f.Category
+	if category == "" {
+		category = CategoryPhishing
+	}
+
+	var entries []FeedEntry
+
+	switch f.Format {
+	case FeedFormatHosts:
+		entries, err = parseHostsFeed(reader, category)
+	case FeedFormatList:
+		entries, err = parseListFeed(reader, category, nil)
+	case FeedFormatCSV:
+		entries, err = f.parseCSV(reader, category, nil)
+	default:
+		err = fmt.Errorf("unknown format: %s", f.Format)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to read feed %s: %s", f.FeedName, err)
+	}
+
+	return entries, nil
+}
+
+// Call fn with every line that isn't blank or a comment
+func scanFeedLines(reader io.Reader, fn func(line string)) error {
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, "!") || strings.HasPrefix(line, ";") {
+			continue
+		}
+
+		fn(line)
+	}
+
+	return scanner.Err()
+}
+
+func parseHostsFeed(reader io.Reader, category Category) ([]FeedEntry, error) {
+	entries := []FeedEntry{}
+
+	err := scanFeedLines(reader, func(line string) {
+		line, _, _ = strings.Cut(line, "#")
+		fields := strings.Fields(line)
+
+		// Lines are an address followed by hostnames, some lists leave out the address
+		if len(fields) > 1 && net.ParseIP(fields[0]) != nil {
+			fields = fields[1:]
+		}
+
+		for _, field := range fields {
+			if host, err := canonicalHost(field); err == nil && !hostsFileReserved[host] {
+				entries = append(entries, FeedEntry{Domain: host, Category: category})
+			}
+		}
+	})
+
+	return entries, err
+}
+
+// Parse one domain or url per line, calling invalid with lines that are neither if it isn't nil
+func parseListFeed(reader io.Reader, category Category, invalid func(value string)) ([]FeedEntry, error) {
+	entries := []FeedEntry{}
+
+	err := scanFeedLines(reader, func(line string) {
+		if entry, ok := newFeedEntry(line, category); ok {
+			entries = append(entries, entry)
+		} else if invalid != nil {
+			invalid(line)
+		}
+	})
+
+	return entries, err
+}
+
+// Create an entry from a domain or url, which may be defanged
+func newFeedEntry(name string, category Category) (FeedEntry, bool) {
+	name = strings.TrimSpace(name)
+	verdict, parsed := newVerdict(name)
+
+	if verdict.Error != "" || name == "" || strings.ContainsAny(name, " \t") {
+		return FeedEntry{}, false
+	}
+
+	if parsed != nil {
+		return FeedEntry{URL: Refang(name), Category: category}, true
+	}
+
+	return FeedEntry{Domain: verdict.Host, Category: category}, true
+}
+
+// Parse a CSV file with a header row, calling invalid with values that aren't a domain or url if it isn't nil
+func (f *TextFeed) parseCSV(reader io.Reader, category Category, invalid func(value string)) ([]FeedEntry, error) {
+	records := csv.NewReader(reader)
+	records.FieldsPerRecord = -1
+	records.TrimLeadingSpace = true
+	records.Comment = '#'
+
+	header, err := records.Read()
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to read header: %s", err)
+	}
+
+	columns := map[string]int{}
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+
+	column := func(name, fallback string) int {
+		if name == "" {
+			name = fallback
+		}
+
+		if i, ok := columns[strings.ToLower(name)]; ok {
+			return i
+		}
+
+		return -1
+	}
+
+	domainColumn := column(f.DomainColumn, "domain")
+	urlColumn := column(f.URLColumn, "url")
+	categoryColumn := column(f.CategoryColumn, "category")
+	descriptionColumn := column(f.DescriptionColumn, "description")
+	targetColumn := column(f.TargetColumn, "target")
+
+	if domainColumn < 0 && urlColumn < 0 {
+		return nil, errors.New("no domain or url column")
+	}
+
+	field := func(record []string, i int) string {
+		if i < 0 || i >= len(record) {
+			return ""
+		}
+
+		return strings.TrimSpace(record[i])
+	}
+
+	entries := []FeedEntry{}
+
+	for {
+		record, err := records.Read()
+
+		if err == io.EOF {
+			break
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		entryCategory := category
+		switch value := Category(strings.ToLower(field(record, categoryColumn))); value {
+		case CategorySafe, CategoryPhishing, CategoryMalware:
+			entryCategory = value
+		}
+
+		name := field(record, urlColumn)
+		if name == "" {
+			name = field(record, domainColumn)
+		}
+
+		entry, ok := newFeedEntry(name, entryCategory)
+
+		if !ok {
+			if invalid != nil {
+				invalid(name)
+			}
+			continue
+		}
+
+		entry.Description = field(record, descriptionColumn)
+		entry.Target = field(record, targetColumn)
+		entries = append(entries, entry)
+	}
+
+	return entries, nil
+}
+
+// Create a cache holding the entries of a feed
+// Entries already in the previous cache, which may be nil, keep the time they were first seen as Added.
+func newFeedCache(entries []FeedEntry, previous *domainCache, synced time.Time) *domainCache {
+	now := synced.Unix()
+	domains := map[string]Domain{}
+	urls := map[string]URL{}
+
+	for _, entry := range entries {
+		if entry.URL != "" {
+			urls[entry.URL] = URL{URL: entry.URL, Category: entry.Category, Description: entry.Description, Target: entry.Target, Added: now, Checked: now}
+		} else if entry.Domain != "" {
+			domains[entry.Domain] = Domain{Domain: entry.Domain, Category: entry.Category, Description: entry.Description, Target: entry.Target, Added: now, Checked: now}
+		}
+	}
+
+	if previous != nil {
+		// Feed caches are never changed once built, so they can be read without locking
+		for name, domain := range domains {
+			if old, ok := previous.domainIndex[name]; ok {
+				domain.Added = old.Added
+				domains[name] = domain
+			}
+		}
+
+		for name, url := range urls {
+			if old, ok := previous.urlIndex[name]; ok {
+				url.Added = old.Added
+				urls[name] = url
+			}
+		}
+	}
+
+	return &domainCache{
+		domainIndex:        domains,
+		urlIndex:           urls,
+		suffixIndex:        newSuffixIndexFromDomains(domains),
+		urlExpressionIndex: newURLExpressionIndex(urls),
+	}
+}
+
+// The entries of every feed other than FishFish, by feed name
+type feedCaches struct {
+	mx     sync.RWMutex
+	caches map[string]*domainCache
+	// When each feed was last fetched successfully
+	synced map[string]time.Time
+}
+
+// Names of FishFish and every feed, from the highest precedence to the lowest
+// Feeds not in FeedPrecedence come after the ones that are, FishFish first and then in the order they were configured.
+func (c *AutoSyncClient) feedOrder() []string {
+	order := []string{}
+	added := map[string]bool{}
+
+	add := func(name string) {
+		if !added[name] {
+			added[name] = true
+			order = append(order, name)
+		}
+	}
+
+	configured := map[string]bool{FeedNameFishFish: true}
+	for _, feed := range c.options.Feeds {
+		configured[feed.Name()] = true
+	}
+
+	for _, name := range c.options.FeedPrecedence {
+		if configured[name] {
+			add(name)
+		}
+	}
+
+	add(FeedNameFishFish)
+	for _, feed := range c.options.Feeds {
+		add(feed.Name())
+	}
+
+	return order
+}
+
+// Fetch every feed other than FishFish, keeping the previous entries of feeds that fail
+// Each fetch is limited to AutoSyncOptions.FeedTimeout.
+func (c *AutoSyncClient) SyncFeeds(ctx context.Context) error {
+	errs := []string{}
+
+	for _, feed := range c.options.Feeds {
+		fetchCtx, cancel := context.WithTimeout(ctx, c.options.FeedTimeout)
+		entries, err := feed.Fetch(fetchCtx)
+		cancel()
+
+		if err != nil {
+			errs = append(errs, err.Error())
+			continue
+		}
+
+		synced := time.Now()
+
+		c.feeds.mx.RLock()
+		previous := c.feeds.caches[feed.Name()]
+		c.feeds.mx.RUnlock()
+
+		cache := newFeedCache(entries, previous, synced)
+
+		c.feeds.mx.Lock()
+		c.feeds.caches[feed.Name()] = cache
+		c.feeds.synced[feed.Name()] = synced
+		c.feeds.mx.Unlock()
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("failed to sync feeds: %s", strings.Join(errs, "; "))
+	}
+
+	return nil
+}
+
+func (c *AutoSyncClient) feedLoop(ctx context.Context) {
+	ticker := time.NewTicker(c.options.FeedInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := c.SyncFeeds(ctx); err != nil && ctx.Err() == nil {
+				c.reportError(err)
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// Match the input against FishFish and every feed, setting the verdict from the feed with the highest precedence
+// and listing every feed that matched.
+// Verdicts based on a feed other than FishFish are as of that feed's last fetch.
+func (c *AutoSyncClient) checkFeeds(verdict *Verdict, parsed *canonicalURL) {
+	c.feeds.mx.RLock()
+	defer c.feeds.mx.RUnlock()
+
+	for _, name := range c.feedOrder() {
+		cache := &c.cache
+		if name != FeedNameFishFish {
+			cache = c.feeds.caches[name]
+		}
+
+		if cache == nil {
+			continue
+		}
+
+		matched := false
+
+		if parsed != nil {
+			if match, ok := cache.matchURL(parsed); ok {
+				matched = true
+
+				if !verdict.Known && match.URL != nil {
+					verdict.setURL(*match.URL, match.MatchType)
+				} else if !verdict.Known {
+					verdict.setDomain(match.Domain.Domain, match.Domain.MatchType)
+				}
+			}
+		} else if match, ok := cache.matchDomain(verdict.Host); ok {
+			matched = true
+
+			if !verdict.Known {
+				verdict.setDomain(match.Domain, match.MatchType)
+			}
+		}
+
+		if matched {
+			verdict.Feeds = append(verdict.Feeds, name)
+
+			if len(verdict.Feeds) == 1 && name != FeedNameFishFish {
+				verdict.AsOf = c.feeds.synced[name]
+			}
+		}
+	}
+}
@@ -0,0 +1,166 @@
+package fishfish_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/existagon/fishfish-go"
+)
+
+func TestTextFeedFormats(t *testing.T) {
+	dir := t.TempDir()
+	hostsPath := filepath.Join(dir, "hosts")
+	listPath := filepath.Join(dir, "list.txt")
+
+	mustPanic(os.WriteFile(hostsPath, []byte("# blocklist\n127.0.0.1 localhost\n0.0.0.0 evil.com www.evil.com # comment\n::1 ip6-localhost\nbare.example\n"), 0644))
+	mustPanic(os.WriteFile(listPath, []byte("! list\nscam[.]example\nhxxps://sites.example/scam\n\nnot a domain\n"), 0644))
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "Domain,URL,Category,Description\nmalware.example,,malware,dropper\n,https://sites.example/phish,,\nok.example,,safe,\n")
+	}))
+	t.Cleanup(server.Close)
+
+	tests := []struct {
+		feed     *fishfish.TextFeed
+		expected []fishfish.FeedEntry
+	}{
+		{fishfish.NewTextFeed("hosts", hostsPath, fishfish.FeedFormatHosts), []fishfish.FeedEntry{
+			{Domain: "evil.com", Category: fishfish.CategoryPhishing},
+			{Domain: "www.evil.com", Category: fishfish.CategoryPhishing},
+			{Domain: "bare.example", Category: fishfish.CategoryPhishing},
+		}},
+		{fishfish.NewTextFeed("list", listPath, fishfish.FeedFormatList), []fishfish.FeedEntry{
+			{Domain: "scam.example", Category: fishfish.CategoryPhishing},
+			{URL: "https://sites.example/scam", Category: fishfish.CategoryPhishing},
+		}},
+		{fishfish.NewTextFeed("csv", server.URL, fishfish.FeedFormatCSV), []fishfish.FeedEntry{
+			{Domain: "malware.example", Category: fishfish.CategoryMalware, Description: "dropper"},
+			{URL: "https://sites.example/phish", Category: fishfish.CategoryPhishing},
+			{Domain: "ok.example", Category: fishfish.CategorySafe},
+		}},
+	}
+
+	for _, test := range tests {
+		entries, err := test.feed.Fetch(context.Background())
+		mustPanic(err)
+
+		if !reflect.DeepEqual(entries, test.expected) {
+			panic(fmt.Errorf("%s: expected %+v, got %+v", test.feed.Name(), test.expected, entries))
+		}
+	}
+
+	if _, err := fishfish.NewTextFeed("missing", filepath.Join(dir, "missing"), fishfish.FeedFormatList).Fetch(context.Background()); err == nil {
+		panic(fmt.Errorf("expected an error for a missing file"))
+	}
+}
+
+func TestAutoSyncFeeds(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "list.txt")
+	mustPanic(os.WriteFile(path, []byte("steamcommunity-gift.ru\nprivate-scam.example\n"), 0644))
+
+	safe := fishfish.NewTextFeed("internal", path, fishfish.FeedFormatList)
+	safe.Category = fishfish.CategorySafe
+	scams := fishfish.NewTextFeed("scams", path, fishfish.FeedFormatList)
+
+	client, err := fishfish.NewAutoSyncWithOptions("", []fishfish.APIPermission{}, fishfish.AutoSyncOptions{
+		Feeds:          []fishfish.Feed{scams, safe},
+		FeedPrecedence: []string{"internal"},
+	})
+	mustPanic(err)
+
+	mustPanic(client.ApplyEvent(fishfish.WSEvent{Type: fishfish.WSEventTypeDomainCreate, Data: fishfish.WSCreateDomainData{
+		Domain:   "steamcommunity-gift.ru",
+		Category: fishfish.CategoryPhishing,
+	}}))
+	mustPanic(client.SyncFeeds(context.Background()))
+
+	verdict := client.Check(context.Background(), "login.steamcommunity-gift.ru")
+	if !verdict.Safe() || !reflect.DeepEqual(verdict.Feeds, []string{"internal", fishfish.FeedNameFishFish, "scams"}) {
+		panic(fmt.Errorf("expected the internal feed to take precedence, got %+v", verdict))
+	}
+
+	if status := client.Status(); status.Feeds["internal"] != 2 || status.Feeds["scams"] != 2 {
+		panic(fmt.Errorf("unexpected feed status %+v", status.Feeds))
+	}
+
+	if _, err := fishfish.NewAutoSyncWithOptions("", []fishfish.APIPermission{}, fishfish.AutoSyncOptions{
+		Feeds: []fishfish.Feed{scams, scams},
+	}); err == nil {
+		panic(fmt.Errorf("expected an error for duplicate feed names"))
+	}
+
+	// Without FeedPrecedence, FishFish comes first
+	client, err = fishfish.NewAutoSyncWithOptions("", []fishfish.APIPermission{}, fishfish.AutoSyncOptions{
+		Feeds: []fishfish.Feed{safe},
+	})
+	mustPanic(err)
+	mustPanic(client.SyncFeeds(context.Background()))
+
+	if verdict := client.Check(context.Background(), "private-scam.example"); !verdict.Safe() || !reflect.DeepEqual(verdict.Feeds, []string{"internal"}) {
+		panic(fmt.Errorf("expected only the internal feed to list it, got %+v", verdict))
+	}
+}
+
+// A feed that returns the entries it holds, or blocks until its context is done if it has none
+type staticFeed struct {
+	entries []fishfish.FeedEntry
+}
+
+func (f *staticFeed) Name() string {
+	return "static"
+}
+
+func (f *staticFeed) Fetch(ctx context.Context) ([]fishfish.FeedEntry, error) {
+	if f.entries == nil {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+
+	return f.entries, nil
+}
+
+func TestAutoSyncFeedTimes(t *testing.T) {
+	feed := &staticFeed{entries: []fishfish.FeedEntry{{Domain: "scam.example", Category: fishfish.CategoryPhishing}}}
+
+	client, err := fishfish.NewAutoSyncWithOptions("", []fishfish.APIPermission{}, fishfish.AutoSyncOptions{
+		Feeds:       []fishfish.Feed{feed},
+		FeedTimeout: time.Millisecond * 50,
+	})
+	mustPanic(err)
+
+	started := time.Now()
+	mustPanic(client.SyncFeeds(context.Background()))
+
+	// FishFish was never synced, the verdict is as of the feed's fetch
+	first := client.Check(context.Background(), "scam.example")
+	if first.Domain == nil || first.AsOf.Before(started) || first.AsOf.After(time.Now()) {
+		panic(fmt.Errorf("expected the verdict to be as of the feed sync, got %+v", first))
+	}
+
+	// Added is kept from the first fetch listing the entry, Checked is updated
+	time.Sleep(time.Millisecond * 1100)
+	mustPanic(client.SyncFeeds(context.Background()))
+
+	second := client.Check(context.Background(), "scam.example")
+	if second.Domain.Added != first.Domain.Added || second.Domain.Checked <= first.Domain.Checked {
+		panic(fmt.Errorf("expected the first seen time to be kept, got %+v then %+v", first.Domain, second.Domain))
+	}
+
+	// Fetches that hang are cancelled, keeping the previous entries
+	feed.entries = nil
+
+	if err := client.SyncFeeds(context.Background()); err == nil {
+		panic("expected the hanging fetch to time out")
+	}
+
+	if verdict := client.Check(context.Background(), "scam.example"); !verdict.Known {
+		panic(fmt.Errorf("expected the previous entries to be kept, got %+v", verdict))
+	}
+}
@@ -0,0 +1,334 @@
+package fishfish
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"net"
+	"strings"
+	"time"
+)
+
+type StorageMode string
+
+const (
+	// Keep every domain and url in memory, the default
+	StorageModeFull = "full"
+	// Keep only a counting Bloom filter of phishing and malware domains, confirming matches with the API
+	StorageModeFilter = "filter"
+)
+
+const (
+	defaultFilterFalsePositiveRate = 0.001
+	// Leave room for domains added by events between full syncs
+	filterCapacityHeadroom = 2
+	minFilterCapacity      = 1024
+	// Counters are 4 bits, once saturated they are never decremented
+	maxFilterCounter = 15
+)
+
+// A Bloom filter with 4-bit counters instead of bits, so entries can be removed
+// Removing an entry that was never added can cause false negatives, which is why AutoSync only removes entries
+// the filter reports as possibly present and rebuilds the filter on every full sync.
+type CountingBloomFilter struct {
+	// Two counters per byte
+	counters []byte
+	size     uint64
+	hashes   int
+	entries  int
+}
+
+// Create a filter sized so that it has the specified false positive rate once it holds capacity entries
+func NewCountingBloomFilter(capacity int, falsePositiveRate float64) (*CountingBloomFilter, error) {
+	if capacity <= 0 {
+		return nil, errors.New("filter capacity must be positive")
+	}
+	if falsePositiveRate <= 0 || falsePositiveRate >= 1 {
+		return nil, errors.New("filter false positive rate must be between 0 and 1")
+	}
+
+	size := math.Ceil(-float64(capacity) * math.Log(falsePositiveRate) / (math.Ln2 * math.Ln2))
+	hashes := int(math.Round(size / float64(capacity) * math.Ln2))
+	if hashes < 1 {
+		hashes = 1
+	}
+
+	filter := CountingBloomFilter{
+		counters: make([]byte, (uint64(size)+1)/2),
+		size:     uint64(size),
+		hashes:   hashes,
+	}
+
+	return &filter, nil
+}
+
+// Positions of the counters for an entry, using double hashing
+func (f *CountingBloomFilter) positions(entry string) []uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(entry))
+	sum := h.Sum64()
+
+	h1, h2 := sum&0xffffffff, sum>>32|1
+	positions := make([]uint64, f.hashes)
+
+	for i := range positions {
+		positions[i] = (h1 + uint64(i)*h2) % f.size
+	}
+
+	return positions
+}
+
+func (f *CountingBloomFilter) counter(position uint64) byte {
+	return f.counters[position/2] >> (4 * (position % 2)) & 0xf
+}
+
+func (f *CountingBloomFilter) setCounter(position uint64, value byte) {
+	shift := 4 * (position % 2)
+	f.counters[position/2] = f.counters[position/2]&^(0xf<<shift) | value<<shift
+}
+
+func (f *CountingBloomFilter) Add(entry string) {
+	for _, position := range f.positions(entry) {
+		if value := f.counter(position); value < maxFilterCounter {
+			f.setCounter(position, value+1)
+		}
+	}
+
+	f.entries++
+}
+
+// Remove an entry that was previously added
+func (f *CountingBloomFilter) Remove(entry string) {
+	positions := f.positions(entry)
+
+	for _, position := range positions {
+		if f.counter(position) == 0 {
+			return
+		}
+	}
+
+	for _, position := range positions {
+		if value := f.counter(position); value < maxFilterCounter {
+			f.setCounter(position, value-1)
+		}
+	}
+
+	f.entries--
+}
+
+// Whether the entry may have been added, false means it definitely hasn't
+func (f *CountingBloomFilter) MayContain(entry string) bool {
+	for _, position := range f.positions(entry) {
+		if f.counter(position) == 0 {
+			return false
+		}
+	}
+
+	return true
+}
+
+// The number of entries added and not removed
+func (f *CountingBloomFilter) Len() int {
+	return f.entries
+}
+
+// The memory used by the counters in bytes
+func (f *CountingBloomFilter) SizeBytes() int {
+	return len(f.counters)
+}
+
+func isMaliciousCategory(category Category) bool {
+	return category == CategoryPhishing || category == CategoryMalware
+}
+
+// Build a filter of the phishing and malware domains in a snapshot
+func (c *AutoSyncClient) newDomainFilter(domains map[string]Domain) (*CountingBloomFilter, error) {
+	malicious := []string{}
+
+	for name, domain := range domains {
+		if isMaliciousCategory(domain.Category) {
+			malicious = append(malicious, name)
+		}
+	}
+
+	capacity := len(malicious) * filterCapacityHeadroom
+	if c.options.FilterCapacity > capacity {
+		capacity = c.options.FilterCapacity
+	}
+	if capacity < minFilterCapacity {
+		capacity = minFilterCapacity
+	}
+
+	filter, err := NewCountingBloomFilter(capacity, c.options.FilterFalsePositiveRate)
+
+	if err != nil {
+		return nil, err
+	}
+
+	for _, name := range malicious {
+		filter.Add(name)
+	}
+
+	return filter, nil
+}
+
+// Apply a domain event to the filter, url events are ignored
+// Names are only removed if an event added them, a name from a full sync can share every counter with others and
+// removing it could make them stop matching. Those stay in the filter until the next full sync.
+// Must be called with the cache locked
+func (c *domainCache) applyFilterEvent(event WSEvent) error {
+	switch event.Type {
+	case WSEventTypeDomainCreate:
+		createData, err := decodeEventData[WSCreateDomainData](event.Data)
+
+		if err != nil {
+			return err
+		}
+
+		if isMaliciousCategory(createData.Category) {
+			c.addToFilter(createData.Domain)
+		}
+	case WSEventTypeDomainUpdate:
+		updateData, err := decodeEventData[WSUpdateDomainData](event.Data)
+
+		if err != nil {
+			return err
+		}
+
+		// Updates without a category don't change whether the domain is malicious
+		if updateData.Category == "" {
+			break
+		}
+
+		if !isMaliciousCategory(updateData.Category) {
+			c.removeFromFilter(updateData.Domain)
+		} else if c.filterAdded[updateData.Domain] == 0 {
+			// May already be in the filter from the full sync, adding it again only risks a false positive
+			c.addToFilter(updateData.Domain)
+		}
+	case WSEventTypeDomainDelete:
+		deleteData, err := decodeEventData[WSDeleteDomainData](event.Data)
+
+		if err != nil {
+			return err
+		}
+
+		c.removeFromFilter(deleteData.Domain)
+	case WSEventTypeURLCreate, WSEventTypeURLUpdate, WSEventTypeURLDelete:
+	default:
+		return fmt.Errorf("unknown event type: %s", event.Type)
+	}
+
+	return nil
+}
+
+// Must be called with the cache locked
+func (c *domainCache) addToFilter(name string) {
+	c.filter.Add(name)
+	c.filterAdded[name]++
+}
+
+// Remove every addition of a name by events, names that weren't added by events are left alone
+// Must be called with the cache locked
+func (c *domainCache) removeFromFilter(name string) {
+	for ; c.filterAdded[name] > 0; c.filterAdded[name]-- {
+		c.filter.Remove(name)
+	}
+
+	delete(c.filterAdded, name)
+}
+
+// Whether a host or one of its parent domains may be listed as phishing or malware, without contacting the API
+// Only available in filter storage mode, a false result means the host definitely isn't listed as of the last update.
+func (c *AutoSyncClient) MaybeMalicious(host string) (bool, error) {
+	if c.options.Storage != StorageModeFilter {
+		return false, errors.New("only available in filter storage mode")
+	}
+
+	candidates, err := filterCandidates(host)
+
+	if err != nil {
+		return false, err
+	}
+
+	return len(c.filterMatches(candidates)) > 0, nil
+}
+
+// The host and its parent domains down to the registrable domain
+func filterCandidates(host string) ([]string, error) {
+	host, err := canonicalHost(normalizeHost(host))
+
+	if err != nil {
+		return nil, err
+	}
+
+	// IP addresses have no parent domains
+	if net.ParseIP(host) != nil {
+		return []string{host}, nil
+	}
+
+	labels := strings.Split(host, ".")
+	suffixLen, _ := DefaultPublicSuffixList().suffixLabels(labels)
+	candidates := []string{}
+
+	for i := 0; i < len(labels)-suffixLen || i == 0; i++ {
+		candidates = append(candidates, strings.Join(labels[i:], "."))
+	}
+
+	return candidates, nil
+}
+
+// The candidates that may be in the filter
+func (c *AutoSyncClient) filterMatches(candidates []string) []string {
+	c.cache.mx.RLock()
+	defer c.cache.mx.RUnlock()
+
+	matches := []string{}
+
+	if c.cache.filter == nil {
+		return matches
+	}
+
+	for _, candidate := range candidates {
+		if c.cache.filter.MayContain(candidate) {
+			matches = append(matches, candidate)
+		}
+	}
+
+	return matches
+}
+
+// Check a host against the filter, confirming possible matches with the API
+func (c *AutoSyncClient) checkFilter(ctx context.Context, verdict *Verdict) {
+	candidates, err := filterCandidates(verdict.Host)
+
+	if err != nil {
+		verdict.Error = fmt.Sprintf("invalid domain: %s", err)
+		return
+	}
+
+	for _, name := range c.filterMatches(candidates) {
+		domain, err := c.raw.getDomain(ctx, name)
+
+		if errors.Is(err, ErrNotFound) {
+			continue
+		}
+
+		if err != nil {
+			verdict.Error = fmt.Sprintf("failed to confirm filter match: %s", err)
+			return
+		}
+
+		matchType := MatchType(MatchTypeExact)
+		if name != verdict.Host {
+			matchType = MatchTypeParent
+		}
+
+		verdict.setDomain(*domain, matchType)
+		verdict.Source = VerdictSourceAPI
+		verdict.AsOf = time.Now()
+		return
+	}
+}
@@ -0,0 +1,162 @@
+package fishfish_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/existagon/fishfish-go"
+)
+
+func TestCountingBloomFilter(t *testing.T) {
+	filter, err := fishfish.NewCountingBloomFilter(1000, 0.01)
+	mustPanic(err)
+
+	for i := 0; i < 1000; i++ {
+		filter.Add(fmt.Sprintf("phish-%d.example", i))
+	}
+
+	for i := 0; i < 1000; i++ {
+		if !filter.MayContain(fmt.Sprintf("phish-%d.example", i)) {
+			panic(fmt.Errorf("false negative for phish-%d.example", i))
+		}
+	}
+
+	falsePositives := 0
+	for i := 0; i < 10000; i++ {
+		if filter.MayContain(fmt.Sprintf("safe-%d.example", i)) {
+			falsePositives++
+		}
+	}
+
+	if falsePositives > 300 {
+		panic(fmt.Errorf("too many false positives: %d of 10000", falsePositives))
+	}
+
+	filter.Remove("phish-1.example")
+	if filter.MayContain("phish-1.example") || filter.Len() != 999 {
+		panic(fmt.Errorf("expected phish-1.example to be removed"))
+	}
+
+	if _, err := fishfish.NewCountingBloomFilter(10, 1.5); err == nil {
+		panic(fmt.Errorf("expected an error for an invalid false positive rate"))
+	}
+}
+
+func TestAutoSyncFilterStorage(t *testing.T) {
+	api := newTestAPI(t, []fishfish.Domain{
+		{Domain: "steamcommunity-gift.ru", Category: fishfish.CategoryPhishing},
+		{Domain: "discord.com", Category: fishfish.CategorySafe},
+	}, nil)
+
+	client, err := fishfish.NewAutoSyncWithOptions("", []fishfish.APIPermission{}, fishfish.AutoSyncOptions{
+		APIURL:  api.URL,
+		Storage: fishfish.StorageModeFilter,
+	})
+	mustPanic(err)
+	mustPanic(client.ForceSync())
+
+	if len(client.GetDomains()) != 0 {
+		panic(fmt.Errorf("expected no domains to be kept in filter storage mode"))
+	}
+
+	if maybe, err := client.MaybeMalicious("login.steamcommunity-gift.ru"); err != nil || !maybe {
+		panic(fmt.Errorf("expected listed domain to be possibly malicious: %v", err))
+	}
+	if maybe, _ := client.MaybeMalicious("discord.com"); maybe {
+		panic(fmt.Errorf("expected safe domain not to be in the filter"))
+	}
+
+	verdict := client.Check(context.Background(), "https://login.steamcommunity-gift.ru/trade")
+	if !verdict.Malicious() || verdict.Source != fishfish.VerdictSourceAPI || verdict.MatchType != fishfish.MatchTypeParent {
+		panic(fmt.Errorf("expected a confirmed malicious verdict, got %+v", verdict))
+	}
+
+	// Domains added by events aren't known to the test API, so the match isn't confirmed
+	mustPanic(client.ApplyEvent(fishfish.WSEvent{Type: fishfish.WSEventTypeDomainCreate, Data: fishfish.WSCreateDomainData{
+		Domain:   "new-phish.example",
+		Category: fishfish.CategoryMalware,
+	}}))
+
+	if maybe, _ := client.MaybeMalicious("new-phish.example"); !maybe {
+		panic(fmt.Errorf("expected created domain to be possibly malicious"))
+	}
+	if verdict := client.Check(context.Background(), "new-phish.example"); verdict.Known {
+		panic(fmt.Errorf("expected unconfirmed match to be unknown, got %+v", verdict))
+	}
+
+	mustPanic(client.ApplyEvent(fishfish.WSEvent{Type: fishfish.WSEventTypeDomainDelete, Data: fishfish.WSDeleteDomainData{
+		Domain: "new-phish.example",
+	}}))
+
+	if maybe, _ := client.MaybeMalicious("new-phish.example"); maybe {
+		panic(fmt.Errorf("expected deleted domain to be removed from the filter"))
+	}
+
+	// IP addresses have no parent domains, so 2.3.4 doesn't match 1.2.3.4
+	mustPanic(client.ApplyEvent(fishfish.WSEvent{Type: fishfish.WSEventTypeDomainCreate, Data: fishfish.WSCreateDomainData{
+		Domain:   "2.3.4",
+		Category: fishfish.CategoryPhishing,
+	}}))
+
+	if maybe, _ := client.MaybeMalicious("1.2.3.4"); maybe {
+		panic(fmt.Errorf("expected an address not to match a suffix of it"))
+	}
+
+	if status := client.Status(); status.FilterEntries != 2 || status.FilterBytes == 0 {
+		panic(fmt.Errorf("unexpected filter status %+v", status))
+	}
+}
+
+func TestAutoSyncFilterCollisions(t *testing.T) {
+	api := newTestAPI(t, []fishfish.Domain{{Domain: "listed.example", Category: fishfish.CategoryPhishing}}, nil)
+
+	// A small filter, so another name easily shares every counter with the listed one
+	client, err := fishfish.NewAutoSyncWithOptions("", []fishfish.APIPermission{}, fishfish.AutoSyncOptions{
+		APIURL:                  api.URL,
+		Storage:                 fishfish.StorageModeFilter,
+		FilterFalsePositiveRate: 0.5,
+	})
+	mustPanic(err)
+	mustPanic(client.ForceSync())
+
+	colliding := ""
+	for i := 0; i < 1000000 && colliding == ""; i++ {
+		name := fmt.Sprintf("n%d.example", i)
+
+		if maybe, _ := client.MaybeMalicious(name); maybe {
+			colliding = name
+		}
+	}
+
+	if colliding == "" {
+		panic("no colliding name found")
+	}
+
+	event := func(eventType fishfish.WSEventType, data any) {
+		mustPanic(client.ApplyEvent(fishfish.WSEvent{Type: eventType, Data: data}))
+
+		if maybe, _ := client.MaybeMalicious("listed.example"); !maybe {
+			panic(fmt.Errorf("listed domain stopped matching after %s of %s", eventType, colliding))
+		}
+	}
+
+	// The colliding name was never added, so deleting it must not remove anything
+	event(fishfish.WSEventTypeDomainDelete, fishfish.WSDeleteDomainData{Domain: colliding})
+	event(fishfish.WSEventTypeDomainUpdate, fishfish.WSUpdateDomainData{Domain: colliding, Category: fishfish.CategorySafe})
+
+	// Created names are added even if the filter already seems to contain them, so they can be removed again
+	event(fishfish.WSEventTypeDomainCreate, fishfish.WSCreateDomainData{Domain: colliding, Category: fishfish.CategoryMalware})
+	event(fishfish.WSEventTypeDomainDelete, fishfish.WSDeleteDomainData{Domain: colliding})
+}
+
+func TestAutoSyncFilterRejectsFeeds(t *testing.T) {
+	_, err := fishfish.NewAutoSyncWithOptions("", []fishfish.APIPermission{}, fishfish.AutoSyncOptions{
+		Storage: fishfish.StorageModeFilter,
+		Feeds:   []fishfish.Feed{fishfish.NewTextFeed("extra", "list.txt", fishfish.FeedFormatList)},
+	})
+
+	if err == nil {
+		panic("expected feeds to be rejected in filter storage mode")
+	}
+}
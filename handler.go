@@ -0,0 +1,280 @@
+package fishfish
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Configuration for a lookup handler, zero values use the defaults
+type HandlerOptions struct {
+	// Maximum number of inputs of a batch check, defaults to 1000
+	MaxBatchSize int
+	// /status responds with 503 if the last successful sync is older than this, zero disables the check
+	MaxSyncAge time.Duration
+}
+
+const (
+	defaultMaxBatchSize = 1000
+	// Limits the size of batch check bodies, which are only a list of inputs
+	maxBatchBodyBytes = 16 << 20
+)
+
+// Checks a batch of inputs at once
+type BatchCheckRequest struct {
+	Inputs []string `json:"inputs"`
+}
+
+type BatchCheckResponse struct {
+	// One verdict per input, in the same order
+	Verdicts []Verdict `json:"verdicts"`
+}
+
+// Counts requests and verdicts for /metrics
+type handlerMetrics struct {
+	mx sync.Mutex
+	// By endpoint and status code
+	requests map[[2]string]uint64
+	// By verdict category, unknown for inputs that aren't listed and error for invalid ones
+	checks map[string]uint64
+}
+
+func (m *handlerMetrics) recordRequest(endpoint string, code int) {
+	m.mx.Lock()
+	defer m.mx.Unlock()
+
+	m.requests[[2]string{endpoint, fmt.Sprint(code)}]++
+}
+
+func (m *handlerMetrics) recordVerdict(verdict Verdict) {
+	result := string(verdict.Category)
+
+	switch {
+	case verdict.Error != "":
+		result = "error"
+	case !verdict.Known:
+		result = "unknown"
+	}
+
+	m.mx.Lock()
+	defer m.mx.Unlock()
+
+	m.checks[result]++
+}
+
+// An http.Handler answering lookups from the cache of an AutoSync client as JSON, so other services don't need their own cache
+//
+//	GET  /check?input=          Verdict of a domain, url or host
+//	POST /check                 Verdicts of a BatchCheckRequest
+//	GET  /match/domain?domain=  The listed domain matching a host, 404 if there is none
+//	GET  /match/url?url=        The listed url or domain matching a url, 404 if there is none
+//	GET  /status                The client's status, 503 until it is ready or loaded a snapshot, see HealthHandler
+//	GET  /metrics               Prometheus metrics
+//
+// The client must be started separately, e.g. with Run.
+func NewHandler(client *AutoSyncClient, options HandlerOptions) http.Handler {
+	if options.MaxBatchSize <= 0 {
+		options.MaxBatchSize = defaultMaxBatchSize
+	}
+
+	metrics := &handlerMetrics{requests: map[[2]string]uint64{}, checks: map[string]uint64{}}
+	mux := http.NewServeMux()
+
+	// fn returns the status code it responded with
+	handle := func(endpoint string, methods []string, fn func(w http.ResponseWriter, r *http.Request) int) {
+		mux.HandleFunc(endpoint, func(w http.ResponseWriter, r *http.Request) {
+			if !containsValue(methods, r.Method) {
+				w.Header().Set("Allow", strings.Join(methods, ", "))
+				metrics.recordRequest(endpoint, writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed"))
+				return
+			}
+
+			metrics.recordRequest(endpoint, fn(w, r))
+		})
+	}
+
+	handle("/check", []string{"GET", "POST"}, func(w http.ResponseWriter, r *http.Request) int {
+		if r.Method == "POST" {
+			return handleBatchCheck(w, r, client, options, metrics)
+		}
+
+		input := r.URL.Query().Get("input")
+
+		if input == "" {
+			return writeJSONError(w, http.StatusBadRequest, "missing input")
+		}
+
+		verdict := client.Check(r.Context(), input)
+		metrics.recordVerdict(verdict)
+
+		return writeJSON(w, http.StatusOK, verdict)
+	})
+
+	handle("/match/domain", []string{"GET"}, func(w http.ResponseWriter, r *http.Request) int {
+		host := r.URL.Query().Get("domain")
+
+		if host == "" {
+			return writeJSONError(w, http.StatusBadRequest, "missing domain")
+		}
+
+		// Only a host that isn't listed is a 404, like urls on /match/url
+		if verdict, _ := newVerdict(host); verdict.Kind != InputKindDomain || verdict.Error != "" || strings.ContainsAny(strings.TrimSpace(host), " \t") {
+			return writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("invalid domain: %s", host))
+		}
+
+		match, err := client.MatchDomain(host)
+
+		if err != nil {
+			return writeJSONError(w, http.StatusNotFound, err.Error())
+		}
+
+		return writeJSON(w, http.StatusOK, match)
+	})
+
+	handle("/match/url", []string{"GET"}, func(w http.ResponseWriter, r *http.Request) int {
+		raw := r.URL.Query().Get("url")
+
+		if _, err := parseCanonicalURL(raw); err != nil {
+			return writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("invalid url: %s", err))
+		}
+
+		match, err := client.MatchURL(raw)
+
+		if err != nil {
+			return writeJSONError(w, http.StatusNotFound, err.Error())
+		}
+
+		return writeJSON(w, http.StatusOK, match)
+	})
+
+	health := client.HealthHandler(options.MaxSyncAge)
+	handle("/status", []string{"GET"}, func(w http.ResponseWriter, r *http.Request) int {
+		recorder := &statusRecorder{ResponseWriter: w, code: http.StatusOK}
+		health.ServeHTTP(recorder, r)
+		return recorder.code
+	})
+
+	handle("/metrics", []string{"GET"}, func(w http.ResponseWriter, r *http.Request) int {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		writeMetrics(w, client.Status(), metrics)
+		return http.StatusOK
+	})
+
+	return mux
+}
+
+func handleBatchCheck(w http.ResponseWriter, r *http.Request, client *AutoSyncClient, options HandlerOptions, metrics *handlerMetrics) int {
+	request := BatchCheckRequest{}
+
+	if err := json.NewDecoder(io.LimitReader(r.Body, maxBatchBodyBytes)).Decode(&request); err != nil {
+		return writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("invalid request: %s", err))
+	}
+
+	if len(request.Inputs) > options.MaxBatchSize {
+		return writeJSONError(w, http.StatusRequestEntityTooLarge, fmt.Sprintf("at most %d inputs can be checked at once", options.MaxBatchSize))
+	}
+
+	response := BatchCheckResponse{Verdicts: make([]Verdict, 0, len(request.Inputs))}
+
+	for _, input := range request.Inputs {
+		verdict := client.Check(r.Context(), input)
+		metrics.recordVerdict(verdict)
+		response.Verdicts = append(response.Verdicts, verdict)
+	}
+
+	return writeJSON(w, http.StatusOK, response)
+}
+
+func writeJSON(w http.ResponseWriter, code int, value any) int {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(value)
+
+	return code
+}
+
+func writeJSONError(w http.ResponseWriter, code int, message string) int {
+	return writeJSON(w, code, map[string]string{"error": message})
+}
+
+// Records the status code written by a wrapped handler
+type statusRecorder struct {
+	http.ResponseWriter
+	code int
+}
+
+func (r *statusRecorder) WriteHeader(code int) {
+	r.code = code
+	r.ResponseWriter.WriteHeader(code)
+}
+
+func unixSeconds(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+
+	return t.Unix()
+}
+
+// Write the status and counters in the Prometheus text format, sorted so the output is stable
+func writeMetrics(w io.Writer, status AutoSyncStatus, metrics *handlerMetrics) {
+	boolValue := func(b bool) int {
+		if b {
+			return 1
+		}
+		return 0
+	}
+
+	gauge := func(name, help string, value any) {
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s gauge\n%s %v\n", name, help, name, name, value)
+	}
+
+	gauge("fishfish_ready", "Whether the initial sync has finished.", boolValue(status.Ready))
+	gauge("fishfish_stream_connected", "Whether the event source is connected.", boolValue(status.StreamConnected))
+	gauge("fishfish_last_sync_timestamp_seconds", "When the last full sync finished.", unixSeconds(status.LastSync))
+	gauge("fishfish_snapshot_generated_timestamp_seconds", "When the loaded snapshot was generated.", unixSeconds(status.SnapshotGenerated))
+	gauge("fishfish_last_event_timestamp_seconds", "When the last stream event was received.", unixSeconds(status.LastEvent))
+
+	fmt.Fprintln(w, "# HELP fishfish_entries Cached entries by kind and category.")
+	fmt.Fprintln(w, "# TYPE fishfish_entries gauge")
+	for _, category := range Categories {
+		fmt.Fprintf(w, "fishfish_entries{kind=\"domain\",category=%q} %d\n", category, status.Domains[category])
+	}
+	for _, category := range Categories {
+		fmt.Fprintf(w, "fishfish_entries{kind=\"url\",category=%q} %d\n", category, status.URLs[category])
+	}
+
+	if len(status.Feeds) > 0 {
+		fmt.Fprintln(w, "# HELP fishfish_feed_entries Entries of each feed other than FishFish.")
+		fmt.Fprintln(w, "# TYPE fishfish_feed_entries gauge")
+		for _, name := range sortedKeys(status.Feeds) {
+			fmt.Fprintf(w, "fishfish_feed_entries{feed=%q} %d\n", name, status.Feeds[name])
+		}
+	}
+
+	metrics.mx.Lock()
+	defer metrics.mx.Unlock()
+
+	requests := make([]string, 0, len(metrics.requests))
+	for key, count := range metrics.requests {
+		requests = append(requests, fmt.Sprintf("fishfish_http_requests_total{endpoint=%q,code=%q} %d", key[0], key[1], count))
+	}
+	sort.Strings(requests)
+
+	fmt.Fprintln(w, "# HELP fishfish_http_requests_total Requests by endpoint and status code.")
+	fmt.Fprintln(w, "# TYPE fishfish_http_requests_total counter")
+	if len(requests) > 0 {
+		fmt.Fprintln(w, strings.Join(requests, "\n"))
+	}
+
+	fmt.Fprintln(w, "# HELP fishfish_checks_total Checked inputs by verdict.")
+	fmt.Fprintln(w, "# TYPE fishfish_checks_total counter")
+	for _, result := range sortedKeys(metrics.checks) {
+		fmt.Fprintf(w, "fishfish_checks_total{verdict=%q} %d\n", result, metrics.checks[result])
+	}
+}
@@ -0,0 +1,94 @@
+package fishfish_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/existagon/fishfish-go"
+)
+
+func TestHandler(t *testing.T) {
+	client := newTestAutoSync([]fishfish.Domain{
+		{Domain: "phish.example", Category: fishfish.CategoryPhishing},
+	}, []fishfish.URL{
+		{URL: "https://sites.example/scam", Category: fishfish.CategoryMalware},
+	})
+
+	server := httptest.NewServer(fishfish.NewHandler(client, fishfish.HandlerOptions{MaxBatchSize: 2}))
+	t.Cleanup(server.Close)
+
+	request := func(method, path string, body string) (int, string) {
+		req, err := http.NewRequest(method, server.URL+path, strings.NewReader(body))
+		mustPanic(err)
+
+		res, err := http.DefaultClient.Do(req)
+		mustPanic(err)
+		defer res.Body.Close()
+
+		data, err := io.ReadAll(res.Body)
+		mustPanic(err)
+
+		return res.StatusCode, string(data)
+	}
+
+	tests := []struct {
+		method   string
+		path     string
+		body     string
+		code     int
+		contains string
+	}{
+		{"GET", "/check?input=" + url.QueryEscape("login.phish.example"), "", 200, `"category":"phishing"`},
+		{"GET", "/check", "", 400, "missing input"},
+		{"POST", "/check", `{"inputs": ["https://sites.example/scam?a=1", "ok.example"]}`, 200, `"category":"malware"`},
+		{"POST", "/check", `{"inputs": ["a.example", "b.example", "c.example"]}`, 413, "at most 2"},
+		{"POST", "/check", `{"inputs":`, 400, "invalid request"},
+		{"GET", "/match/domain?domain=sub.phish.example", "", 200, `"match_type":"parent"`},
+		{"GET", "/match/domain?domain=ok.example", "", 404, "no listed domain"},
+		{"GET", "/match/domain?domain=" + url.QueryEscape("not a domain"), "", 400, "invalid domain"},
+		{"GET", "/match/domain?domain=" + url.QueryEscape("https://phish.example/login"), "", 400, "invalid domain"},
+		{"GET", "/match/url?url=" + url.QueryEscape("https://sites.example/scam"), "", 200, `"match_type":"exact"`},
+		{"GET", "/match/url?url=", "", 400, "invalid url"},
+		{"DELETE", "/match/domain", "", 405, "method not allowed"},
+		// The client was never started, so it isn't ready
+		{"GET", "/status", "", 503, `"ready":false`},
+		{"GET", "/metrics", "", 200, `fishfish_entries{kind="domain",category="phishing"} 1`},
+	}
+
+	for _, test := range tests {
+		code, body := request(test.method, test.path, test.body)
+
+		if code != test.code || !strings.Contains(body, test.contains) {
+			panic(fmt.Errorf("%s %s: expected %d containing %q, got %d: %s", test.method, test.path, test.code, test.contains, code, body))
+		}
+	}
+
+	_, body := request("GET", "/metrics", "")
+
+	for _, expected := range []string{
+		`fishfish_http_requests_total{endpoint="/check",code="200"} 2`,
+		`fishfish_http_requests_total{endpoint="/status",code="503"} 1`,
+		`fishfish_checks_total{verdict="unknown"} 1`,
+		`fishfish_checks_total{verdict="malware"} 1`,
+	} {
+		if !strings.Contains(body, expected) {
+			panic(fmt.Errorf("expected metrics to contain %q, got:\n%s", expected, body))
+		}
+	}
+
+	// Verdicts of a batch are in the order of the inputs
+	_, body = request("POST", "/check", `{"inputs": ["ok.example", "phish.example"]}`)
+	response := fishfish.BatchCheckResponse{}
+	mustPanic(json.NewDecoder(bytes.NewBufferString(body)).Decode(&response))
+
+	if len(response.Verdicts) != 2 || response.Verdicts[0].Known || response.Verdicts[1].Category != fishfish.CategoryPhishing {
+		panic(fmt.Errorf("unexpected batch response %+v", response))
+	}
+}
@@ -0,0 +1,94 @@
+package fishfish
+
+import (
+	"sync"
+)
+
+// Detectors built from the safe domains and targets in the cache
+type heuristicsIndex struct {
+	mx sync.Mutex
+	// The protected generation of the cache the detectors were built from
+	generation uint64
+	built      bool
+	lookalike  *LookalikeDetector
+	typosquat  *TyposquatDetector
+}
+
+// Names that phishing domains imitate: safe domains, and the targets of listed domains and urls
+func (c *AutoSyncClient) protectedNames() ([]string, uint64) {
+	c.cache.mx.RLock()
+	defer c.cache.mx.RUnlock()
+
+	seen := map[string]bool{}
+	names := []string{}
+
+	add := func(name string) {
+		if name != "" && !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+
+	for name, domain := range c.cache.domainIndex {
+		if domain.Category == CategorySafe {
+			add(name)
+		}
+		add(domain.Target)
+	}
+
+	for _, url := range c.cache.urlIndex {
+		add(url.Target)
+	}
+
+	return names, c.cache.protectedGeneration
+}
+
+// What an entry contributes to the protected names
+type protection struct {
+	safe   bool
+	target string
+}
+
+func domainProtection(domain Domain) protection {
+	return protection{safe: domain.Category == CategorySafe, target: domain.Target}
+}
+
+// Must be called with the cache locked
+func (c *domainCache) updateProtected(before, after protection) {
+	if before != after {
+		c.protectedGeneration++
+	}
+}
+
+// Get the detectors, rebuilding them if the protected names changed since they were built
+func (c *AutoSyncClient) detectors() (*LookalikeDetector, *TyposquatDetector) {
+	c.cache.mx.RLock()
+	generation := c.cache.protectedGeneration
+	c.cache.mx.RUnlock()
+
+	c.heuristics.mx.Lock()
+	defer c.heuristics.mx.Unlock()
+
+	if !c.heuristics.built || c.heuristics.generation != generation {
+		names, generation := c.protectedNames()
+		c.heuristics.lookalike = NewLookalikeDetector(names)
+		c.heuristics.typosquat = NewTyposquatDetector(names)
+		c.heuristics.generation = generation
+		c.heuristics.built = true
+	}
+
+	return c.heuristics.lookalike, c.heuristics.typosquat
+}
+
+// Look for signs that an unknown host imitates a protected name, returning the most likely imitation
+func (c *AutoSyncClient) detectSuspicion(host string) (*Suspicion, bool) {
+	lookalike, typosquat := c.detectors()
+
+	suspicion, ok := lookalike.Detect(host)
+
+	if typo, typoOk := typosquat.Detect(host); typoOk && (!ok || typo.Score > suspicion.Score) {
+		return typo, true
+	}
+
+	return suspicion, ok
+}
@@ -0,0 +1,297 @@
+package fishfish
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+type ImportFormat string
+
+const (
+	// One domain or url per line
+	ImportFormatList = "list"
+	// A CSV file with a header row, see TextFeed for the columns
+	ImportFormatCSV = "csv"
+	// A PhishTank dump, either the JSON or the CSV export
+	ImportFormatPhishTank = "phishtank"
+	// An OpenPhish feed, one url per line
+	ImportFormatOpenPhish = "openphish"
+)
+
+type ImportOptions struct {
+	Format ImportFormat
+	// The category of entries that don't specify one, defaults to phishing
+	Category Category
+	// The description of entries that don't specify one
+	Description string
+	// Import the host of each url as a domain instead of the url itself
+	URLsAsDomains bool
+}
+
+// A PhishTank entry, only the fields that are imported
+type phishTankEntry struct {
+	URL    string `json:"url"`
+	Target string `json:"target"`
+}
+
+// Parse entries to import, returning the values that aren't a domain or url separately
+// Defanged entries are refanged.
+func ParseImport(reader io.Reader, options ImportOptions) ([]FeedEntry, []string, error) {
+	category := options.Category
+	if category == "" {
+		category = CategoryPhishing
+	}
+
+	invalid := []string{}
+	addInvalid := func(value string) {
+		invalid = append(invalid, value)
+	}
+
+	var entries []FeedEntry
+	var err error
+
+	switch options.Format {
+	case ImportFormatList, ImportFormatOpenPhish:
+		entries, err = parseListFeed(reader, category, addInvalid)
+	case ImportFormatCSV:
+		entries, err = (&TextFeed{}).parseCSV(reader, category, addInvalid)
+	case ImportFormatPhishTank:
+		entries, err = parsePhishTank(reader, category, addInvalid)
+	default:
+		err = fmt.Errorf("unknown import format: %s", options.Format)
+	}
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for i := range entries {
+		if entries[i].Description == "" {
+			entries[i].Description = options.Description
+		}
+
+		if options.URLsAsDomains && entries[i].URL != "" {
+			if parsed, err := parseCanonicalURL(entries[i].URL); err == nil {
+				entries[i].Domain, entries[i].URL = parsed.host, ""
+			}
+		}
+	}
+
+	return entries, invalid, nil
+}
+
+func parsePhishTank(reader io.Reader, category Category, invalid func(value string)) ([]FeedEntry, error) {
+	data, err := io.ReadAll(reader)
+
+	if err != nil {
+		return nil, err
+	}
+
+	// The CSV export starts with its header row
+	if trimmed := strings.TrimSpace(string(data)); !strings.HasPrefix(trimmed, "[") {
+		return (&TextFeed{}).parseCSV(strings.NewReader(trimmed), category, invalid)
+	}
+
+	phishes := []phishTankEntry{}
+
+	if err := json.Unmarshal(data, &phishes); err != nil {
+		return nil, fmt.Errorf("failed to parse phishtank dump: %s", err)
+	}
+
+	entries := []FeedEntry{}
+
+	for _, phish := range phishes {
+		entry, ok := newFeedEntry(phish.URL, category)
+
+		if !ok {
+			invalid(phish.URL)
+			continue
+		}
+
+		// PhishTank uses "Other" for phishes without a known target
+		if phish.Target != "Other" {
+			entry.Target = phish.Target
+		}
+
+		entries = append(entries, entry)
+	}
+
+	return entries, nil
+}
+
+// An imported entry that is already listed
+type ImportExisting struct {
+	Name string `json:"name"`
+	// The listed entry that covers it, which is the entry itself unless it is a parent domain or url prefix
+	ListedAs string   `json:"listed_as"`
+	Listed   Category `json:"listed"`
+	Imported Category `json:"imported"`
+}
+
+// What importing a batch of entries would submit, for review before it is submitted
+type ImportPlan struct {
+	// New entries to submit, domains by canonical name and urls as imported
+	// URLs are only canonicalized to find duplicates and listed entries, the first of each duplicate is submitted.
+	Domains map[string]CreateDomainRequest `json:"domains"`
+	URLs    map[string]CreateURLRequest    `json:"urls"`
+	// Entries already listed with the same category, or covered by a listed parent domain or url prefix
+	Unchanged []ImportExisting `json:"unchanged"`
+	// Entries already listed with another category, which submitting can't change
+	Conflicts []ImportExisting `json:"conflicts"`
+	// Values that aren't a domain or url
+	Invalid []string `json:"invalid"`
+	// Entries that appeared more than once in the batch
+	Duplicates int `json:"duplicates"`
+}
+
+// Canonicalize and deduplicate entries, then compare them against the cache
+// Entries are compared against FishFish data only, not other feeds or overrides.
+// In filter storage mode the cache holds no entries, so every entry is planned as new.
+func (c *AutoSyncClient) PlanImport(entries []FeedEntry, invalid []string) ImportPlan {
+	plan := ImportPlan{
+		Domains:   map[string]CreateDomainRequest{},
+		URLs:      map[string]CreateURLRequest{},
+		Unchanged: []ImportExisting{},
+		Conflicts: []ImportExisting{},
+		Invalid:   append([]string{}, invalid...),
+	}
+
+	seen := map[string]bool{}
+
+	for _, entry := range entries {
+		if entry.URL != "" {
+			parsed, err := parseCanonicalURL(entry.URL)
+
+			if err != nil {
+				plan.Invalid = append(plan.Invalid, entry.URL)
+				continue
+			}
+
+			// Submitted as imported, only the canonical form is used to find duplicates and listed entries
+			name, key := entry.URL, "url:"+parsed.String()
+
+			if seen[key] {
+				plan.Duplicates++
+				continue
+			}
+
+			seen[key] = true
+
+			if match, ok := c.cache.matchURL(parsed); ok {
+				var listedAs string
+				var listed Category
+
+				if match.URL != nil {
+					listedAs, listed = match.URL.URL, match.URL.Category
+				} else {
+					listedAs, listed = match.Domain.Domain.Domain, match.Domain.Domain.Category
+				}
+
+				// A url on a listed host is only covered by it, even if the host is listed exactly
+				if plan.addExisting(name, listedAs, listed, entry.Category, match.URL != nil && match.MatchType == MatchTypeExact) {
+					continue
+				}
+			}
+
+			plan.URLs[name] = CreateURLRequest{Category: entry.Category, Description: entry.Description, Target: entry.Target}
+			continue
+		}
+
+		name, err := canonicalHost(entry.Domain)
+
+		if err != nil || name == "" {
+			plan.Invalid = append(plan.Invalid, entry.Domain)
+			continue
+		}
+
+		if seen["domain:"+name] {
+			plan.Duplicates++
+			continue
+		}
+
+		seen["domain:"+name] = true
+
+		if match, ok := c.cache.matchDomain(name); ok {
+			if plan.addExisting(name, match.Domain.Domain, match.Domain.Category, entry.Category, match.MatchType == MatchTypeExact) {
+				continue
+			}
+		}
+
+		plan.Domains[name] = CreateDomainRequest{Category: entry.Category, Description: entry.Description, Target: entry.Target}
+	}
+
+	sort.Strings(plan.Invalid)
+	sort.Slice(plan.Unchanged, func(i, j int) bool { return plan.Unchanged[i].Name < plan.Unchanged[j].Name })
+	sort.Slice(plan.Conflicts, func(i, j int) bool { return plan.Conflicts[i].Name < plan.Conflicts[j].Name })
+
+	return plan
+}
+
+// Record an entry that is already listed, returning whether it shouldn't be submitted
+// Entries covered by a parent with another category are still submitted, e.g. a phishing page on a safe host.
+func (p *ImportPlan) addExisting(name, listedAs string, listed, imported Category, exact bool) bool {
+	existing := ImportExisting{Name: name, ListedAs: listedAs, Listed: listed, Imported: imported}
+
+	switch {
+	case listed == imported:
+		p.Unchanged = append(p.Unchanged, existing)
+		return true
+	case exact:
+		p.Conflicts = append(p.Conflicts, existing)
+		return true
+	}
+
+	return false
+}
+
+// A line per entry, sorted, for reviewing the plan before submitting it
+// + is submitted, = is already listed, ~ conflicts with a listed entry and ! is invalid.
+func (p ImportPlan) Diff() string {
+	var b strings.Builder
+
+	describe := func(category Category, description, target string) string {
+		details := string(category)
+		if target != "" {
+			details += ", target " + target
+		}
+		if description != "" {
+			details += fmt.Sprintf(", %q", description)
+		}
+		return details
+	}
+
+	for _, name := range sortedKeys(p.Domains) {
+		request := p.Domains[name]
+		fmt.Fprintf(&b, "+ domain %s (%s)\n", name, describe(request.Category, request.Description, request.Target))
+	}
+	for _, name := range sortedKeys(p.URLs) {
+		request := p.URLs[name]
+		fmt.Fprintf(&b, "+ url %s (%s)\n", name, describe(request.Category, request.Description, request.Target))
+	}
+	for _, existing := range p.Unchanged {
+		if existing.ListedAs == existing.Name {
+			fmt.Fprintf(&b, "= %s (already listed as %s)\n", existing.Name, existing.Listed)
+		} else {
+			fmt.Fprintf(&b, "= %s (covered by %s, listed as %s)\n", existing.Name, existing.ListedAs, existing.Listed)
+		}
+	}
+	for _, existing := range p.Conflicts {
+		fmt.Fprintf(&b, "~ %s (listed as %s, imported as %s)\n", existing.Name, existing.Listed, existing.Imported)
+	}
+	for _, value := range p.Invalid {
+		fmt.Fprintf(&b, "! %q (not a domain or url)\n", value)
+	}
+	if p.Duplicates > 0 {
+		fmt.Fprintf(&b, "%d duplicate entries skipped\n", p.Duplicates)
+	}
+
+	return b.String()
+}
+
+// Submit the new entries of the plan, see RawClient.AddDomains and RawClient.AddURLs
+func (p ImportPlan) Submit(client *RawClient) []BulkResult {
+	return append(client.AddDomains(p.Domains), client.AddURLs(p.URLs)...)
+}
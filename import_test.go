@@ -0,0 +1,148 @@
+package fishfish_test
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/existagon/fishfish-go"
+)
+
+func TestParseImportFormats(t *testing.T) {
+	tests := []struct {
+		options  fishfish.ImportOptions
+		input    string
+		expected []fishfish.FeedEntry
+		invalid  []string
+	}{
+		{
+			fishfish.ImportOptions{Format: fishfish.ImportFormatList, Description: "reported"},
+			"# reports\nscam[.]example\nhxxps://sites[.]example/scam\nnot a domain\n",
+			[]fishfish.FeedEntry{
+				{Domain: "scam.example", Category: fishfish.CategoryPhishing, Description: "reported"},
+				{URL: "https://sites.example/scam", Category: fishfish.CategoryPhishing, Description: "reported"},
+			},
+			[]string{"not a domain"},
+		},
+		{
+			fishfish.ImportOptions{Format: fishfish.ImportFormatCSV, Category: fishfish.CategoryMalware},
+			"domain,category,target\ndropper.example,,\nsteam.example,phishing,Steam\n",
+			[]fishfish.FeedEntry{
+				{Domain: "dropper.example", Category: fishfish.CategoryMalware},
+				{Domain: "steam.example", Category: fishfish.CategoryPhishing, Target: "Steam"},
+			},
+			[]string{},
+		},
+		{
+			fishfish.ImportOptions{Format: fishfish.ImportFormatPhishTank},
+			`[{"phish_id":"1","url":"https://steam-login.example/auth","target":"Steam"},{"phish_id":"2","url":"http://other.example/","target":"Other"},{"phish_id":"3","url":""}]`,
+			[]fishfish.FeedEntry{
+				{URL: "https://steam-login.example/auth", Category: fishfish.CategoryPhishing, Target: "Steam"},
+				{URL: "http://other.example/", Category: fishfish.CategoryPhishing},
+			},
+			[]string{""},
+		},
+		{
+			fishfish.ImportOptions{Format: fishfish.ImportFormatPhishTank},
+			"phish_id,url,phish_detail_url,target\n1,https://bank.example/login,https://phishtank.example/1,Bank\n",
+			[]fishfish.FeedEntry{
+				{URL: "https://bank.example/login", Category: fishfish.CategoryPhishing, Target: "Bank"},
+			},
+			[]string{},
+		},
+		{
+			fishfish.ImportOptions{Format: fishfish.ImportFormatOpenPhish, URLsAsDomains: true},
+			"https://Phish.Example/a\nhttps://phish.example/b\n",
+			[]fishfish.FeedEntry{
+				{Domain: "phish.example", Category: fishfish.CategoryPhishing},
+				{Domain: "phish.example", Category: fishfish.CategoryPhishing},
+			},
+			[]string{},
+		},
+	}
+
+	for _, test := range tests {
+		entries, invalid, err := fishfish.ParseImport(strings.NewReader(test.input), test.options)
+		mustPanic(err)
+
+		if !reflect.DeepEqual(entries, test.expected) {
+			panic(fmt.Errorf("%s: expected %+v, got %+v", test.options.Format, test.expected, entries))
+		}
+
+		if !reflect.DeepEqual(invalid, test.invalid) {
+			panic(fmt.Errorf("%s: expected invalid %q, got %q", test.options.Format, test.invalid, invalid))
+		}
+	}
+
+	if _, _, err := fishfish.ParseImport(strings.NewReader(""), fishfish.ImportOptions{Format: "xml"}); err == nil {
+		panic(fmt.Errorf("expected an error for an unknown format"))
+	}
+}
+
+func TestPlanImport(t *testing.T) {
+	client := newTestAutoSync([]fishfish.Domain{
+		{Domain: "listed.example", Category: fishfish.CategoryPhishing},
+		{Domain: "safe.example", Category: fishfish.CategorySafe},
+		{Domain: "malware.example", Category: fishfish.CategoryMalware},
+	}, []fishfish.URL{
+		{URL: "https://sites.example/scam", Category: fishfish.CategoryPhishing},
+	})
+
+	entries, invalid, err := fishfish.ParseImport(strings.NewReader(strings.Join([]string{
+		"new.example",
+		"NEW.example",
+		"listed.example",
+		"sub.listed.example",
+		"malware.example",
+		"https://sites.example/scam",
+		"https://safe.example/phish",
+		"hxxps://fresh[.]example/login",
+		"https://Fresh.example/login?utm_source=chat",
+		"https://Shop.example/item?id=1&utm_source=chat",
+		"not a domain",
+	}, "\n")), fishfish.ImportOptions{Format: fishfish.ImportFormatList, Description: "reported"})
+	mustPanic(err)
+
+	plan := client.PlanImport(entries, invalid)
+
+	expectedDomains := map[string]fishfish.CreateDomainRequest{
+		"new.example": {Category: fishfish.CategoryPhishing, Description: "reported"},
+	}
+	if !reflect.DeepEqual(plan.Domains, expectedDomains) {
+		panic(fmt.Errorf("expected domains %+v, got %+v", expectedDomains, plan.Domains))
+	}
+
+	expectedURLs := map[string]fishfish.CreateURLRequest{
+		"https://safe.example/phish":  {Category: fishfish.CategoryPhishing, Description: "reported"},
+		"https://fresh.example/login": {Category: fishfish.CategoryPhishing, Description: "reported"},
+		// Only canonicalized to find duplicates, urls are submitted as imported
+		"https://Shop.example/item?id=1&utm_source=chat": {Category: fishfish.CategoryPhishing, Description: "reported"},
+	}
+	if !reflect.DeepEqual(plan.URLs, expectedURLs) {
+		panic(fmt.Errorf("expected urls %+v, got %+v", expectedURLs, plan.URLs))
+	}
+
+	if plan.Duplicates != 2 || len(plan.Unchanged) != 3 || len(plan.Conflicts) != 1 || len(plan.Invalid) != 1 {
+		panic(fmt.Errorf("unexpected plan %+v", plan))
+	}
+
+	if plan.Conflicts[0].Name != "malware.example" || plan.Conflicts[0].Listed != fishfish.CategoryMalware {
+		panic(fmt.Errorf("unexpected conflict %+v", plan.Conflicts[0]))
+	}
+
+	expectedDiff := `+ domain new.example (phishing, "reported")
++ url https://Shop.example/item?id=1&utm_source=chat (phishing, "reported")
++ url https://fresh.example/login (phishing, "reported")
++ url https://safe.example/phish (phishing, "reported")
+= https://sites.example/scam (already listed as phishing)
+= listed.example (already listed as phishing)
+= sub.listed.example (covered by listed.example, listed as phishing)
+~ malware.example (listed as malware, imported as phishing)
+! "not a domain" (not a domain or url)
+2 duplicate entries skipped
+`
+	if diff := plan.Diff(); diff != expectedDiff {
+		panic(fmt.Errorf("expected diff:\n%s\ngot:\n%s", expectedDiff, diff))
+	}
+}
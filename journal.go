@@ -0,0 +1,252 @@
+package fishfish
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// A single event recorded in a Journal
+type JournalEntry struct {
+	// Sequence number of the entry, starting at 0 for the first event in the journal
+	Offset   int64     `json:"offset"`
+	Received time.Time `json:"received"`
+	Event    WSEvent   `json:"event"`
+}
+
+// An append-only, newline-delimited JSON log of stream events
+type Journal struct {
+	mx         sync.Mutex
+	path       string
+	file       *os.File
+	nextOffset int64
+}
+
+// Filters applied when replaying a journal
+// Zero values disable the respective filter
+type ReplayOptions struct {
+	// Only replay entries with an offset greater than or equal to FromOffset
+	FromOffset int64
+	// Only replay entries received at or after Since
+	Since time.Time
+	// Only replay entries received at or before Until, used for point-in-time rebuilds
+	Until time.Time
+}
+
+// Open or create a journal at the specified path
+// Entries are appended after any existing entries, a partially written trailing entry is discarded
+// An invalid entry before the end of the file is an error, the file is left untouched
+func OpenJournal(path string) (*Journal, error) {
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o644)
+
+	if err != nil {
+		return nil, fmt.Errorf("unable to open journal: %s", err)
+	}
+
+	journal := Journal{
+		path: path,
+		file: file,
+	}
+
+	// Find the next offset and the end of the last complete entry
+	var validSize int64
+	err = scanJournal(file, func(entry JournalEntry, end int64) error {
+		journal.nextOffset = entry.Offset + 1
+		validSize = end
+		return nil
+	})
+
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	// Drop a final line without a newline, e.g. from a crash mid-write
+	if err := file.Truncate(validSize); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("unable to truncate journal: %s", err)
+	}
+
+	if _, err := file.Seek(validSize, io.SeekStart); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("unable to seek journal: %s", err)
+	}
+
+	return &journal, nil
+}
+
+// Append an event to the journal with the current time as its receive time
+func (j *Journal) Append(event WSEvent) (*JournalEntry, error) {
+	return j.AppendAt(event, time.Now())
+}
+
+// Append an event to the journal with the specified receive time
+func (j *Journal) AppendAt(event WSEvent, received time.Time) (*JournalEntry, error) {
+	j.mx.Lock()
+	defer j.mx.Unlock()
+
+	if j.file == nil {
+		return nil, errors.New("journal is closed")
+	}
+
+	entry := JournalEntry{
+		Offset:   j.nextOffset,
+		Received: received.UTC(),
+		Event:    event,
+	}
+
+	line, err := json.Marshal(entry)
+
+	if err != nil {
+		return nil, fmt.Errorf("unable to marshal journal entry: %s", err)
+	}
+
+	if _, err := j.file.Write(append(line, '\n')); err != nil {
+		return nil, fmt.Errorf("unable to write journal entry: %s", err)
+	}
+
+	j.nextOffset++
+
+	return &entry, nil
+}
+
+// The offset that will be assigned to the next appended entry
+func (j *Journal) NextOffset() int64 {
+	j.mx.Lock()
+	defer j.mx.Unlock()
+
+	return j.nextOffset
+}
+
+// Flush the journal to stable storage
+func (j *Journal) Sync() error {
+	j.mx.Lock()
+	defer j.mx.Unlock()
+
+	if j.file == nil {
+		return errors.New("journal is closed")
+	}
+
+	return j.file.Sync()
+}
+
+func (j *Journal) Close() error {
+	j.mx.Lock()
+	defer j.mx.Unlock()
+
+	if j.file == nil {
+		return nil
+	}
+
+	err := j.file.Close()
+	j.file = nil
+
+	return err
+}
+
+// Call fn for every entry matching the options, in order
+// Replay stops at the first error returned by fn
+func (j *Journal) Replay(ctx context.Context, options ReplayOptions, fn func(JournalEntry) error) error {
+	return ReplayJournal(ctx, j.path, options, fn)
+}
+
+// Rebuild the cache of an AutoSyncClient by applying every matching entry
+// Replay stops at the first entry that can't be applied
+func (j *Journal) ReplayInto(ctx context.Context, options ReplayOptions, client *AutoSyncClient) error {
+	return j.Replay(ctx, options, func(entry JournalEntry) error {
+		if err := client.applyEvent(entry.Event, entry.Received); err != nil {
+			return fmt.Errorf("unable to apply journal entry %d: %s", entry.Offset, err)
+		}
+
+		return nil
+	})
+}
+
+// Send every matching event to the specified channel
+func (j *Journal) ReplayTo(ctx context.Context, options ReplayOptions, ch chan WSEvent) error {
+	return j.Replay(ctx, options, func(entry JournalEntry) error {
+		select {
+		case ch <- entry.Event:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	})
+}
+
+// Replay a journal file without opening it for writing
+func ReplayJournal(ctx context.Context, path string, options ReplayOptions, fn func(JournalEntry) error) error {
+	file, err := os.Open(path)
+
+	if err != nil {
+		return fmt.Errorf("unable to open journal: %s", err)
+	}
+
+	defer file.Close()
+
+	return scanJournal(file, func(entry JournalEntry, _ int64) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		if entry.Offset < options.FromOffset {
+			return nil
+		}
+		if !options.Since.IsZero() && entry.Received.Before(options.Since) {
+			return nil
+		}
+		if !options.Until.IsZero() && entry.Received.After(options.Until) {
+			// Entries are appended in receive order, nothing after this can match
+			return errStopScan
+		}
+
+		return fn(entry)
+	})
+}
+
+var errStopScan = errors.New("stop scan")
+
+// Read complete entries from the start of r, passing each one with the byte offset of its end
+// A final line without a newline is a torn write and ignored, any other invalid line is an error
+func scanJournal(r io.Reader, fn func(entry JournalEntry, end int64) error) error {
+	reader := bufio.NewReader(r)
+	var position int64
+
+	for {
+		line, err := reader.ReadBytes('\n')
+
+		if errors.Is(err, io.EOF) {
+			// Incomplete trailing line, or end of file
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("unable to read journal: %s", err)
+		}
+
+		position += int64(len(line))
+
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+
+		var entry JournalEntry
+		if err := json.Unmarshal(line, &entry); err != nil {
+			return fmt.Errorf("corrupt journal entry ending at byte %d: %s", position, err)
+		}
+
+		if err := fn(entry, position); err != nil {
+			if errors.Is(err, errStopScan) {
+				return nil
+			}
+
+			return err
+		}
+	}
+}
@@ -0,0 +1,108 @@
+package fishfish_test
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/existagon/fishfish-go"
+)
+
+func TestJournalReplay(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.jsonl")
+
+	journal, err := fishfish.OpenJournal(path)
+	mustPanic(err)
+
+	start := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	events := []fishfish.WSEvent{
+		{Type: fishfish.WSEventTypeDomainCreate, Data: fishfish.WSCreateDomainData{Domain: "phish.example", Category: fishfish.CategoryPhishing}},
+		{Type: fishfish.WSEventTypeDomainCreate, Data: fishfish.WSCreateDomainData{Domain: "safe.example", Category: fishfish.CategorySafe}},
+		{Type: fishfish.WSEventTypeDomainDelete, Data: fishfish.WSDeleteDomainData{Domain: "phish.example"}},
+	}
+
+	for i, event := range events {
+		_, err := journal.AppendAt(event, start.Add(time.Duration(i)*time.Hour))
+		mustPanic(err)
+	}
+
+	mustPanic(journal.Close())
+
+	// Simulate a crash in the middle of writing an entry
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0o644)
+	mustPanic(err)
+	_, err = file.WriteString(`{"offset":3,"rec`)
+	mustPanic(err)
+	file.Close()
+
+	journal, err = fishfish.OpenJournal(path)
+	mustPanic(err)
+	defer journal.Close()
+
+	if journal.NextOffset() != 3 {
+		panic(fmt.Errorf("expected next offset 3, got %d", journal.NextOffset()))
+	}
+
+	// Rebuild the state from before the delete
+	client, err := fishfish.NewAutoSync("", []fishfish.APIPermission{})
+	mustPanic(err)
+
+	err = journal.ReplayInto(context.Background(), fishfish.ReplayOptions{Until: start.Add(time.Hour)}, client)
+	mustPanic(err)
+
+	domain, err := client.GetDomain("phish.example")
+	mustPanic(err)
+
+	if domain.Category != fishfish.CategoryPhishing || domain.Added != start.Unix() {
+		panic(fmt.Errorf("unexpected replayed domain %v", domain))
+	}
+
+	var offsets []int64
+	err = journal.Replay(context.Background(), fishfish.ReplayOptions{FromOffset: 1}, func(entry fishfish.JournalEntry) error {
+		offsets = append(offsets, entry.Offset)
+		return nil
+	})
+	mustPanic(err)
+
+	if len(offsets) != 2 || offsets[0] != 1 || offsets[1] != 2 {
+		panic(fmt.Errorf("expected offsets [1 2], got %v", offsets))
+	}
+}
+
+func TestJournalCorruption(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.jsonl")
+	valid := `{"offset":0,"received":"2023-01-01T00:00:00Z","event":{"type":"domain_create","data":{"domain":"phish.example","category":"phishing"}}}` + "\n"
+	later := `{"offset":1,"received":"2023-01-01T01:00:00Z","event":{"type":"domain_create","data":{"domain":"malware.example","category":"malware"}}}` + "\n"
+	contents := valid + "not json\n" + later
+
+	mustPanic(os.WriteFile(path, []byte(contents), 0o644))
+
+	// A corrupt entry before the end isn't a torn write, so nothing may be truncated
+	if _, err := fishfish.OpenJournal(path); err == nil {
+		panic("expected an error opening a journal with a corrupt entry")
+	}
+
+	data, err := os.ReadFile(path)
+	mustPanic(err)
+
+	if string(data) != contents {
+		panic(fmt.Errorf("expected the journal to be left untouched, got %q", data))
+	}
+
+	// Entries that can't be applied stop ReplayInto
+	mustPanic(os.WriteFile(path, []byte(valid+`{"offset":1,"received":"2023-01-01T01:00:00Z","event":{"type":"domain_create","data":"oops"}}`+"\n"), 0o644))
+
+	journal, err := fishfish.OpenJournal(path)
+	mustPanic(err)
+	defer journal.Close()
+
+	client, err := fishfish.NewAutoSync("", []fishfish.APIPermission{})
+	mustPanic(err)
+
+	if err := journal.ReplayInto(context.Background(), fishfish.ReplayOptions{}, client); err == nil {
+		panic("expected an error replaying an entry that can't be applied")
+	}
+}
@@ -0,0 +1,208 @@
+package fishfish
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+type SuspicionKind string
+
+const (
+	// The domain uses look-alike characters to imitate a protected domain
+	SuspicionKindLookalike = "lookalike"
+)
+
+// Why an unlisted domain looks like it imitates a safe domain or target
+type Suspicion struct {
+	Kind SuspicionKind `json:"kind"`
+	// The safe domain or target being imitated
+	Of string `json:"of"`
+	// Confidence between 0 and 1
+	Score  float64 `json:"score"`
+	Reason string  `json:"reason"`
+}
+
+// Characters that look like an ASCII letter or digit, mapped to what they look like
+// A subset of the Unicode confusables data covering the scripts and symbols commonly used in phishing domains.
+var confusables = map[rune]string{
+	// Cyrillic
+	'а': "a", 'в': "b", 'е': "e", 'ё': "e", 'һ': "h", 'і': "i", 'ї': "i", 'ј': "j", 'к': "k",
+	'ӏ': "l", 'м': "m", 'н': "h", 'о': "o", 'р': "p", 'ԛ': "q", 'г': "r", 'ѕ': "s", 'т': "t",
+	'ц': "u", 'ѵ': "v", 'ԝ': "w", 'х': "x", 'у': "y", 'ү': "y", 'ԁ': "d", 'ɡ': "g", 'ь': "b",
+	// Greek
+	'α': "a", 'β': "b", 'ε': "e", 'η': "n", 'ι': "i", 'κ': "k", 'ν': "v", 'ο': "o", 'ρ': "p",
+	'τ': "t", 'υ': "u", 'χ': "x", 'γ': "y", 'ω': "w",
+	// Latin look-alikes and letters with diacritics
+	'ı': "i", 'ɩ': "i", 'ł': "l", 'ƚ': "l", 'ƅ': "b", 'ɑ': "a", 'ƍ': "g", 'ʀ': "r", 'ꜱ': "s",
+	'à': "a", 'á': "a", 'â': "a", 'ã': "a", 'ä': "a", 'å': "a", 'ā': "a", 'ą': "a",
+	'ç': "c", 'ć': "c", 'č': "c", 'ď': "d", 'đ': "d",
+	'è': "e", 'é': "e", 'ê': "e", 'ë': "e", 'ē': "e", 'ė': "e", 'ę': "e", 'ě': "e",
+	'ğ': "g", 'ģ': "g", 'ì': "i", 'í': "i", 'î': "i", 'ï': "i", 'ī': "i", 'į': "i",
+	'ķ': "k", 'ĺ': "l", 'ļ': "l", 'ľ': "l", 'ñ': "n", 'ń': "n", 'ņ': "n", 'ň': "n",
+	'ò': "o", 'ó': "o", 'ô': "o", 'õ': "o", 'ö': "o", 'ø': "o", 'ō': "o", 'ő': "o",
+	'ŕ': "r", 'ř': "r", 'ś': "s", 'ş': "s", 'š': "s", 'ţ': "t", 'ť': "t",
+	'ù': "u", 'ú': "u", 'û': "u", 'ü': "u", 'ū': "u", 'ů': "u", 'ű': "u", 'ų': "u",
+	'ý': "y", 'ÿ': "y", 'ź': "z", 'ż': "z", 'ž': "z",
+	// Digits and symbols
+	'0': "o", '1': "l", '|': "l",
+}
+
+// Letter sequences that look like a single letter
+var confusableSequences = strings.NewReplacer("rn", "m", "vv", "w")
+
+// Reduce a label to how it looks, so that labels which look the same have the same skeleton
+func skeleton(label string) string {
+	var b strings.Builder
+
+	for _, r := range strings.ToLower(label) {
+		// Fullwidth forms, e.g. ｄ
+		if r >= 0xff01 && r <= 0xff5e {
+			r = unicode.ToLower(r - 0xff01 + '!')
+		}
+
+		if mapped, ok := confusables[r]; ok {
+			b.WriteString(mapped)
+		} else {
+			b.WriteRune(r)
+		}
+	}
+
+	return confusableSequences.Replace(b.String())
+}
+
+// Whether a label mixes letters from Latin, Cyrillic and Greek
+func isMixedScript(label string) bool {
+	scripts := map[string]bool{}
+
+	for _, r := range label {
+		switch {
+		case unicode.Is(unicode.Latin, r):
+			scripts["latin"] = true
+		case unicode.Is(unicode.Cyrillic, r):
+			scripts["cyrillic"] = true
+		case unicode.Is(unicode.Greek, r):
+			scripts["greek"] = true
+		}
+	}
+
+	return len(scripts) > 1
+}
+
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= 0x80 {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Split a domain into its Unicode registrable domain, the label before the public suffix and the suffix
+func splitRegistrable(domain string) (string, string, string, error) {
+	unicodeDomain, err := DomainToUnicode(normalizeHost(domain))
+
+	if err != nil {
+		return "", "", "", err
+	}
+
+	registrable, err := EffectiveTLDPlusOne(unicodeDomain)
+
+	if err != nil {
+		return "", "", "", err
+	}
+
+	label, suffix, _ := strings.Cut(registrable, ".")
+
+	return registrable, label, suffix, nil
+}
+
+type protectedName struct {
+	// The registrable domain, empty for brand names
+	registrable string
+	label       string
+	suffix      string
+	// What to report as being imitated
+	name string
+}
+
+// Detects domains that use look-alike characters to imitate protected domains and brand names
+type LookalikeDetector struct {
+	// Protected names by the skeleton of their label
+	protected map[string][]protectedName
+}
+
+// Create a detector for the specified domains and brand names, e.g. discord.com or Discord
+func NewLookalikeDetector(protected []string) *LookalikeDetector {
+	detector := LookalikeDetector{protected: map[string][]protectedName{}}
+
+	for _, name := range protected {
+		name = strings.TrimSpace(name)
+		entry := protectedName{name: name}
+
+		if strings.Contains(name, ".") {
+			registrable, label, suffix, err := splitRegistrable(name)
+
+			if err != nil {
+				continue
+			}
+
+			entry.registrable, entry.label, entry.suffix = registrable, label, suffix
+		} else if name != "" {
+			entry.label = strings.ToLower(name)
+		} else {
+			continue
+		}
+
+		key := skeleton(entry.label)
+		detector.protected[key] = append(detector.protected[key], entry)
+	}
+
+	return &detector
+}
+
+// Check whether a domain imitates a protected name, returning the most likely imitation
+// Protected domains themselves are never reported.
+func (d *LookalikeDetector) Detect(domain string) (*Suspicion, bool) {
+	registrable, label, suffix, err := splitRegistrable(domain)
+
+	if err != nil {
+		return nil, false
+	}
+
+	var best *Suspicion
+
+	for _, protected := range d.protected[skeleton(label)] {
+		if protected.registrable == registrable {
+			return nil, false
+		}
+
+		// Same label under another suffix isn't a homograph, see TyposquatDetector
+		if protected.label == label {
+			continue
+		}
+
+		score := 0.8
+		if protected.suffix == "" || protected.suffix == suffix {
+			score += 0.1
+		}
+		if !isASCII(label) {
+			score += 0.05
+		}
+		if isMixedScript(label) {
+			score += 0.05
+		}
+
+		if best == nil || score > best.Score {
+			best = &Suspicion{
+				Kind:   SuspicionKindLookalike,
+				Of:     protected.name,
+				Score:  score,
+				Reason: fmt.Sprintf("%s looks like %s", registrable, protected.name),
+			}
+		}
+	}
+
+	return best, best != nil
+}
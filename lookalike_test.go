@@ -0,0 +1,97 @@
+package fishfish_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/existagon/fishfish-go"
+)
+
+func TestDomainToUnicode(t *testing.T) {
+	tests := map[string]string{
+		"xn--mnchen-3ya.de":      "münchen.de",
+		"www.xn--dscord-pvf.com": "www.dіscord.com",
+		"example.com":            "example.com",
+	}
+
+	for domain, expected := range tests {
+		decoded, err := fishfish.DomainToUnicode(domain)
+		mustPanic(err)
+
+		if decoded != expected {
+			panic(fmt.Errorf("%s: expected %s, got %s", domain, expected, decoded))
+		}
+	}
+
+	for expected, domain := range tests {
+		encoded, err := fishfish.DomainToASCII(domain)
+		mustPanic(err)
+
+		if encoded != expected {
+			panic(fmt.Errorf("%s: expected %s, got %s", domain, expected, encoded))
+		}
+	}
+
+	if _, err := fishfish.DomainToUnicode("xn--a-?.com"); err == nil {
+		panic(fmt.Errorf("expected an error for invalid punycode"))
+	}
+}
+
+func TestLookalikeDetector(t *testing.T) {
+	detector := fishfish.NewLookalikeDetector([]string{"discord.com", "PayPal"})
+
+	tests := map[string]string{
+		"xn--dscord-pvf.com":      "discord.com",
+		"login.xn--dscord-pvf.gg": "discord.com",
+		"disc0rd.com":             "discord.com",
+		"xn--aypal-uye.net":       "PayPal",
+		"paypa1.com":              "PayPal",
+	}
+
+	for domain, of := range tests {
+		suspicion, ok := detector.Detect(domain)
+
+		if !ok || suspicion.Of != of || suspicion.Kind != fishfish.SuspicionKindLookalike {
+			panic(fmt.Errorf("%s: expected lookalike of %s, got %+v", domain, of, suspicion))
+		}
+	}
+
+	for _, domain := range []string{"discord.com", "cdn.discord.com", "discord.gg", "example.com"} {
+		if suspicion, ok := detector.Detect(domain); ok {
+			panic(fmt.Errorf("%s: unexpected suspicion %+v", domain, suspicion))
+		}
+	}
+
+	punycode, _ := detector.Detect("xn--dscord-pvf.com")
+	digits, _ := detector.Detect("disc0rd.net")
+	if punycode.Score <= digits.Score || punycode.Score > 1 {
+		panic(fmt.Errorf("expected same-suffix punycode to score higher, got %f and %f", punycode.Score, digits.Score))
+	}
+}
+
+func TestAutoSyncCheckLookalike(t *testing.T) {
+	client := newTestAutoSync([]fishfish.Domain{
+		{Domain: "discord.com", Category: fishfish.CategorySafe},
+		{Domain: "steamcommunity-gift.ru", Category: fishfish.CategoryPhishing, Target: "steamcommunity.com"},
+	}, nil)
+
+	verdict := client.Check(context.Background(), "https://xn--dscord-pvf.com/nitro")
+	if !verdict.Suspicious() || verdict.Source != fishfish.VerdictSourceHeuristic || verdict.Suspicion.Of != "discord.com" {
+		panic(fmt.Errorf("expected a suspicious verdict, got %+v", verdict))
+	}
+
+	// Targets are protected too
+	if verdict := client.Check(context.Background(), "steamcornmunity.com"); !verdict.Suspicious() || verdict.Suspicion.Of != "steamcommunity.com" {
+		panic(fmt.Errorf("expected a lookalike of the target, got %+v", verdict))
+	}
+
+	mustPanic(client.ApplyEvent(fishfish.WSEvent{Type: fishfish.WSEventTypeDomainCreate, Data: fishfish.WSCreateDomainData{
+		Domain:   "xn--dscord-pvf.com",
+		Category: fishfish.CategoryPhishing,
+	}}))
+
+	if verdict := client.Check(context.Background(), "xn--dscord-pvf.com"); !verdict.Malicious() || verdict.Suspicion != nil {
+		panic(fmt.Errorf("expected listed domain to be malicious without suspicion, got %+v", verdict))
+	}
+}
@@ -0,0 +1,326 @@
+package fishfish
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+type OverrideMatch string
+
+const (
+	// The pattern is a host, e.g. evil.com
+	OverrideMatchExact = "exact"
+	// The pattern is a domain that also matches its subdomains, e.g. evil.com matches login.evil.com
+	OverrideMatchSuffix = "suffix"
+	// The pattern is a glob matched against the host, or the host and path if it contains a slash, e.g. *.evil.com
+	// or evil.com/*/login. See path.Match for the syntax.
+	OverrideMatchGlob = "glob"
+	// The pattern is a regular expression matched against the canonical url, or the host of domains
+	OverrideMatchRegex = "regex"
+)
+
+// How specific each kind of rule is, more specific rules take precedence
+var overrideMatchPriority = map[OverrideMatch]int{
+	OverrideMatchExact:  0,
+	OverrideMatchSuffix: 1,
+	OverrideMatchGlob:   2,
+	OverrideMatchRegex:  3,
+}
+
+// A local rule that takes precedence over FishFish data
+type Override struct {
+	Pattern  string        `json:"pattern"`
+	Match    OverrideMatch `json:"match"`
+	Category Category      `json:"category"`
+	Reason   string        `json:"reason,omitempty"`
+	Author   string        `json:"author,omitempty"`
+	Created  time.Time     `json:"created"`
+	// The rule is ignored after this time, nil never expires
+	Expires *time.Time `json:"expires,omitempty"`
+}
+
+// Whether the rule has expired at the specified time
+func (o Override) Expired(at time.Time) bool {
+	return o.Expires != nil && !at.Before(*o.Expires)
+}
+
+type compiledOverride struct {
+	Override
+	regex *regexp.Regexp
+}
+
+// A set of overrides, safe for concurrent use
+type Overrides struct {
+	mx    sync.RWMutex
+	rules []compiledOverride
+}
+
+func NewOverrides() *Overrides {
+	return &Overrides{rules: []compiledOverride{}}
+}
+
+// Load overrides from a JSON file containing a list of rules
+func LoadOverridesFile(path string) (*Overrides, error) {
+	data, err := os.ReadFile(path)
+
+	if err != nil {
+		return nil, err
+	}
+
+	rules := []Override{}
+
+	if err := json.Unmarshal(data, &rules); err != nil {
+		return nil, fmt.Errorf("failed to parse overrides: %s", err)
+	}
+
+	overrides := NewOverrides()
+
+	for _, rule := range rules {
+		if err := overrides.Add(rule); err != nil {
+			return nil, err
+		}
+	}
+
+	return overrides, nil
+}
+
+// Save the rules to a JSON file, replacing it atomically
+func (o *Overrides) Save(path string) error {
+	data, err := json.MarshalIndent(o.List(), "", "  ")
+
+	if err != nil {
+		return err
+	}
+
+	return writeFileAtomic(path, append(data, '\n'))
+}
+
+func compileOverride(rule Override) (compiledOverride, error) {
+	compiled := compiledOverride{Override: rule}
+
+	switch rule.Category {
+	case CategorySafe, CategoryPhishing, CategoryMalware:
+	default:
+		return compiled, fmt.Errorf("invalid override category: %s", rule.Category)
+	}
+
+	switch rule.Match {
+	case OverrideMatchExact, OverrideMatchSuffix:
+		host, err := canonicalHost(rule.Pattern)
+
+		if err != nil {
+			return compiled, fmt.Errorf("invalid override pattern %s: %s", rule.Pattern, err)
+		}
+
+		compiled.Pattern = host
+	case OverrideMatchGlob:
+		compiled.Pattern = strings.ToLower(Refang(strings.TrimSpace(rule.Pattern)))
+
+		if _, err := path.Match(compiled.Pattern, ""); err != nil {
+			return compiled, fmt.Errorf("invalid override pattern %s: %s", rule.Pattern, err)
+		}
+	case OverrideMatchRegex:
+		regex, err := regexp.Compile(rule.Pattern)
+
+		if err != nil {
+			return compiled, fmt.Errorf("invalid override pattern %s: %s", rule.Pattern, err)
+		}
+
+		compiled.regex = regex
+	default:
+		return compiled, fmt.Errorf("invalid override match: %s", rule.Match)
+	}
+
+	if compiled.Created.IsZero() {
+		compiled.Created = time.Now()
+	}
+
+	return compiled, nil
+}
+
+// Add a rule, replacing any rule with the same match and pattern
+func (o *Overrides) Add(rule Override) error {
+	compiled, err := compileOverride(rule)
+
+	if err != nil {
+		return err
+	}
+
+	o.mx.Lock()
+	defer o.mx.Unlock()
+
+	for i, existing := range o.rules {
+		if existing.Match == compiled.Match && existing.Pattern == compiled.Pattern {
+			o.rules[i] = compiled
+			return nil
+		}
+	}
+
+	o.rules = append(o.rules, compiled)
+
+	return nil
+}
+
+// Remove the rule with the specified match and pattern, returning whether it existed
+func (o *Overrides) Remove(match OverrideMatch, pattern string) bool {
+	// Patterns are stored normalized, so normalize the one to remove the same way
+	if compiled, err := compileOverride(Override{Pattern: pattern, Match: match, Category: CategorySafe}); err == nil {
+		pattern = compiled.Pattern
+	}
+
+	o.mx.Lock()
+	defer o.mx.Unlock()
+
+	for i, existing := range o.rules {
+		if existing.Match == match && existing.Pattern == pattern {
+			o.rules = append(o.rules[:i], o.rules[i+1:]...)
+			return true
+		}
+	}
+
+	return false
+}
+
+// Remove every rule that has expired, returning how many were removed
+func (o *Overrides) Prune() int {
+	o.mx.Lock()
+	defer o.mx.Unlock()
+
+	now := time.Now()
+	kept := o.rules[:0]
+
+	for _, rule := range o.rules {
+		if !rule.Expired(now) {
+			kept = append(kept, rule)
+		}
+	}
+
+	removed := len(o.rules) - len(kept)
+	o.rules = kept
+
+	return removed
+}
+
+// Every rule, including expired ones, in the order they were added
+func (o *Overrides) List() []Override {
+	o.mx.RLock()
+	defer o.mx.RUnlock()
+
+	rules := make([]Override, 0, len(o.rules))
+	for _, rule := range o.rules {
+		rules = append(rules, rule.Override)
+	}
+
+	return rules
+}
+
+func (r compiledOverride) matches(host string, url *canonicalURL) bool {
+	switch r.Match {
+	case OverrideMatchExact:
+		return host == r.Pattern
+	case OverrideMatchSuffix:
+		return host == r.Pattern || strings.HasSuffix(host, "."+r.Pattern)
+	case OverrideMatchGlob:
+		subject := host
+		if strings.Contains(r.Pattern, "/") {
+			if url == nil {
+				return false
+			}
+
+			subject = url.hostPort() + url.pathQuery()
+		}
+
+		matched, _ := path.Match(r.Pattern, subject)
+		return matched
+	case OverrideMatchRegex:
+		if url != nil {
+			return r.regex.MatchString(url.String())
+		}
+
+		return r.regex.MatchString(host)
+	}
+
+	return false
+}
+
+// Find the most specific unexpired rule that applies to a domain, url or bare host
+// Exact rules take precedence over suffix rules, then globs and regular expressions. Longer suffixes take precedence
+// over shorter ones, other ties go to the rule added first.
+func (o *Overrides) Lookup(input string) (*Override, bool) {
+	verdict, parsed := newVerdict(input)
+
+	if verdict.Error != "" {
+		return nil, false
+	}
+
+	return o.lookup(verdict.Host, parsed)
+}
+
+func (o *Overrides) lookup(host string, url *canonicalURL) (*Override, bool) {
+	o.mx.RLock()
+	defer o.mx.RUnlock()
+
+	now := time.Now()
+	matches := []compiledOverride{}
+
+	for _, rule := range o.rules {
+		if !rule.Expired(now) && rule.matches(host, url) {
+			matches = append(matches, rule)
+		}
+	}
+
+	if len(matches) == 0 {
+		return nil, false
+	}
+
+	sort.SliceStable(matches, func(i, j int) bool {
+		if pi, pj := overrideMatchPriority[matches[i].Match], overrideMatchPriority[matches[j].Match]; pi != pj {
+			return pi < pj
+		}
+
+		return matches[i].Match == OverrideMatchSuffix && len(matches[i].Pattern) > len(matches[j].Pattern)
+	})
+
+	best := matches[0].Override
+
+	return &best, true
+}
+
+// Replace the overrides that take precedence over synced data in Check, nil disables them
+func (c *AutoSyncClient) SetOverrides(overrides *Overrides) {
+	c.overrides.Store(overrides)
+}
+
+// The overrides that take precedence over synced data in Check, nil if there are none
+func (c *AutoSyncClient) Overrides() *Overrides {
+	return c.overrides.Load()
+}
+
+// Apply the first matching override to a verdict, returning whether one applied
+func (c *AutoSyncClient) applyOverrides(verdict *Verdict, parsed *canonicalURL) bool {
+	overrides := c.overrides.Load()
+
+	if overrides == nil {
+		return false
+	}
+
+	rule, ok := overrides.lookup(verdict.Host, parsed)
+
+	if !ok {
+		return false
+	}
+
+	verdict.Known = true
+	verdict.Category = rule.Category
+	verdict.Override = rule
+	verdict.Source = VerdictSourceOverride
+
+	return true
+}
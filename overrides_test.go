@@ -0,0 +1,116 @@
+package fishfish_test
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/existagon/fishfish-go"
+)
+
+func TestOverridesLookup(t *testing.T) {
+	overrides := fishfish.NewOverrides()
+	expired := time.Now().Add(-time.Minute)
+
+	rules := []fishfish.Override{
+		{Pattern: "evil.com", Match: fishfish.OverrideMatchSuffix, Category: fishfish.CategoryPhishing, Reason: "private report"},
+		{Pattern: "safe.evil.com", Match: fishfish.OverrideMatchSuffix, Category: fishfish.CategorySafe},
+		{Pattern: "Login.Evil.com", Match: fishfish.OverrideMatchExact, Category: fishfish.CategoryMalware},
+		{Pattern: "*.gift-*.ru", Match: fishfish.OverrideMatchGlob, Category: fishfish.CategoryPhishing},
+		{Pattern: "sites.example/*/scam", Match: fishfish.OverrideMatchGlob, Category: fishfish.CategoryMalware},
+		{Pattern: `^https://[^/]+/claim\?code=`, Match: fishfish.OverrideMatchRegex, Category: fishfish.CategoryPhishing},
+		{Pattern: "old.example", Match: fishfish.OverrideMatchExact, Category: fishfish.CategoryPhishing, Expires: &expired},
+	}
+
+	for _, rule := range rules {
+		mustPanic(overrides.Add(rule))
+	}
+
+	tests := map[string]fishfish.Category{
+		"evil.com":                           fishfish.CategoryPhishing,
+		"a.b.evil.com":                       fishfish.CategoryPhishing,
+		"cdn.safe.evil.com":                  fishfish.CategorySafe,
+		"login.evil[.]com":                   fishfish.CategoryMalware,
+		"steam.gift-cards.ru":                fishfish.CategoryPhishing,
+		"https://sites.example/u/scam":       fishfish.CategoryMalware,
+		"https://anything.test/claim?code=1": fishfish.CategoryPhishing,
+	}
+
+	for input, category := range tests {
+		rule, ok := overrides.Lookup(input)
+
+		if !ok || rule.Category != category {
+			panic(fmt.Errorf("%s: expected %s, got %+v", input, category, rule))
+		}
+	}
+
+	for _, input := range []string{"notevil.com", "old.example", "sites.example/scam", "gift-cards.ru"} {
+		if rule, ok := overrides.Lookup(input); ok {
+			panic(fmt.Errorf("%s: unexpected rule %+v", input, rule))
+		}
+	}
+
+	if err := overrides.Add(fishfish.Override{Pattern: "(", Match: fishfish.OverrideMatchRegex, Category: fishfish.CategorySafe}); err == nil {
+		panic(fmt.Errorf("expected an error for an invalid regex"))
+	}
+
+	if !overrides.Remove(fishfish.OverrideMatchExact, "LOGIN.evil.com") || overrides.Remove(fishfish.OverrideMatchExact, "login.evil.com") {
+		panic(fmt.Errorf("expected the rule to be removed once"))
+	}
+
+	if removed := overrides.Prune(); removed != 1 || len(overrides.List()) != 5 {
+		panic(fmt.Errorf("expected 1 expired rule to be pruned, got %d", removed))
+	}
+}
+
+func TestOverridesFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "overrides.json")
+	overrides := fishfish.NewOverrides()
+
+	mustPanic(overrides.Add(fishfish.Override{Pattern: "intranet.example", Match: fishfish.OverrideMatchSuffix, Category: fishfish.CategorySafe, Author: "security"}))
+	mustPanic(overrides.Save(path))
+
+	loaded, err := fishfish.LoadOverridesFile(path)
+	mustPanic(err)
+
+	if rules := loaded.List(); len(rules) != 1 || rules[0].Author != "security" || rules[0].Expires != nil {
+		panic(fmt.Errorf("unexpected rules %+v", rules))
+	}
+
+	mustPanic(os.WriteFile(path, []byte(`[{"pattern": "x", "match": "fuzzy", "category": "safe"}]`), 0644))
+
+	if _, err := fishfish.LoadOverridesFile(path); err == nil {
+		panic(fmt.Errorf("expected an error for an invalid match"))
+	}
+}
+
+func TestAutoSyncCheckOverrides(t *testing.T) {
+	client := newTestAutoSync([]fishfish.Domain{
+		{Domain: "steamcommunity-gift.ru", Category: fishfish.CategoryPhishing},
+	}, nil)
+
+	overrides := fishfish.NewOverrides()
+	mustPanic(overrides.Add(fishfish.Override{Pattern: "steamcommunity-gift.ru", Match: fishfish.OverrideMatchExact, Category: fishfish.CategorySafe, Reason: "false positive"}))
+	client.SetOverrides(overrides)
+
+	verdict := client.Check(context.Background(), "steamcommunity-gift.ru")
+	if !verdict.Safe() || verdict.Source != fishfish.VerdictSourceOverride || verdict.Override.Reason != "false positive" {
+		panic(fmt.Errorf("expected the override to take precedence, got %+v", verdict))
+	}
+
+	// Edits apply immediately
+	mustPanic(overrides.Add(fishfish.Override{Pattern: "private-scam.example", Match: fishfish.OverrideMatchSuffix, Category: fishfish.CategoryPhishing}))
+
+	if verdict := client.Check(context.Background(), "https://www.private-scam.example/"); !verdict.Malicious() || verdict.Source != fishfish.VerdictSourceOverride {
+		panic(fmt.Errorf("expected the new override to apply, got %+v", verdict))
+	}
+
+	client.SetOverrides(nil)
+
+	if verdict := client.Check(context.Background(), "steamcommunity-gift.ru"); !verdict.Malicious() || verdict.Source != fishfish.VerdictSourceCache {
+		panic(fmt.Errorf("expected the synced verdict without overrides, got %+v", verdict))
+	}
+}
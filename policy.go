@@ -0,0 +1,371 @@
+package fishfish
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// What a consumer should do about an input, consumers may define their own actions
+type Action string
+
+const (
+	ActionAllow  = "allow"
+	ActionFlag   = "flag"
+	ActionDelete = "delete"
+	ActionBan    = "ban"
+)
+
+// A rule of a policy, it applies to a verdict if every condition that is set holds
+// Verdicts with an error only match rules with Error set.
+type PolicyRule struct {
+	// Reported in explanations, defaults to the rule's position
+	Name string `json:"name,omitempty"`
+	// The verdict's category is one of these, which means the input is listed
+	Categories []Category `json:"categories,omitempty"`
+	// The input isn't listed, and isn't suspicious unless Suspicions is set too
+	Unknown bool `json:"unknown,omitempty"`
+	// The verdict's suspicion is one of these kinds, see Suspicion
+	Suspicions []SuspicionKind `json:"suspicions,omitempty"`
+	// Minimum score of the suspicion
+	MinScore float64 `json:"min_score,omitempty"`
+	// The verdict came from one of these sources
+	Sources []VerdictSource `json:"sources,omitempty"`
+	// At least one of these feeds lists the input, see FeedNameFishFish
+	Feeds []string `json:"feeds,omitempty"`
+	// Minimum number of feeds listing the input
+	MinFeeds int `json:"min_feeds,omitempty"`
+	// The input couldn't be checked, see Verdict.Error
+	Error bool `json:"error,omitempty"`
+	// What to do when the rule applies
+	Actions []Action `json:"actions"`
+}
+
+// Rules that are evaluated before the base rules for one tenant, e.g. a Discord guild
+type TenantPolicy struct {
+	Rules []PolicyRule `json:"rules"`
+	// Replaces the base default for this tenant
+	Default []Action `json:"default,omitempty"`
+}
+
+// Declarative mapping from verdicts to actions
+// Rules are evaluated in order and the first one that applies decides, tenant rules come before the base rules.
+type Policy struct {
+	Rules []PolicyRule `json:"rules"`
+	// Actions when no rule applies, defaults to allow
+	Default []Action                `json:"default,omitempty"`
+	Tenants map[string]TenantPolicy `json:"tenants,omitempty"`
+}
+
+// The outcome of evaluating a policy
+type Decision struct {
+	Actions []Action `json:"actions"`
+	// The rule that applied, empty if the default was used
+	Rule   string `json:"rule,omitempty"`
+	Tenant string `json:"tenant,omitempty"`
+	// A human readable reason for the actions
+	Explanation string `json:"explanation"`
+}
+
+// Whether the decision includes an action
+func (d Decision) Has(action Action) bool {
+	for _, a := range d.Actions {
+		if a == action {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Delete phishing, delete and ban for malware, flag suspicious lookalikes and allow everything else
+// Inputs that couldn't be checked are allowed too, add a rule with Error set to handle them otherwise.
+func DefaultPolicy() *Policy {
+	return &Policy{
+		Rules: []PolicyRule{
+			{Name: "malware", Categories: []Category{CategoryMalware}, Actions: []Action{ActionDelete, ActionBan}},
+			{Name: "phishing", Categories: []Category{CategoryPhishing}, Actions: []Action{ActionDelete}},
+			{Name: "safe", Categories: []Category{CategorySafe}, Actions: []Action{ActionAllow}},
+			{
+				Name:       "suspicious",
+				Suspicions: []SuspicionKind{SuspicionKindLookalike, SuspicionKindTyposquat, SuspicionKindCombosquat, SuspicionKindTLDSwap},
+				MinScore:   0.8,
+				Actions:    []Action{ActionFlag},
+			},
+		},
+		Default: []Action{ActionAllow},
+	}
+}
+
+// Parse a policy from JSON, unknown fields are rejected to catch typos
+// Policies are edited by hand, so // and /* */ comments and trailing commas are allowed.
+func ParsePolicy(data []byte) (*Policy, error) {
+	decoder := json.NewDecoder(bytes.NewReader(relaxedJSON(data)))
+	decoder.DisallowUnknownFields()
+
+	policy := Policy{}
+
+	if err := decoder.Decode(&policy); err != nil {
+		return nil, fmt.Errorf("failed to parse policy: %s", err)
+	}
+
+	if err := policy.Validate(); err != nil {
+		return nil, err
+	}
+
+	return &policy, nil
+}
+
+// Blank out comments and trailing commas, keeping every other byte in place so error offsets still match the input
+func relaxedJSON(data []byte) []byte {
+	out := append([]byte{}, data...)
+	inString := false
+	// Position of a comma that may turn out to be trailing, -1 if there is none
+	comma := -1
+
+	for i := 0; i < len(out); i++ {
+		c := out[i]
+
+		if inString {
+			switch c {
+			case '\\':
+				i++
+			case '"':
+				inString = false
+			}
+			continue
+		}
+
+		switch {
+		case c == '"':
+			inString = true
+			comma = -1
+		case c == ',':
+			comma = i
+		case c == '}' || c == ']':
+			if comma >= 0 {
+				out[comma] = ' '
+			}
+			comma = -1
+		case c == '/' && i+1 < len(out) && out[i+1] == '/':
+			for ; i < len(out) && out[i] != '\n'; i++ {
+				out[i] = ' '
+			}
+		case c == '/' && i+1 < len(out) && out[i+1] == '*':
+			end := bytes.Index(out[i+2:], []byte("*/"))
+			if end < 0 {
+				// Unterminated, left for the decoder to reject
+				return out
+			}
+
+			for j := i; j < i+end+4; j++ {
+				if out[j] != '\n' {
+					out[j] = ' '
+				}
+			}
+			i += end + 3
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+		default:
+			comma = -1
+		}
+	}
+
+	return out
+}
+
+func LoadPolicyFile(path string) (*Policy, error) {
+	data, err := os.ReadFile(path)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return ParsePolicy(data)
+}
+
+func validateRules(rules []PolicyRule) error {
+	for i, rule := range rules {
+		if len(rule.Actions) == 0 {
+			return fmt.Errorf("rule %s has no actions", rule.label(i))
+		}
+
+		for _, category := range rule.Categories {
+			switch category {
+			case CategorySafe, CategoryPhishing, CategoryMalware:
+			default:
+				return fmt.Errorf("rule %s has invalid category %s", rule.label(i), category)
+			}
+		}
+
+		if rule.Unknown && len(rule.Categories) > 0 {
+			return fmt.Errorf("rule %s can't match unknown inputs and categories", rule.label(i))
+		}
+
+		if rule.Error && (rule.Unknown || len(rule.Categories) > 0 || len(rule.Suspicions) > 0 || rule.MinScore > 0) {
+			return fmt.Errorf("rule %s can't match errors and categories, unknown inputs or suspicions", rule.label(i))
+		}
+
+		if rule.MinScore < 0 || rule.MinScore > 1 {
+			return fmt.Errorf("rule %s has a min score outside of 0 to 1", rule.label(i))
+		}
+	}
+
+	return nil
+}
+
+// Check that every rule has actions and valid conditions
+func (p *Policy) Validate() error {
+	if err := validateRules(p.Rules); err != nil {
+		return err
+	}
+
+	for name, tenant := range p.Tenants {
+		if err := validateRules(tenant.Rules); err != nil {
+			return fmt.Errorf("tenant %s: %s", name, err)
+		}
+	}
+
+	return nil
+}
+
+func (r PolicyRule) label(i int) string {
+	if r.Name != "" {
+		return r.Name
+	}
+
+	return fmt.Sprintf("#%d", i+1)
+}
+
+func (r PolicyRule) applies(verdict Verdict) bool {
+	// An input that couldn't be checked isn't unknown, it may well be listed
+	if r.Error != (verdict.Error != "") {
+		return false
+	}
+
+	if len(r.Categories) > 0 && (!verdict.Known || !containsValue(r.Categories, verdict.Category)) {
+		return false
+	}
+
+	if r.Unknown && verdict.Known {
+		return false
+	}
+
+	if r.Unknown && len(r.Suspicions) == 0 && verdict.Suspicion != nil {
+		return false
+	}
+
+	if len(r.Suspicions) > 0 || r.MinScore > 0 {
+		if verdict.Suspicion == nil || verdict.Suspicion.Score < r.MinScore {
+			return false
+		}
+
+		if len(r.Suspicions) > 0 && !containsValue(r.Suspicions, verdict.Suspicion.Kind) {
+			return false
+		}
+	}
+
+	if len(r.Sources) > 0 && !containsValue(r.Sources, verdict.Source) {
+		return false
+	}
+
+	if len(verdict.Feeds) < r.MinFeeds {
+		return false
+	}
+
+	if len(r.Feeds) > 0 {
+		listed := false
+
+		for _, feed := range verdict.Feeds {
+			listed = listed || containsValue(r.Feeds, feed)
+		}
+
+		if !listed {
+			return false
+		}
+	}
+
+	return true
+}
+
+func containsValue[T comparable](values []T, value T) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Describe what a verdict says about its input
+func describeVerdict(verdict Verdict) string {
+	switch {
+	case verdict.Error != "":
+		return fmt.Sprintf("%s couldn't be checked: %s", verdict.Input, verdict.Error)
+	case verdict.Override != nil:
+		description := fmt.Sprintf("%s is overridden as %s", verdict.Input, verdict.Category)
+		if verdict.Override.Reason != "" {
+			description += fmt.Sprintf(" (%s)", verdict.Override.Reason)
+		}
+		return description
+	case verdict.Known:
+		description := fmt.Sprintf("%s is listed as %s", verdict.Input, verdict.Category)
+		if len(verdict.Feeds) > 0 {
+			description += " by " + strings.Join(verdict.Feeds, ", ")
+		}
+		return description
+	case verdict.Suspicion != nil:
+		return fmt.Sprintf("%s isn't listed but is a suspected %s of %s with score %.2f", verdict.Input,
+			verdict.Suspicion.Kind, verdict.Suspicion.Of, verdict.Suspicion.Score)
+	}
+
+	return fmt.Sprintf("%s isn't listed", verdict.Input)
+}
+
+// Decide what to do about a verdict, using the rules of the tenant if it has any
+// Verdicts with an error get the default actions, unless a rule with Error set applies.
+func (p *Policy) Evaluate(tenant string, verdict Verdict) Decision {
+	decision := Decision{Tenant: tenant}
+	description := describeVerdict(verdict)
+
+	tenantPolicy, hasTenant := p.Tenants[tenant]
+
+	type scopedRules struct {
+		scope string
+		rules []PolicyRule
+	}
+
+	scopes := []scopedRules{}
+	if hasTenant {
+		scopes = append(scopes, scopedRules{"tenant " + tenant, tenantPolicy.Rules})
+	}
+	scopes = append(scopes, scopedRules{"policy", p.Rules})
+
+	for _, scope := range scopes {
+		for i, rule := range scope.rules {
+			if !rule.applies(verdict) {
+				continue
+			}
+
+			decision.Actions = rule.Actions
+			decision.Rule = rule.label(i)
+			decision.Explanation = fmt.Sprintf("%s, so rule %s of the %s applies", description, decision.Rule, scope.scope)
+
+			return decision
+		}
+	}
+
+	decision.Actions = p.Default
+	if hasTenant && len(tenantPolicy.Default) > 0 {
+		decision.Actions = tenantPolicy.Default
+	}
+	if len(decision.Actions) == 0 {
+		decision.Actions = []Action{ActionAllow}
+	}
+
+	decision.Explanation = fmt.Sprintf("%s and no rule applies, so the default applies", description)
+
+	return decision
+}
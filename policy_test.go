@@ -0,0 +1,146 @@
+package fishfish_test
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/existagon/fishfish-go"
+)
+
+func TestDefaultPolicy(t *testing.T) {
+	client := newTestAutoSync([]fishfish.Domain{
+		{Domain: "steamcommunity-gift.ru", Category: fishfish.CategoryPhishing},
+		{Domain: "malware.example", Category: fishfish.CategoryMalware},
+		{Domain: "discord.com", Category: fishfish.CategorySafe},
+	}, nil)
+
+	policy := fishfish.DefaultPolicy()
+	mustPanic(policy.Validate())
+
+	tests := map[string][]fishfish.Action{
+		"steamcommunity-gift.ru": {fishfish.ActionDelete},
+		"malware.example":        {fishfish.ActionDelete, fishfish.ActionBan},
+		"discord.com":            {fishfish.ActionAllow},
+		"dicsord.com":            {fishfish.ActionFlag},
+		"example.org":            {fishfish.ActionAllow},
+	}
+
+	for input, actions := range tests {
+		decision := policy.Evaluate("", client.Check(context.Background(), input))
+
+		if !reflect.DeepEqual(decision.Actions, actions) || decision.Explanation == "" {
+			panic(fmt.Errorf("%s: expected %v, got %+v", input, actions, decision))
+		}
+	}
+}
+
+func TestPolicyTenants(t *testing.T) {
+	policy, err := fishfish.ParsePolicy([]byte(`{
+		"rules": [
+			{"name": "listed", "categories": ["phishing", "malware"], "min_feeds": 1, "actions": ["delete"]},
+			{"name": "lookalike", "suspicions": ["lookalike"], "min_score": 0.9, "actions": ["flag"]}
+		],
+		"tenants": {
+			"strict-guild": {
+				"rules": [{"name": "ban phishing", "categories": ["phishing"], "actions": ["delete", "ban"]}],
+				"default": ["flag"]
+			}
+		}
+	}`))
+	mustPanic(err)
+
+	phishing := fishfish.Verdict{Input: "evil.com", Known: true, Category: fishfish.CategoryPhishing, Feeds: []string{fishfish.FeedNameFishFish}}
+
+	decision := policy.Evaluate("strict-guild", phishing)
+	if !decision.Has(fishfish.ActionBan) || decision.Rule != "ban phishing" || !strings.Contains(decision.Explanation, "tenant strict-guild") {
+		panic(fmt.Errorf("expected the tenant rule to apply, got %+v", decision))
+	}
+
+	if decision := policy.Evaluate("other-guild", phishing); decision.Has(fishfish.ActionBan) || decision.Rule != "listed" {
+		panic(fmt.Errorf("expected the base rule to apply, got %+v", decision))
+	}
+
+	weak := fishfish.Verdict{Input: "dlscord.com", Suspicion: &fishfish.Suspicion{Kind: fishfish.SuspicionKindLookalike, Of: "discord.com", Score: 0.85}}
+
+	if decision := policy.Evaluate("", weak); !reflect.DeepEqual(decision.Actions, []fishfish.Action{fishfish.ActionAllow}) || decision.Rule != "" {
+		panic(fmt.Errorf("expected a low score to use the default, got %+v", decision))
+	}
+	if decision := policy.Evaluate("strict-guild", weak); !reflect.DeepEqual(decision.Actions, []fishfish.Action{fishfish.ActionFlag}) {
+		panic(fmt.Errorf("expected the tenant default, got %+v", decision))
+	}
+
+	invalid := []string{
+		`{"rules": [{"categories": ["phishing"]}]}`,
+		`{"rules": [{"categories": ["spam"], "actions": ["delete"]}]}`,
+		`{"rules": [{"category": "phishing", "actions": ["delete"]}]}`,
+		`{"tenants": {"guild": {"rules": [{"min_score": 2, "actions": ["flag"]}]}}}`,
+	}
+
+	for _, data := range invalid {
+		if _, err := fishfish.ParsePolicy([]byte(data)); err == nil {
+			panic(fmt.Errorf("expected an error for %s", data))
+		}
+	}
+}
+
+func TestPolicyErrors(t *testing.T) {
+	failed := fishfish.Verdict{Input: "evil.com", Error: "failed to get domain: connection refused"}
+
+	// Errors aren't unknown inputs, they get the default
+	policy, err := fishfish.ParsePolicy([]byte(`{
+		"rules": [{"name": "unknown", "unknown": true, "actions": ["allow"]}],
+		"default": ["flag"]
+	}`))
+	mustPanic(err)
+
+	if decision := policy.Evaluate("", failed); decision.Rule != "" || !reflect.DeepEqual(decision.Actions, []fishfish.Action{fishfish.ActionFlag}) {
+		panic(fmt.Errorf("expected the default for an error, got %+v", decision))
+	}
+
+	if decision := fishfish.DefaultPolicy().Evaluate("", failed); decision.Rule != "" || !decision.Has(fishfish.ActionAllow) {
+		panic(fmt.Errorf("expected the default policy to allow errors, got %+v", decision))
+	}
+
+	policy, err = fishfish.ParsePolicy([]byte(`{
+		"rules": [
+			{"name": "errors", "error": true, "actions": ["flag"]},
+			{"name": "unknown", "unknown": true, "actions": ["allow"]}
+		]
+	}`))
+	mustPanic(err)
+
+	if decision := policy.Evaluate("", failed); decision.Rule != "errors" || !strings.Contains(decision.Explanation, "couldn't be checked") {
+		panic(fmt.Errorf("expected the error rule to apply, got %+v", decision))
+	}
+
+	if decision := policy.Evaluate("", fishfish.Verdict{Input: "example.org"}); decision.Rule != "unknown" {
+		panic(fmt.Errorf("expected the error rule not to apply without an error, got %+v", decision))
+	}
+
+	if _, err := fishfish.ParsePolicy([]byte(`{"rules": [{"error": true, "categories": ["phishing"], "actions": ["flag"]}]}`)); err == nil {
+		panic("expected an error rule with categories to be rejected")
+	}
+}
+
+func TestParsePolicyComments(t *testing.T) {
+	policy, err := fishfish.ParsePolicy([]byte(`{
+		// Hand-edited policies can explain themselves
+		"rules": [
+			{"name": "no // comment in strings", "categories": ["phishing"], "actions": ["delete",]},
+			/* temporarily disabled
+			{"categories": ["malware"], "actions": ["ban"]}, */
+		],
+	}`))
+	mustPanic(err)
+
+	if len(policy.Rules) != 1 || policy.Rules[0].Name != "no // comment in strings" || len(policy.Rules[0].Actions) != 1 {
+		panic(fmt.Errorf("unexpected policy %+v", policy))
+	}
+
+	if _, err := fishfish.ParsePolicy([]byte(`{"rules": [], /* unterminated`)); err == nil {
+		panic("expected an unterminated comment to be rejected")
+	}
+}
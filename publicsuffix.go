@@ -0,0 +1,227 @@
+package fishfish
+
+import (
+	"bufio"
+	"bytes"
+	_ "embed"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// Snapshot of https://publicsuffix.org/list/public_suffix_list.dat
+// Use LoadPublicSuffixListFile and SetPublicSuffixList to use a newer copy
+//
+//go:embed public_suffix_list.dat
+var bundledPublicSuffixList []byte
+
+const (
+	suffixRuleNormal uint8 = 1 << iota
+	suffixRuleWildcard
+	suffixRuleException
+	suffixRuleICANN
+)
+
+// Rules for finding the public suffix of a domain, such as com, co.uk or github.io
+type PublicSuffixList struct {
+	// Rules by the domain they apply to, without any "*." or "!" prefix
+	rules map[string]uint8
+}
+
+var (
+	// Replaced with SetPublicSuffixList, nil uses the bundled list
+	defaultSuffixList     atomic.Pointer[PublicSuffixList]
+	bundledSuffixList     *PublicSuffixList
+	bundledSuffixListOnce sync.Once
+)
+
+// Parse a list in the format of https://publicsuffix.org/list/public_suffix_list.dat
+func ParsePublicSuffixList(r io.Reader) (*PublicSuffixList, error) {
+	list := PublicSuffixList{rules: map[string]uint8{}}
+	scanner := bufio.NewScanner(r)
+	icann := false
+
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+
+		switch {
+		case strings.Contains(line, "===BEGIN ICANN DOMAINS==="):
+			icann = true
+			continue
+		case strings.Contains(line, "===END ICANN DOMAINS==="):
+			icann = false
+			continue
+		case line == "" || strings.HasPrefix(line, "//"):
+			continue
+		}
+
+		// Rules end at the first whitespace
+		if fields := strings.Fields(line); len(fields) > 0 {
+			line = strings.ToLower(fields[0])
+		}
+
+		var flags uint8
+		switch {
+		case strings.HasPrefix(line, "!"):
+			line, flags = line[1:], suffixRuleException
+		case strings.HasPrefix(line, "*."):
+			line, flags = line[2:], suffixRuleWildcard
+		default:
+			flags = suffixRuleNormal
+		}
+
+		if icann {
+			flags |= suffixRuleICANN
+		}
+
+		// Internationalized rules are listed in Unicode, hosts are matched in their punycode form
+		line, err := DomainToASCII(line)
+
+		if err != nil {
+			return nil, fmt.Errorf("invalid public suffix rule: %s", err)
+		}
+
+		list.rules[line] |= flags
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("unable to read public suffix list: %s", err)
+	}
+
+	if len(list.rules) == 0 {
+		return nil, fmt.Errorf("public suffix list has no rules")
+	}
+
+	return &list, nil
+}
+
+// Load a public suffix list from a local file, e.g. a freshly downloaded copy
+func LoadPublicSuffixListFile(path string) (*PublicSuffixList, error) {
+	file, err := os.Open(path)
+
+	if err != nil {
+		return nil, fmt.Errorf("unable to open public suffix list: %s", err)
+	}
+
+	defer file.Close()
+
+	return ParsePublicSuffixList(file)
+}
+
+// Replace the list used by the package-level functions and domain matching, nil restores the bundled list
+func SetPublicSuffixList(list *PublicSuffixList) {
+	defaultSuffixList.Store(list)
+}
+
+// The list used by the package-level functions, the bundled list unless replaced with SetPublicSuffixList
+func DefaultPublicSuffixList() *PublicSuffixList {
+	if list := defaultSuffixList.Load(); list != nil {
+		return list
+	}
+
+	bundledSuffixListOnce.Do(func() {
+		list, err := ParsePublicSuffixList(bytes.NewReader(bundledPublicSuffixList))
+
+		if err != nil {
+			// The bundled list is part of the source, this can't happen at runtime
+			panic(err)
+		}
+
+		bundledSuffixList = list
+	})
+
+	return bundledSuffixList
+}
+
+// Get the public suffix of a domain and whether it is managed by ICANN rather than a private registry
+// Domains under a TLD that isn't listed are treated as having that TLD as suffix
+func (l *PublicSuffixList) PublicSuffix(domain string) (string, bool) {
+	labels := strings.Split(normalizeHost(domain), ".")
+	suffixLen, icann := l.suffixLabels(labels)
+
+	return strings.Join(labels[len(labels)-suffixLen:], "."), icann
+}
+
+// Get the registrable part of a domain, its public suffix plus one label, e.g. example.co.uk
+// Canonical urls keep their full host, the list only limits which parent domains of it are matched.
+func (l *PublicSuffixList) EffectiveTLDPlusOne(domain string) (string, error) {
+	domain = normalizeHost(domain)
+
+	if domain == "" || strings.HasPrefix(domain, ".") || strings.Contains(domain, "..") {
+		return "", fmt.Errorf("invalid domain %q", domain)
+	}
+
+	if net.ParseIP(domain) != nil {
+		return "", fmt.Errorf("%s is an IP address", domain)
+	}
+
+	labels := strings.Split(domain, ".")
+	suffixLen, _ := l.suffixLabels(labels)
+
+	if suffixLen >= len(labels) {
+		return "", fmt.Errorf("%s is a public suffix", domain)
+	}
+
+	return strings.Join(labels[len(labels)-suffixLen-1:], "."), nil
+}
+
+func (l *PublicSuffixList) IsPublicSuffix(domain string) bool {
+	labels := strings.Split(normalizeHost(domain), ".")
+	suffixLen, _ := l.suffixLabels(labels)
+
+	return suffixLen == len(labels)
+}
+
+// Number of trailing labels that form the public suffix
+func (l *PublicSuffixList) suffixLabels(labels []string) (int, bool) {
+	// Unlisted TLDs are public suffixes by default
+	suffixLen, icann := 1, false
+
+	// Rules are stored in punycode, Unicode labels are converted to match them
+	ascii := labels
+	if domain, err := DomainToASCII(strings.Join(labels, ".")); err == nil {
+		ascii = strings.Split(domain, ".")
+	}
+
+	for i := len(labels) - 1; i >= 0; i-- {
+		candidate := strings.Join(ascii[i:], ".")
+		flags := l.rules[candidate]
+
+		// Exceptions override any other rule and make the parent the suffix
+		if flags&suffixRuleException != 0 {
+			return len(labels) - i - 1, flags&suffixRuleICANN != 0
+		}
+
+		if flags&suffixRuleNormal != 0 {
+			suffixLen, icann = len(labels)-i, flags&suffixRuleICANN != 0
+		}
+
+		if i+1 < len(labels) {
+			parentFlags := l.rules[strings.Join(ascii[i+1:], ".")]
+
+			if parentFlags&suffixRuleWildcard != 0 {
+				suffixLen, icann = len(labels)-i, parentFlags&suffixRuleICANN != 0
+			}
+		}
+	}
+
+	return suffixLen, icann
+}
+
+// Get the public suffix of a domain using the default list
+func PublicSuffix(domain string) (string, bool) {
+	return DefaultPublicSuffixList().PublicSuffix(domain)
+}
+
+// Get the registrable part of a domain using the default list
+func EffectiveTLDPlusOne(domain string) (string, error) {
+	return DefaultPublicSuffixList().EffectiveTLDPlusOne(domain)
+}
+
+func IsPublicSuffix(domain string) bool {
+	return DefaultPublicSuffixList().IsPublicSuffix(domain)
+}
@@ -0,0 +1,95 @@
+package fishfish_test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/existagon/fishfish-go"
+)
+
+func TestEffectiveTLDPlusOne(t *testing.T) {
+	tests := map[string]string{
+		"login.example.co.uk":  "example.co.uk",
+		"Example.COM.":         "example.com",
+		"scam.user.github.io":  "user.github.io",
+		"a.b.c.kawasaki.jp":    "b.c.kawasaki.jp",
+		"www.city.kawasaki.jp": "city.kawasaki.jp",
+		"www.example.unlisted": "example.unlisted",
+	}
+
+	for domain, expected := range tests {
+		registrable, err := fishfish.EffectiveTLDPlusOne(domain)
+		mustPanic(err)
+
+		if registrable != expected {
+			panic(fmt.Errorf("%s: expected %s, got %s", domain, expected, registrable))
+		}
+	}
+
+	if _, err := fishfish.EffectiveTLDPlusOne("co.uk"); err == nil {
+		panic("expected an error for a public suffix")
+	}
+
+	for _, ip := range []string{"1.2.3.4", "[2001:db8::1]"} {
+		if registrable, err := fishfish.EffectiveTLDPlusOne(ip); err == nil {
+			panic(fmt.Errorf("expected an error for IP address %s, got %s", ip, registrable))
+		}
+	}
+
+	// Internationalized rules match both the punycode and the Unicode form of a host
+	for domain, expected := range map[string]string{
+		"shop.example.xn--p1ai":       "example.xn--p1ai",
+		"shop.example.рф":             "example.рф",
+		"scam.xn--55qx5d.xn--j6w193g": "scam.xn--55qx5d.xn--j6w193g",
+	} {
+		registrable, err := fishfish.EffectiveTLDPlusOne(domain)
+		mustPanic(err)
+
+		if registrable != expected {
+			panic(fmt.Errorf("%s: expected %s, got %s", domain, expected, registrable))
+		}
+	}
+
+	if suffix, icann := fishfish.PublicSuffix("user.github.io"); suffix != "github.io" || icann {
+		panic(fmt.Errorf("expected private suffix github.io, got %s (icann %t)", suffix, icann))
+	}
+}
+
+func TestPublicSuffixMatching(t *testing.T) {
+	client := newTestAutoSync([]fishfish.Domain{
+		{Domain: "github.io", Category: fishfish.CategoryPhishing},
+		{Domain: "scam.github.io", Category: fishfish.CategoryPhishing},
+	}, nil)
+
+	// A listed public suffix must not cover every site hosted under it
+	if _, err := client.MatchDomain("innocent.github.io"); err == nil {
+		panic("expected github.io not to match as a parent")
+	}
+
+	match, err := client.MatchDomain("login.scam.github.io")
+	mustPanic(err)
+
+	if match.Domain.Domain != "scam.github.io" {
+		panic(fmt.Errorf("expected scam.github.io, got %s", match.Domain.Domain))
+	}
+
+	// Replacing the list changes what counts as a parent
+	list, err := fishfish.ParsePublicSuffixList(strings.NewReader("// ===BEGIN ICANN DOMAINS===\nio\n"))
+	mustPanic(err)
+
+	previous := fishfish.DefaultPublicSuffixList()
+	fishfish.SetPublicSuffixList(list)
+	defer fishfish.SetPublicSuffixList(previous)
+
+	if _, err := client.MatchDomain("innocent.github.io"); err != nil {
+		panic("expected github.io to match once it is no longer a public suffix")
+	}
+
+	// Clearing the list restores the bundled one
+	fishfish.SetPublicSuffixList(nil)
+
+	if _, err := client.MatchDomain("innocent.github.io"); err == nil {
+		panic("expected the bundled list after clearing it")
+	}
+}
@@ -0,0 +1,261 @@
+package fishfish
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Parameters from RFC 3492
+const (
+	punycodeBase        = 36
+	punycodeTMin        = 1
+	punycodeTMax        = 26
+	punycodeSkew        = 38
+	punycodeDamp        = 700
+	punycodeInitialBias = 72
+	punycodeInitialN    = 128
+	punycodeMaxInt      = 1<<31 - 1
+)
+
+const idnaPrefix = "xn--"
+
+// Convert every punycode (xn--) label of a domain to Unicode, e.g. xn--mnchen-3ya.de to münchen.de
+func DomainToUnicode(domain string) (string, error) {
+	labels := strings.Split(domain, ".")
+
+	for i, label := range labels {
+		if !strings.HasPrefix(strings.ToLower(label), idnaPrefix) {
+			continue
+		}
+
+		decoded, err := decodePunycode(label[len(idnaPrefix):])
+
+		if err != nil {
+			return "", fmt.Errorf("invalid punycode label %s: %s", label, err)
+		}
+
+		labels[i] = decoded
+	}
+
+	return strings.Join(labels, "."), nil
+}
+
+// Decode punycode without the xn-- prefix, as described in RFC 3492
+func decodePunycode(input string) (string, error) {
+	output := []rune{}
+	pos := 0
+
+	// Basic code points are copied as-is up to the last delimiter
+	if b := strings.LastIndex(input, "-"); b >= 0 {
+		for _, c := range []byte(input[:b]) {
+			if c >= 0x80 {
+				return "", errors.New("non-basic code point before delimiter")
+			}
+
+			output = append(output, rune(c))
+		}
+
+		pos = b + 1
+	}
+
+	n, i, bias := punycodeInitialN, 0, punycodeInitialBias
+
+	for pos < len(input) {
+		oldi, w := i, 1
+
+		for k := punycodeBase; ; k += punycodeBase {
+			if pos >= len(input) {
+				return "", errors.New("unexpected end of input")
+			}
+
+			digit := punycodeDigit(input[pos])
+			pos++
+
+			if digit < 0 {
+				return "", fmt.Errorf("invalid character %q", input[pos-1])
+			}
+			if digit > (punycodeMaxInt-i)/w {
+				return "", errors.New("overflow")
+			}
+
+			i += digit * w
+
+			t := k - bias
+			if t < punycodeTMin {
+				t = punycodeTMin
+			} else if t > punycodeTMax {
+				t = punycodeTMax
+			}
+
+			if digit < t {
+				break
+			}
+
+			if w > punycodeMaxInt/(punycodeBase-t) {
+				return "", errors.New("overflow")
+			}
+
+			w *= punycodeBase - t
+		}
+
+		length := len(output) + 1
+		bias = punycodeAdapt(i-oldi, length, oldi == 0)
+
+		if i/length > punycodeMaxInt-n {
+			return "", errors.New("overflow")
+		}
+
+		n += i / length
+		i %= length
+
+		// Insert n at position i
+		output = append(output, 0)
+		copy(output[i+1:], output[i:])
+		output[i] = rune(n)
+		i++
+	}
+
+	return string(output), nil
+}
+
+func punycodeAdapt(delta, numPoints int, first bool) int {
+	if first {
+		delta /= punycodeDamp
+	} else {
+		delta /= 2
+	}
+
+	delta += delta / numPoints
+	k := 0
+
+	for delta > ((punycodeBase-punycodeTMin)*punycodeTMax)/2 {
+		delta /= punycodeBase - punycodeTMin
+		k += punycodeBase
+	}
+
+	return k + (punycodeBase-punycodeTMin+1)*delta/(delta+punycodeSkew)
+}
+
+func punycodeDigit(c byte) int {
+	switch {
+	case c >= '0' && c <= '9':
+		return int(c-'0') + 26
+	case c >= 'a' && c <= 'z':
+		return int(c - 'a')
+	case c >= 'A' && c <= 'Z':
+		return int(c - 'A')
+	}
+
+	return -1
+}
+
+// Convert every non-ASCII label of a domain to punycode, e.g. münchen.de to xn--mnchen-3ya.de
+func DomainToASCII(domain string) (string, error) {
+	labels := strings.Split(domain, ".")
+
+	for i, label := range labels {
+		if isASCII(label) {
+			continue
+		}
+
+		encoded, err := encodePunycode(strings.ToLower(label))
+
+		if err != nil {
+			return "", fmt.Errorf("invalid label %s: %s", label, err)
+		}
+
+		labels[i] = idnaPrefix + encoded
+	}
+
+	return strings.Join(labels, "."), nil
+}
+
+// Encode a label as punycode without the xn-- prefix, as described in RFC 3492
+func encodePunycode(input string) (string, error) {
+	runes := []rune(input)
+	output := []byte{}
+
+	// Basic code points are copied as-is, followed by a delimiter if there are any
+	for _, r := range runes {
+		if r < 0x80 {
+			output = append(output, byte(r))
+		}
+	}
+
+	basic := len(output)
+	handled := basic
+
+	if basic > 0 {
+		output = append(output, '-')
+	}
+
+	n, delta, bias := punycodeInitialN, 0, punycodeInitialBias
+
+	for handled < len(runes) {
+		// The smallest code point that hasn't been handled yet
+		m := punycodeMaxInt
+		for _, r := range runes {
+			if int(r) >= n && int(r) < m {
+				m = int(r)
+			}
+		}
+
+		if m-n > (punycodeMaxInt-delta)/(handled+1) {
+			return "", errors.New("overflow")
+		}
+
+		delta += (m - n) * (handled + 1)
+		n = m
+
+		for _, r := range runes {
+			if int(r) < n {
+				delta++
+
+				if delta > punycodeMaxInt {
+					return "", errors.New("overflow")
+				}
+			}
+
+			if int(r) != n {
+				continue
+			}
+
+			q := delta
+
+			for k := punycodeBase; ; k += punycodeBase {
+				t := k - bias
+				if t < punycodeTMin {
+					t = punycodeTMin
+				} else if t > punycodeTMax {
+					t = punycodeTMax
+				}
+
+				if q < t {
+					break
+				}
+
+				output = append(output, punycodeEncodeDigit(t+(q-t)%(punycodeBase-t)))
+				q = (q - t) / (punycodeBase - t)
+			}
+
+			output = append(output, punycodeEncodeDigit(q))
+			bias = punycodeAdapt(delta, handled+1, handled == basic)
+			delta = 0
+			handled++
+		}
+
+		delta++
+		n++
+	}
+
+	return string(output), nil
+}
+
+func punycodeEncodeDigit(d int) byte {
+	if d < 26 {
+		return byte('a' + d)
+	}
+
+	return byte('0' + d - 26)
+}
@@ -0,0 +1,396 @@
+package fishfish
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// How a domain or url should be listed
+// Empty descriptions and targets aren't managed, the API can't clear them.
+type DesiredEntry struct {
+	Category    Category `json:"category,omitempty"`
+	Description string   `json:"description,omitempty"`
+	Target      string   `json:"target,omitempty"`
+	// Delete the entry if it is listed, e.g. after it was taken down
+	Absent bool `json:"absent,omitempty"`
+}
+
+// The domains and urls a team manages, by name
+// Entries that aren't in the desired state are left alone, mark them as absent to delete them.
+type DesiredState struct {
+	Domains map[string]DesiredEntry `json:"domains,omitempty"`
+	URLs    map[string]DesiredEntry `json:"urls,omitempty"`
+}
+
+// Parse a desired state from JSON, unknown fields are rejected to catch typos
+func ParseDesiredState(data []byte) (*DesiredState, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+
+	state := DesiredState{}
+
+	if err := decoder.Decode(&state); err != nil {
+		return nil, fmt.Errorf("failed to parse desired state: %s", err)
+	}
+
+	if _, err := state.normalize(); err != nil {
+		return nil, err
+	}
+
+	return &state, nil
+}
+
+func LoadDesiredStateFile(path string) (*DesiredState, error) {
+	data, err := os.ReadFile(path)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return ParseDesiredState(data)
+}
+
+// The desired state with refanged, canonical domain names and refanged urls
+// Urls aren't canonicalized further since the API looks them up by the exact url.
+func (s DesiredState) normalize() (DesiredState, error) {
+	normalized := DesiredState{Domains: map[string]DesiredEntry{}, URLs: map[string]DesiredEntry{}}
+
+	validate := func(name string, entry DesiredEntry) error {
+		if entry.Absent {
+			return nil
+		}
+
+		if !containsValue(Categories, entry.Category) {
+			return fmt.Errorf("%s has invalid category %q", name, entry.Category)
+		}
+
+		return nil
+	}
+
+	for name, entry := range s.Domains {
+		parsed, ok := newFeedEntry(name, entry.Category)
+		host := parsed.Domain
+
+		if !ok || host == "" {
+			return DesiredState{}, fmt.Errorf("invalid domain %q", name)
+		}
+
+		if _, ok := normalized.Domains[host]; ok {
+			return DesiredState{}, fmt.Errorf("domain %s is listed more than once", host)
+		}
+
+		if err := validate(host, entry); err != nil {
+			return DesiredState{}, err
+		}
+
+		normalized.Domains[host] = entry
+	}
+
+	for name, entry := range s.URLs {
+		url := Refang(strings.TrimSpace(name))
+
+		if _, err := parseCanonicalURL(url); err != nil {
+			return DesiredState{}, fmt.Errorf("invalid url %q: %s", name, err)
+		}
+
+		if _, ok := normalized.URLs[url]; ok {
+			return DesiredState{}, fmt.Errorf("url %s is listed more than once", url)
+		}
+
+		if err := validate(url, entry); err != nil {
+			return DesiredState{}, err
+		}
+
+		normalized.URLs[url] = entry
+	}
+
+	return normalized, nil
+}
+
+type ReconcileOperation string
+
+const (
+	ReconcileCreate = "create"
+	ReconcileUpdate = "update"
+	ReconcileDelete = "delete"
+)
+
+// A change needed to reach the desired state
+type ReconcileChange struct {
+	Operation ReconcileOperation `json:"operation"`
+	// Either domain or url
+	Kind string `json:"kind"`
+	Name string `json:"name"`
+	// How the entry is listed now, nil when it is created
+	Current *DesiredEntry `json:"current,omitempty"`
+	// How the entry will be listed, nil when it is deleted
+	Desired *DesiredEntry `json:"desired,omitempty"`
+}
+
+// The changes needed to reach a desired state, domains first and then urls, each in sorted order
+type ReconcilePlan struct {
+	Changes []ReconcileChange `json:"changes"`
+	// Entries already listed as desired, or absent and not listed
+	Unchanged int `json:"unchanged"`
+	// The outcome of each change in order, only set once the plan is applied
+	Results []BulkResult `json:"results,omitempty"`
+}
+
+type ReconcileOptions struct {
+	// Only plan the changes without applying them
+	DryRun bool
+	// Fetch every entry at once instead of looking up each managed entry, requires authentication
+	// Faster when the desired state has many entries.
+	FullFetch bool
+}
+
+// The current listing of every managed entry, nil if it isn't listed
+type currentState struct {
+	domains map[string]*DesiredEntry
+	urls    map[string]*DesiredEntry
+}
+
+func (c *RawClient) fetchCurrentState(ctx context.Context, desired DesiredState, fullFetch bool) (currentState, error) {
+	current := currentState{domains: map[string]*DesiredEntry{}, urls: map[string]*DesiredEntry{}}
+
+	if fullFetch {
+		domains, err := c.getDomainsFull(ctx)
+
+		if err != nil {
+			return current, fmt.Errorf("failed to fetch domains: %s", err)
+		}
+
+		urls, err := c.getURLsFull(ctx)
+
+		if err != nil {
+			return current, fmt.Errorf("failed to fetch urls: %s", err)
+		}
+
+		for _, domain := range *domains {
+			if host, err := canonicalHost(domain.Domain); err == nil {
+				if _, ok := desired.Domains[host]; ok {
+					current.domains[host] = &DesiredEntry{Category: domain.Category, Description: domain.Description, Target: domain.Target}
+				}
+			}
+		}
+
+		for _, url := range *urls {
+			if _, ok := desired.URLs[url.URL]; ok {
+				current.urls[url.URL] = &DesiredEntry{Category: url.Category, Description: url.Description, Target: url.Target}
+			}
+		}
+
+		return current, nil
+	}
+
+	for _, name := range sortedKeys(desired.Domains) {
+		domain, err := c.getDomain(ctx, name)
+
+		if errors.Is(err, ErrNotFound) {
+			continue
+		} else if err != nil {
+			return current, fmt.Errorf("failed to look up domain %s: %s", name, err)
+		}
+
+		current.domains[name] = &DesiredEntry{Category: domain.Category, Description: domain.Description, Target: domain.Target}
+	}
+
+	for _, name := range sortedKeys(desired.URLs) {
+		url, err := c.getURL(ctx, name)
+
+		if errors.Is(err, ErrNotFound) {
+			continue
+		} else if err != nil {
+			return current, fmt.Errorf("failed to look up url %s: %s", name, err)
+		}
+
+		current.urls[name] = &DesiredEntry{Category: url.Category, Description: url.Description, Target: url.Target}
+	}
+
+	return current, nil
+}
+
+// The change that makes current match desired, nil if it already does
+func reconcileEntry(kind, name string, current *DesiredEntry, desired DesiredEntry) *ReconcileChange {
+	change := &ReconcileChange{Kind: kind, Name: name, Current: current}
+
+	switch {
+	case desired.Absent && current == nil:
+		return nil
+	case desired.Absent:
+		change.Operation = ReconcileDelete
+		return change
+	}
+
+	change.Desired = &desired
+
+	if current == nil {
+		change.Operation = ReconcileCreate
+		return change
+	}
+
+	if current.Category == desired.Category &&
+		(desired.Description == "" || current.Description == desired.Description) &&
+		(desired.Target == "" || current.Target == desired.Target) {
+		return nil
+	}
+
+	change.Operation = ReconcileUpdate
+
+	return change
+}
+
+// Compare the desired state against the API and plan the changes needed to reach it
+func (c *RawClient) PlanReconcile(ctx context.Context, desired DesiredState, options ReconcileOptions) (*ReconcilePlan, error) {
+	normalized, err := desired.normalize()
+
+	if err != nil {
+		return nil, err
+	}
+
+	current, err := c.fetchCurrentState(ctx, normalized, options.FullFetch)
+
+	if err != nil {
+		return nil, err
+	}
+
+	plan := ReconcilePlan{Changes: []ReconcileChange{}}
+
+	add := func(change *ReconcileChange) {
+		if change == nil {
+			plan.Unchanged++
+		} else {
+			plan.Changes = append(plan.Changes, *change)
+		}
+	}
+
+	for _, name := range sortedKeys(normalized.Domains) {
+		add(reconcileEntry("domain", name, current.domains[name], normalized.Domains[name]))
+	}
+
+	for _, name := range sortedKeys(normalized.URLs) {
+		add(reconcileEntry("url", name, current.urls[name], normalized.URLs[name]))
+	}
+
+	return &plan, nil
+}
+
+// Apply every change of the plan in order, stopping early if the context is done
+// Changes that weren't attempted are reported with the context's error.
+func (p *ReconcilePlan) Apply(ctx context.Context, client *RawClient) []BulkResult {
+	p.Results = []BulkResult{}
+
+	for _, change := range p.Changes {
+		if err := ctx.Err(); err != nil {
+			p.Results = append(p.Results, BulkResult{Name: change.Name, Err: err})
+			continue
+		}
+
+		p.Results = append(p.Results, BulkResult{Name: change.Name, Err: change.apply(client)})
+	}
+
+	return p.Results
+}
+
+func (c ReconcileChange) apply(client *RawClient) error {
+	switch c.Kind + " " + string(c.Operation) {
+	case "domain " + ReconcileCreate:
+		_, err := client.AddDomain(c.Name, CreateDomainRequest{Category: c.Desired.Category, Description: c.Desired.Description, Target: c.Desired.Target})
+		return err
+	case "domain " + ReconcileUpdate:
+		_, err := client.UpdateDomain(c.Name, UpdateDomainRequest{Category: c.Desired.Category, Description: c.Desired.Description, Target: c.Desired.Target})
+		return err
+	case "domain " + ReconcileDelete:
+		return client.DeleteDomain(c.Name)
+	case "url " + ReconcileCreate:
+		_, err := client.AddURL(c.Name, CreateURLRequest{Category: c.Desired.Category, Description: c.Desired.Description, Target: c.Desired.Target})
+		return err
+	case "url " + ReconcileUpdate:
+		return client.UpdateURL(c.Name, UpdateURLRequest{Category: c.Desired.Category, Description: c.Desired.Description, Target: c.Desired.Target})
+	case "url " + ReconcileDelete:
+		return client.DeleteURL(c.Name)
+	}
+
+	return fmt.Errorf("unknown change: %s %s", c.Operation, c.Kind)
+}
+
+// Plan the changes needed to reach the desired state and apply them unless it is a dry run
+// The plan is returned even if some changes failed, see ReconcilePlan.Results.
+func (c *RawClient) Reconcile(ctx context.Context, desired DesiredState, options ReconcileOptions) (*ReconcilePlan, error) {
+	plan, err := c.PlanReconcile(ctx, desired, options)
+
+	if err != nil || options.DryRun {
+		return plan, err
+	}
+
+	failed := 0
+	for _, result := range plan.Apply(ctx, c) {
+		if result.Err != nil {
+			failed++
+		}
+	}
+
+	if failed > 0 {
+		return plan, fmt.Errorf("%d of %d changes failed", failed, len(plan.Changes))
+	}
+
+	return plan, nil
+}
+
+// A line per change like a Terraform plan, followed by a summary
+// + is created, ~ is updated and - is deleted.
+func (p ReconcilePlan) String() string {
+	var b strings.Builder
+	counts := map[ReconcileOperation]int{}
+
+	for _, change := range p.Changes {
+		counts[change.Operation]++
+
+		switch change.Operation {
+		case ReconcileCreate:
+			fmt.Fprintf(&b, "+ %s %s (%s)\n", change.Kind, change.Name, change.Desired.describe())
+		case ReconcileUpdate:
+			fmt.Fprintf(&b, "~ %s %s: %s\n", change.Kind, change.Name, strings.Join(change.differences(), ", "))
+		case ReconcileDelete:
+			fmt.Fprintf(&b, "- %s %s (%s)\n", change.Kind, change.Name, change.Current.describe())
+		}
+	}
+
+	fmt.Fprintf(&b, "Plan: %d to create, %d to update, %d to delete, %d unchanged\n",
+		counts[ReconcileCreate], counts[ReconcileUpdate], counts[ReconcileDelete], p.Unchanged)
+
+	return b.String()
+}
+
+func (e DesiredEntry) describe() string {
+	details := string(e.Category)
+	if e.Target != "" {
+		details += ", target " + e.Target
+	}
+	if e.Description != "" {
+		details += fmt.Sprintf(", %q", e.Description)
+	}
+	return details
+}
+
+// The fields an update changes, e.g. category safe -> phishing
+func (c ReconcileChange) differences() []string {
+	differences := []string{}
+
+	if c.Current.Category != c.Desired.Category {
+		differences = append(differences, fmt.Sprintf("category %s -> %s", c.Current.Category, c.Desired.Category))
+	}
+	if c.Desired.Description != "" && c.Current.Description != c.Desired.Description {
+		differences = append(differences, fmt.Sprintf("description %q -> %q", c.Current.Description, c.Desired.Description))
+	}
+	if c.Desired.Target != "" && c.Current.Target != c.Desired.Target {
+		differences = append(differences, fmt.Sprintf("target %q -> %q", c.Current.Target, c.Desired.Target))
+	}
+
+	return differences
+}
@@ -0,0 +1,127 @@
+package fishfish_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/existagon/fishfish-go"
+)
+
+// Serve domain and url lookups and record every change made to them
+func newTestMutableAPI(t *testing.T, domains map[string]fishfish.Domain, urls map[string]fishfish.URL) (*httptest.Server, *[]string) {
+	mx := sync.Mutex{}
+	requests := []string{}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mx.Lock()
+		defer mx.Unlock()
+
+		name := strings.TrimPrefix(r.URL.Path, "/domains/")
+
+		if r.Method != "GET" {
+			requests = append(requests, r.Method+" "+r.URL.EscapedPath())
+			json.NewEncoder(w).Encode(fishfish.Domain{Domain: name})
+			return
+		}
+
+		if url, ok := urls[strings.TrimPrefix(r.URL.Path, "/urls/")]; ok && strings.HasPrefix(r.URL.Path, "/urls/") {
+			json.NewEncoder(w).Encode(url)
+			return
+		}
+
+		domain, ok := domains[name]
+
+		if !strings.HasPrefix(r.URL.Path, "/domains/") || !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		json.NewEncoder(w).Encode(domain)
+	}))
+
+	t.Cleanup(server.Close)
+
+	return server, &requests
+}
+
+func TestReconcile(t *testing.T) {
+	server, requests := newTestMutableAPI(t, map[string]fishfish.Domain{
+		"kept.example":    {Domain: "kept.example", Category: fishfish.CategoryPhishing, Description: "kept"},
+		"changed.example": {Domain: "changed.example", Category: fishfish.CategorySafe, Description: "old"},
+		"removed.example": {Domain: "removed.example", Category: fishfish.CategoryPhishing},
+	}, map[string]fishfish.URL{
+		"https://sites.example/kept?id=1": {URL: "https://sites.example/kept?id=1", Category: fishfish.CategoryMalware},
+	})
+
+	client, err := fishfish.NewRawWithAPIURL(server.URL, "", []fishfish.APIPermission{fishfish.APIPermissionDomains, fishfish.APIPermissionURLs})
+	mustPanic(err)
+
+	desired, err := fishfish.ParseDesiredState([]byte(`{
+		"domains": {
+			"Kept.example": {"category": "phishing"},
+			"changed[.]example": {"category": "phishing", "description": "new"},
+			"removed.example": {"absent": true},
+			"gone.example": {"absent": true},
+			"new.example": {"category": "malware", "target": "Steam"}
+		},
+		"urls": {
+			"hxxps://sites.example/scam": {"category": "phishing"},
+			"https://sites.example/kept?id=1": {"category": "malware"}
+		}
+	}`))
+	mustPanic(err)
+
+	plan, err := client.Reconcile(context.Background(), *desired, fishfish.ReconcileOptions{DryRun: true})
+	mustPanic(err)
+
+	expectedPlan := `~ domain changed.example: category safe -> phishing, description "old" -> "new"
++ domain new.example (malware, target Steam)
+- domain removed.example (phishing)
++ url https://sites.example/scam (phishing)
+Plan: 2 to create, 1 to update, 1 to delete, 3 unchanged
+`
+	if plan.String() != expectedPlan {
+		panic(fmt.Errorf("expected plan:\n%s\ngot:\n%s", expectedPlan, plan.String()))
+	}
+
+	if len(*requests) != 0 || plan.Results != nil {
+		panic(fmt.Errorf("dry run made changes: %v", *requests))
+	}
+
+	plan, err = client.Reconcile(context.Background(), *desired, fishfish.ReconcileOptions{})
+	mustPanic(err)
+
+	if len(plan.Results) != len(plan.Changes) {
+		panic(fmt.Errorf("expected %d results, got %+v", len(plan.Changes), plan.Results))
+	}
+
+	expectedRequests := []string{
+		"PATCH /domains/changed.example",
+		"POST /domains/new.example",
+		"DELETE /domains/removed.example",
+		"POST /urls/https:%2F%2Fsites.example%2Fscam",
+	}
+	if !reflect.DeepEqual(*requests, expectedRequests) {
+		panic(fmt.Errorf("expected requests %v, got %v", expectedRequests, *requests))
+	}
+}
+
+func TestParseDesiredStateErrors(t *testing.T) {
+	for _, data := range []string{
+		`{"domains": {"a.example": {"category": "spam"}}}`,
+		`{"domains": {"a.example": {"category": "phishing"}, "A.example": {"category": "phishing"}}}`,
+		`{"domains": {"not a domain": {"category": "phishing"}}}`,
+		`{"domains": {}, "users": {}}`,
+	} {
+		if _, err := fishfish.ParseDesiredState([]byte(data)); err == nil {
+			panic(fmt.Errorf("expected an error for %s", data))
+		}
+	}
+}
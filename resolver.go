@@ -0,0 +1,282 @@
+package fishfish
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+const (
+	defaultMaxRedirects   = 10
+	defaultResolveTimeout = time.Second * 10
+)
+
+// A single request made while following redirects
+type RedirectHop struct {
+	URL string `json:"url"`
+	// The response status, zero if no request was made for this hop
+	StatusCode int     `json:"status_code,omitempty"`
+	Verdict    Verdict `json:"verdict"`
+}
+
+// Every URL visited while following redirects from a link, in order
+type RedirectChain struct {
+	Hops []RedirectHop `json:"hops"`
+	// Index of the first hop listed as phishing or malware, -1 if there is none
+	FirstMalicious int `json:"first_malicious"`
+	// Why the chain ended before reaching a page that doesn't redirect, e.g. a loop or a blocked address
+	Error string `json:"error,omitempty"`
+}
+
+// The final URL of the chain, after every redirect that was followed
+func (c RedirectChain) Final() string {
+	if len(c.Hops) == 0 {
+		return ""
+	}
+
+	return c.Hops[len(c.Hops)-1].URL
+}
+
+// The verdict of the first malicious hop, if any
+func (c RedirectChain) Malicious() (Verdict, bool) {
+	if c.FirstMalicious < 0 {
+		return Verdict{}, false
+	}
+
+	return c.Hops[c.FirstMalicious].Verdict, true
+}
+
+var errBlockedAddress = errors.New("address is private, loopback or otherwise not public")
+
+// Carrier-grade NAT addresses, which aren't covered by net.IP.IsPrivate
+var sharedAddressSpace = &net.IPNet{IP: net.IP{100, 64, 0, 0}, Mask: net.CIDRMask(10, 32)}
+
+// Follows redirects, such as those of URL shorteners, checking every hop
+// Following stops at the first malicious hop, so no request is ever made to a listed URL.
+type RedirectResolver struct {
+	checker Checker
+	// Used for every request, its redirect policy is replaced so each hop can be checked
+	// Defaults to a client that refuses to connect to non-public addresses, even after DNS changes.
+	Client *http.Client
+	// Maximum number of redirects followed, defaults to 10
+	MaxRedirects int
+	// Maximum time for the whole chain, defaults to 10 seconds
+	Timeout time.Duration
+	// Allow requests to private, loopback and link-local addresses, e.g. for local test servers
+	AllowPrivate bool
+
+	// Built when first needed, so connections are reused across chains
+	publicClient     *http.Client
+	publicClientOnce sync.Once
+}
+
+func NewRedirectResolver(checker Checker) *RedirectResolver {
+	return &RedirectResolver{checker: checker}
+}
+
+// Whether an address must not be requested, to avoid probing internal networks
+func isBlockedIP(ip net.IP) bool {
+	return ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() || ip.IsLinkLocalUnicast() ||
+		ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() || ip.IsMulticast() || sharedAddressSpace.Contains(ip)
+}
+
+// A client that checks every address it connects to, after DNS resolution
+func newPublicOnlyClient() *http.Client {
+	dialer := net.Dialer{
+		Timeout: defaultResolveTimeout,
+		Control: func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+
+			if err != nil {
+				return err
+			}
+
+			if ip := net.ParseIP(host); ip == nil || isBlockedIP(ip) {
+				return errBlockedAddress
+			}
+
+			return nil
+		},
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+
+	return &http.Client{Transport: transport}
+}
+
+// Resolve the host of a URL and make sure every address is public
+// Custom clients may connect to another address if DNS changes in between, the default client checks when dialing.
+func checkPublicHost(ctx context.Context, host string) error {
+	if ip := net.ParseIP(host); ip != nil {
+		if isBlockedIP(ip) {
+			return errBlockedAddress
+		}
+
+		return nil
+	}
+
+	addresses, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+
+	if err != nil {
+		return err
+	}
+
+	for _, address := range addresses {
+		if isBlockedIP(address.IP) {
+			return errBlockedAddress
+		}
+	}
+
+	return nil
+}
+
+// Make a HEAD request, falling back to GET for servers that don't support it
+func (r *RedirectResolver) request(ctx context.Context, client *http.Client, link string) (*http.Response, error) {
+	var res *http.Response
+
+	for _, method := range []string{http.MethodHead, http.MethodGet} {
+		req, err := http.NewRequestWithContext(ctx, method, link, nil)
+
+		if err != nil {
+			return nil, err
+		}
+
+		res, err = client.Do(req)
+
+		if err != nil {
+			return nil, err
+		}
+
+		// The body is never needed, only the status and Location header
+		res.Body.Close()
+
+		if res.StatusCode != http.StatusMethodNotAllowed && res.StatusCode != http.StatusNotImplemented {
+			break
+		}
+	}
+
+	return res, nil
+}
+
+// Follow redirects from a link, checking each hop
+func (r *RedirectResolver) Resolve(ctx context.Context, link string) RedirectChain {
+	chain := RedirectChain{Hops: []RedirectHop{}, FirstMalicious: -1}
+
+	timeout := r.Timeout
+	if timeout == 0 {
+		timeout = defaultResolveTimeout
+	}
+	maxRedirects := r.MaxRedirects
+	if maxRedirects == 0 {
+		maxRedirects = defaultMaxRedirects
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	// Copy so the original client keeps its own redirect policy
+	var client http.Client
+	switch {
+	case r.Client != nil:
+		client = *r.Client
+	case r.AllowPrivate:
+		client = http.Client{}
+	default:
+		r.publicClientOnce.Do(func() {
+			r.publicClient = newPublicOnlyClient()
+		})
+		client = *r.publicClient
+	}
+	client.CheckRedirect = func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}
+
+	link = Refang(strings.TrimSpace(link))
+	if !strings.Contains(link, "://") {
+		link = "http://" + link
+	}
+
+	visited := map[string]bool{}
+
+	for {
+		current, err := url.Parse(link)
+
+		if err != nil {
+			chain.Error = fmt.Sprintf("invalid url: %s", err)
+			return chain
+		}
+
+		hop := RedirectHop{URL: link, Verdict: r.checker.Check(ctx, link)}
+		chain.Hops = append(chain.Hops, hop)
+		last := &chain.Hops[len(chain.Hops)-1]
+
+		if hop.Verdict.Malicious() {
+			chain.FirstMalicious = len(chain.Hops) - 1
+			return chain
+		}
+
+		if current.Scheme != "http" && current.Scheme != "https" {
+			chain.Error = fmt.Sprintf("unsupported scheme: %s", current.Scheme)
+			return chain
+		}
+
+		key := link
+		if canonical, err := CanonicalizeURL(link); err == nil {
+			key = canonical
+		}
+
+		if visited[key] {
+			chain.Error = "redirect loop"
+			return chain
+		}
+
+		visited[key] = true
+
+		if !r.AllowPrivate && r.Client != nil {
+			if err := checkPublicHost(ctx, current.Hostname()); err != nil {
+				chain.Error = fmt.Sprintf("blocked %s: %s", current.Hostname(), err)
+				return chain
+			}
+		}
+
+		res, err := r.request(ctx, &client, link)
+
+		if err != nil {
+			chain.Error = err.Error()
+			return chain
+		}
+
+		last.StatusCode = res.StatusCode
+
+		if res.StatusCode < 300 || res.StatusCode >= 400 || res.StatusCode == http.StatusNotModified {
+			return chain
+		}
+
+		location, err := res.Location()
+
+		if errors.Is(err, http.ErrNoLocation) {
+			return chain
+		}
+
+		if err != nil {
+			chain.Error = fmt.Sprintf("invalid redirect: %s", err)
+			return chain
+		}
+
+		if len(chain.Hops) > maxRedirects {
+			chain.Error = fmt.Sprintf("more than %d redirects", maxRedirects)
+			return chain
+		}
+
+		link = location.String()
+	}
+}
@@ -0,0 +1,126 @@
+package fishfish_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/existagon/fishfish-go"
+)
+
+func newRedirectServer(t *testing.T) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/short":
+			http.Redirect(w, r, "/hop", http.StatusMovedPermanently)
+		case "/hop":
+			if r.Method == http.MethodHead {
+				w.WriteHeader(http.StatusMethodNotAllowed)
+				return
+			}
+			http.Redirect(w, r, "https://steamcommunity-gift.ru/login", http.StatusFound)
+		case "/a":
+			http.Redirect(w, r, "/b", http.StatusFound)
+		case "/b":
+			http.Redirect(w, r, "/a", http.StatusFound)
+		case "/landing":
+			w.WriteHeader(http.StatusOK)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	return server
+}
+
+func TestRedirectResolver(t *testing.T) {
+	server := newRedirectServer(t)
+	client := newTestAutoSync([]fishfish.Domain{
+		{Domain: "steamcommunity-gift.ru", Category: fishfish.CategoryPhishing},
+	}, nil)
+
+	resolver := fishfish.NewRedirectResolver(client)
+	resolver.Client = server.Client()
+	resolver.AllowPrivate = true
+
+	chain := resolver.Resolve(context.Background(), server.URL+"/short")
+	verdict, malicious := chain.Malicious()
+
+	if !malicious || len(chain.Hops) != 3 || chain.FirstMalicious != 2 || verdict.Domain.Domain != "steamcommunity-gift.ru" {
+		panic(fmt.Errorf("unexpected chain %+v", chain))
+	}
+
+	// The malicious hop is never requested
+	if chain.Hops[0].StatusCode != http.StatusMovedPermanently || chain.Hops[1].StatusCode != http.StatusFound || chain.Hops[2].StatusCode != 0 {
+		panic(fmt.Errorf("unexpected status codes %+v", chain.Hops))
+	}
+
+	if chain := resolver.Resolve(context.Background(), server.URL+"/a"); chain.Error != "redirect loop" || len(chain.Hops) != 3 {
+		panic(fmt.Errorf("expected a redirect loop, got %+v", chain))
+	}
+
+	if chain := resolver.Resolve(context.Background(), server.URL+"/landing"); chain.Error != "" || chain.FirstMalicious != -1 || chain.Final() != server.URL+"/landing" {
+		panic(fmt.Errorf("unexpected chain %+v", chain))
+	}
+
+	resolver.MaxRedirects = 1
+	if chain := resolver.Resolve(context.Background(), server.URL+"/short"); !strings.Contains(chain.Error, "redirects") {
+		panic(fmt.Errorf("expected too many redirects, got %+v", chain))
+	}
+}
+
+func TestRedirectResolverBlocksPrivate(t *testing.T) {
+	server := newRedirectServer(t)
+	client := newTestAutoSync(nil, nil)
+
+	// The default client checks addresses when connecting
+	chain := fishfish.NewRedirectResolver(client).Resolve(context.Background(), server.URL+"/landing")
+	if !strings.Contains(chain.Error, "not public") {
+		panic(fmt.Errorf("expected loopback address to be blocked, got %+v", chain))
+	}
+
+	resolver := fishfish.NewRedirectResolver(client)
+	resolver.Client = server.Client()
+
+	if chain := resolver.Resolve(context.Background(), server.URL+"/landing"); !strings.Contains(chain.Error, "blocked") {
+		panic(fmt.Errorf("expected loopback address to be blocked, got %+v", chain))
+	}
+}
+
+func TestScannerResolvesRedirects(t *testing.T) {
+	server := newRedirectServer(t)
+	client := newTestAutoSync([]fishfish.Domain{
+		{Domain: "steamcommunity-gift.ru", Category: fishfish.CategoryPhishing},
+	}, nil)
+
+	scanner := fishfish.NewScanner(client)
+	scanner.Resolver = fishfish.NewRedirectResolver(client)
+	scanner.Resolver.AllowPrivate = true
+
+	findings := scanner.Scan(context.Background(), "free skins at "+server.URL+"/short !")
+
+	if len(findings) != 1 || !findings[0].Verdict.Malicious() || findings[0].Redirects == nil || len(findings[0].Redirects.Hops) != 3 {
+		panic(fmt.Errorf("expected the shortened link to be malicious, got %+v", findings))
+	}
+}
+
+func TestScannerSkipsSafeLinks(t *testing.T) {
+	server := newRedirectServer(t)
+	client := newTestAutoSync(nil, []fishfish.URL{
+		{URL: server.URL + "/short", Category: fishfish.CategorySafe},
+	})
+
+	scanner := fishfish.NewScanner(client)
+	scanner.Resolver = fishfish.NewRedirectResolver(client)
+	scanner.Resolver.AllowPrivate = true
+
+	findings := scanner.Scan(context.Background(), "see "+server.URL+"/short")
+
+	if len(findings) != 1 || !findings[0].Verdict.Safe() || findings[0].Redirects != nil {
+		panic(fmt.Errorf("expected the safe link not to be resolved, got %+v", findings))
+	}
+}
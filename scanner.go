@@ -0,0 +1,192 @@
+package fishfish
+
+import (
+	"context"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// Anything that can check a domain, url or bare host, such as AutoSyncClient and RawClient
+type Checker interface {
+	Check(ctx context.Context, input string) Verdict
+}
+
+// A link found in text
+type Finding struct {
+	// Byte offsets of the link in the scanned text, End is exclusive
+	Start int `json:"start"`
+	End   int `json:"end"`
+	// The link with any obfuscation removed
+	Link string `json:"link"`
+	// The link in a form that is safe to share, only set if Scanner.DefangOutput is enabled
+	Defanged string  `json:"defanged,omitempty"`
+	Verdict  Verdict `json:"verdict"`
+	// The redirects followed from the link, only set if Scanner.Resolver is set
+	// If any hop is malicious, Verdict is the verdict of the first malicious hop.
+	Redirects *RedirectChain `json:"redirects,omitempty"`
+}
+
+// Extracts links from free text, such as chat messages, and checks each of them
+type Scanner struct {
+	checker Checker
+	// Also provide a defanged copy of each link, see Defang
+	DefangOutput bool
+	// Follow redirects from links that aren't already known to be malicious or safe, e.g. from URL shorteners
+	Resolver *RedirectResolver
+}
+
+func NewScanner(checker Checker) *Scanner {
+	return &Scanner{checker: checker}
+}
+
+// Characters that render as nothing and are used to break up links
+var zeroWidthChars = map[rune]bool{
+	'\u00ad': true, // Soft hyphen
+	'\u180e': true, // Mongolian vowel separator
+	'\u200b': true, // Zero width space
+	'\u200c': true, // Zero width non-joiner
+	'\u200d': true, // Zero width joiner
+	'\u2060': true, // Word joiner
+	'\ufeff': true, // Zero width no-break space
+}
+
+// Characters that end a link, square brackets are excluded so markdown links split correctly
+const linkChars = `[^\s<>"'\x60\[\]]`
+
+// Dots and scheme separators as written in defanged indicators, see Refang
+const (
+	linkDot       = `(?:\.|\[\.\]|\(\.\)|\{\.\}|\[dot\]|\(dot\)|\{dot\})`
+	linkSeparator = `(?:://|\[://\]|\[:\]//)`
+)
+
+var linkPattern = regexp.MustCompile(`(?i)` +
+	// Links with a scheme, possibly defanged or with an IPv6 host
+	`\b(?:h(?:tt|xx)ps?|ftp|fxp)` + linkSeparator + `(?:\[[0-9a-f:.]+\](?:` + linkDot + `|` + linkChars + `)*|(?:` + linkDot + `|` + linkChars + `)+)` +
+	// Bare domains, optionally with a port and path
+	`|\b(?:[a-z0-9](?:[a-z0-9-]{0,61}[a-z0-9])?` + linkDot + `)+[a-z][a-z0-9-]{0,62}[a-z0-9]\b(?::\d{1,5})?(?:/` + linkChars + `*)?`,
+)
+
+// Find every link in text, without checking them
+func (s *Scanner) Extract(text string) []Finding {
+	cleaned, offsets := removeZeroWidth(text)
+	findings := []Finding{}
+
+	for _, loc := range linkPattern.FindAllStringIndex(cleaned, -1) {
+		start, end := loc[0], loc[1]
+
+		// Skip the domain of email addresses
+		if start > 0 && cleaned[start-1] == '@' {
+			continue
+		}
+
+		trimmed := trimLinkPunctuation(cleaned[start:end])
+		end = start + len(trimmed)
+		link := Refang(trimmed)
+
+		if !strings.Contains(link, "://") && !hasKnownTLD(link) {
+			// Most likely a file name or an abbreviation
+			continue
+		}
+
+		finding := Finding{
+			Start: offsets[start],
+			End:   offsets[end],
+			Link:  link,
+		}
+
+		if s.DefangOutput {
+			finding.Defanged = Defang(link)
+		}
+
+		findings = append(findings, finding)
+	}
+
+	return findings
+}
+
+// Find and check every link in text
+func (s *Scanner) Scan(ctx context.Context, text string) []Finding {
+	findings := s.Extract(text)
+
+	for i := range findings {
+		findings[i].Verdict = s.checker.Check(ctx, findings[i].Link)
+
+		if s.Resolver == nil || findings[i].Verdict.Malicious() || findings[i].Verdict.Safe() {
+			continue
+		}
+
+		chain := s.Resolver.Resolve(ctx, findings[i].Link)
+		findings[i].Redirects = &chain
+
+		if verdict, ok := chain.Malicious(); ok {
+			findings[i].Verdict = verdict
+		}
+	}
+
+	return findings
+}
+
+// Remove zero width characters, returning the original byte offset of each byte in the result
+// The offsets have one more element than the result, the end of the original text.
+func removeZeroWidth(text string) (string, []int) {
+	var cleaned strings.Builder
+	offsets := make([]int, 0, len(text)+1)
+
+	for i, r := range text {
+		if zeroWidthChars[r] {
+			continue
+		}
+
+		// Invalid UTF-8 is kept byte for byte
+		_, size := utf8.DecodeRuneInString(text[i:])
+
+		for j := 0; j < size; j++ {
+			offsets = append(offsets, i+j)
+		}
+
+		cleaned.WriteString(text[i : i+size])
+	}
+
+	offsets = append(offsets, len(text))
+
+	return cleaned.String(), offsets
+}
+
+// Remove punctuation that ends a sentence or closes surrounding brackets rather than belonging to the link
+func trimLinkPunctuation(link string) string {
+	for len(link) > 0 {
+		last := link[len(link)-1]
+
+		switch last {
+		case '.', ',', ';', ':', '!', '?', '*', '_', '~', '|':
+			link = link[:len(link)-1]
+			continue
+		case ')', ']', '}':
+			open := map[byte]byte{')': '(', ']': '[', '}': '{'}[last]
+
+			// Keep brackets that are part of the link, e.g. wiki/Foo_(bar)
+			if strings.Count(link, string(open)) < strings.Count(link, string(last)) {
+				link = link[:len(link)-1]
+				continue
+			}
+		}
+
+		return link
+	}
+
+	return link
+}
+
+// Whether the host of a link without a scheme ends in a TLD from the public suffix list
+func hasKnownTLD(link string) bool {
+	host := link
+
+	if i := strings.IndexAny(host, ":/"); i >= 0 {
+		host = host[:i]
+	}
+
+	tld := strings.ToLower(host[strings.LastIndex(host, ".")+1:])
+
+	return DefaultPublicSuffixList().rules[tld] != 0
+}
@@ -0,0 +1,47 @@
+package fishfish_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/existagon/fishfish-go"
+)
+
+func TestScanner(t *testing.T) {
+	client := newTestAutoSync([]fishfish.Domain{
+		{Domain: "steamcommunity-gift.ru", Category: fishfish.CategoryPhishing},
+		{Domain: "discord.com", Category: fishfish.CategorySafe},
+	}, nil)
+
+	text := "free nitro! [discord.com](https://steamcommunity-gift.ru/claim), see <https://discord.com/app> " +
+		"or login.steam\u200bcommunity-gift.ru. (mail me at admin@example.com, not notes.txt)"
+
+	findings := fishfish.NewScanner(client).Scan(context.Background(), text)
+
+	expected := []struct {
+		link     string
+		category fishfish.Category
+	}{
+		{"discord.com", fishfish.CategorySafe},
+		{"https://steamcommunity-gift.ru/claim", fishfish.CategoryPhishing},
+		{"https://discord.com/app", fishfish.CategorySafe},
+		{"login.steamcommunity-gift.ru", fishfish.CategoryPhishing},
+	}
+
+	if len(findings) != len(expected) {
+		panic(fmt.Errorf("expected %d findings, got %v", len(expected), findings))
+	}
+
+	for i, finding := range findings {
+		if finding.Link != expected[i].link || finding.Verdict.Category != expected[i].category {
+			panic(fmt.Errorf("finding %d: expected %s (%s), got %s (%s)", i, expected[i].link, expected[i].category, finding.Link, finding.Verdict.Category))
+		}
+	}
+
+	// Offsets refer to the original text, including the zero width space
+	obfuscated := findings[3]
+	if text[obfuscated.Start:obfuscated.End] != "login.steam\u200bcommunity-gift.ru" {
+		panic(fmt.Errorf("unexpected offsets %d-%d: %q", obfuscated.Start, obfuscated.End, text[obfuscated.Start:obfuscated.End]))
+	}
+}
@@ -0,0 +1,82 @@
+package fishfish
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+)
+
+// Every domain and url of a cache at one point in time, e.g. to start without fetching from the API
+type Snapshot struct {
+	Generated time.Time `json:"generated"`
+	Domains   []Domain  `json:"domains"`
+	URLs      []URL     `json:"urls"`
+}
+
+// A snapshot of the cache, sorted by name
+// Empty in filter storage mode, which doesn't keep the entries.
+func (c *AutoSyncClient) Snapshot() Snapshot {
+	snapshot := Snapshot{Generated: time.Now().UTC(), Domains: c.GetDomains(), URLs: c.GetURLs()}
+
+	sort.Slice(snapshot.Domains, func(i, j int) bool { return snapshot.Domains[i].Domain < snapshot.Domains[j].Domain })
+	sort.Slice(snapshot.URLs, func(i, j int) bool { return snapshot.URLs[i].URL < snapshot.URLs[j].URL })
+
+	return snapshot
+}
+
+// Replace the cache with the entries of a snapshot
+// The client reports being backed by the snapshot in its status until the initial sync has finished.
+func (c *AutoSyncClient) LoadSnapshot(snapshot Snapshot) error {
+	domains := make(map[string]Domain, len(snapshot.Domains))
+	for _, domain := range snapshot.Domains {
+		domains[domain.Domain] = domain
+	}
+
+	urls := make(map[string]URL, len(snapshot.URLs))
+	for _, url := range snapshot.URLs {
+		urls[url.URL] = url
+	}
+
+	if err := c.replaceCache(domains, urls); err != nil {
+		return fmt.Errorf("failed to load snapshot: %s", err)
+	}
+
+	generated := snapshot.Generated
+	if generated.IsZero() {
+		// Still report being backed by the snapshot, e.g. for one written by hand
+		generated = time.Now()
+	}
+
+	c.status.recordSnapshot(generated)
+
+	return nil
+}
+
+// Save the snapshot to a JSON file, replacing it atomically
+func (s Snapshot) Save(path string) error {
+	data, err := json.Marshal(s)
+
+	if err != nil {
+		return err
+	}
+
+	return writeFileAtomic(path, append(data, '\n'))
+}
+
+func LoadSnapshotFile(path string) (*Snapshot, error) {
+	data, err := os.ReadFile(path)
+
+	if err != nil {
+		return nil, err
+	}
+
+	snapshot := Snapshot{}
+
+	if err := json.Unmarshal(data, &snapshot); err != nil {
+		return nil, fmt.Errorf("failed to parse snapshot: %s", err)
+	}
+
+	return &snapshot, nil
+}
@@ -0,0 +1,87 @@
+package fishfish_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/existagon/fishfish-go"
+)
+
+func TestSnapshotRoundTrip(t *testing.T) {
+	client := newTestAutoSync([]fishfish.Domain{
+		{Domain: "phish.example", Category: fishfish.CategoryPhishing, Target: "Steam"},
+		{Domain: "a.example", Category: fishfish.CategorySafe},
+	}, []fishfish.URL{
+		{URL: "https://sites.example/scam", Category: fishfish.CategoryMalware},
+	})
+
+	snapshot := client.Snapshot()
+
+	if len(snapshot.Domains) != 2 || snapshot.Domains[0].Domain != "a.example" || len(snapshot.URLs) != 1 {
+		panic(fmt.Errorf("unexpected snapshot %+v", snapshot))
+	}
+
+	path := filepath.Join(t.TempDir(), "snapshot.json")
+	mustPanic(snapshot.Save(path))
+
+	loaded, err := fishfish.LoadSnapshotFile(path)
+	mustPanic(err)
+
+	if !reflect.DeepEqual(loaded.Domains, snapshot.Domains) || !reflect.DeepEqual(loaded.URLs, snapshot.URLs) {
+		panic(fmt.Errorf("expected %+v, got %+v", snapshot, loaded))
+	}
+
+	restored := newTestAutoSync(nil, nil)
+	mustPanic(restored.LoadSnapshot(*loaded))
+
+	if verdict := restored.Check(context.Background(), "login.phish.example"); verdict.Category != fishfish.CategoryPhishing {
+		panic(fmt.Errorf("expected the restored cache to list subdomains of phish.example, got %+v", verdict))
+	}
+
+	if verdict := restored.Check(context.Background(), "https://sites.example/scam"); verdict.Category != fishfish.CategoryMalware {
+		panic(fmt.Errorf("expected the restored cache to list the url, got %+v", verdict))
+	}
+
+	// Lookups are served from the snapshot before the initial sync
+	if status := restored.Status(); status.Ready || !status.SnapshotGenerated.Equal(snapshot.Generated) {
+		panic(fmt.Errorf("expected a snapshot-backed status, got %+v", status))
+	}
+
+	res := httptest.NewRecorder()
+	restored.HealthHandler(time.Hour).ServeHTTP(res, httptest.NewRequest("GET", "/healthz", nil))
+
+	if res.Code != http.StatusOK {
+		panic(fmt.Errorf("expected health status 200 with a snapshot, got %d", res.Code))
+	}
+}
+
+func TestSnapshotSaveKeepsMode(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "snapshot.json")
+	snapshot := newTestAutoSync(nil, nil).Snapshot()
+
+	mustPanic(snapshot.Save(path))
+
+	info, err := os.Stat(path)
+	mustPanic(err)
+
+	if info.Mode().Perm() != 0o644 {
+		panic(fmt.Errorf("expected a new snapshot to have mode 0644, got %v", info.Mode()))
+	}
+
+	mustPanic(os.Chmod(path, 0o640))
+	mustPanic(snapshot.Save(path))
+
+	info, err = os.Stat(path)
+	mustPanic(err)
+
+	if info.Mode().Perm() != 0o640 {
+		panic(fmt.Errorf("expected the snapshot to keep mode 0640, got %v", info.Mode()))
+	}
+}
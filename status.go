@@ -0,0 +1,202 @@
+package fishfish
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Snapshot of the health of an AutoSync client
+type AutoSyncStatus struct {
+	// Whether the initial sync has finished
+	Ready    bool      `json:"ready"`
+	LastSync time.Time `json:"last_sync"`
+	// When the snapshot the cache was loaded from was generated, zero if none was loaded
+	// Lookups are answered from the snapshot until the initial sync has finished.
+	SnapshotGenerated time.Time `json:"snapshot_generated"`
+	// The most recent error, which may have been recovered from since
+	LastError     string    `json:"last_error,omitempty"`
+	LastErrorTime time.Time `json:"last_error_time"`
+	// Whether the event source is currently connected, as reported by the source or once it delivers an event
+	StreamConnected bool      `json:"stream_connected"`
+	LastEvent       time.Time `json:"last_event"`
+	// Number of cached entries per category
+	Domains      map[Category]int `json:"domains"`
+	URLs         map[Category]int `json:"urls"`
+	TokenExpires time.Time        `json:"token_expires"`
+	// Number of entries of each feed other than FishFish
+	Feeds map[string]int `json:"feeds,omitempty"`
+	// Size of the filter in filter storage mode
+	FilterEntries int `json:"filter_entries,omitempty"`
+	FilterBytes   int `json:"filter_bytes,omitempty"`
+}
+
+type syncStatus struct {
+	mx              sync.RWMutex
+	ready           chan struct{}
+	readyOnce       sync.Once
+	lastSync        time.Time
+	lastSnapshot    time.Time
+	lastError       error
+	lastErrorTime   time.Time
+	streamConnected bool
+	lastEvent       time.Time
+}
+
+func newSyncStatus() *syncStatus {
+	return &syncStatus{ready: make(chan struct{})}
+}
+
+func (s *syncStatus) recordSync(at time.Time) {
+	s.mx.Lock()
+	s.lastSync = at
+	s.mx.Unlock()
+
+	s.readyOnce.Do(func() {
+		close(s.ready)
+	})
+}
+
+func (s *syncStatus) recordSnapshot(generated time.Time) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	s.lastSnapshot = generated
+}
+
+func (s *syncStatus) recordError(err error, at time.Time) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	s.lastError = err
+	s.lastErrorTime = at
+}
+
+func (s *syncStatus) recordEvent(at time.Time) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	s.lastEvent = at
+}
+
+func (s *syncStatus) setStreamConnected(connected bool) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	s.streamConnected = connected
+}
+
+// When the cache was last updated by a full sync or an event
+func (s *syncStatus) dataAsOf() time.Time {
+	s.mx.RLock()
+	defer s.mx.RUnlock()
+
+	if s.lastEvent.After(s.lastSync) {
+		return s.lastEvent
+	}
+
+	return s.lastSync
+}
+
+// Closed once the initial sync has finished and lookups reflect the API
+func (c *AutoSyncClient) Ready() <-chan struct{} {
+	return c.status.ready
+}
+
+// Block until the initial sync has finished or ctx is cancelled
+func (c *AutoSyncClient) WaitReady(ctx context.Context) error {
+	select {
+	case <-c.status.ready:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (c *AutoSyncClient) Status() AutoSyncStatus {
+	status := AutoSyncStatus{
+		Domains: map[Category]int{},
+		URLs:    map[Category]int{},
+	}
+
+	select {
+	case <-c.status.ready:
+		status.Ready = true
+	default:
+	}
+
+	c.status.mx.RLock()
+	status.LastSync = c.status.lastSync
+	status.SnapshotGenerated = c.status.lastSnapshot
+	status.LastErrorTime = c.status.lastErrorTime
+	status.StreamConnected = c.status.streamConnected
+	status.LastEvent = c.status.lastEvent
+	if c.status.lastError != nil {
+		status.LastError = c.status.lastError.Error()
+	}
+	c.status.mx.RUnlock()
+
+	c.cache.mx.RLock()
+	for _, d := range c.cache.domainIndex {
+		status.Domains[d.Category]++
+	}
+	for _, u := range c.cache.urlIndex {
+		status.URLs[u.Category]++
+	}
+	if c.cache.filter != nil {
+		status.FilterEntries = c.cache.filter.Len()
+		status.FilterBytes = c.cache.filter.SizeBytes()
+	}
+	c.cache.mx.RUnlock()
+
+	c.feeds.mx.RLock()
+	for name, cache := range c.feeds.caches {
+		if status.Feeds == nil {
+			status.Feeds = map[string]int{}
+		}
+
+		cache.mx.RLock()
+		status.Feeds[name] = len(cache.domainIndex) + len(cache.urlIndex)
+		cache.mx.RUnlock()
+	}
+	c.feeds.mx.RUnlock()
+
+	if expires := c.raw.GetSessionToken().Expires; expires > 0 {
+		status.TokenExpires = time.Unix(expires, 0)
+	}
+
+	return status
+}
+
+// An http.Handler for health probes, responding with the status as JSON
+// Responds with 503 Service Unavailable until the initial sync has finished or a snapshot was loaded,
+// or if maxSyncAge is positive and the data is older than it.
+func (c *AutoSyncClient) HealthHandler(maxSyncAge time.Duration) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		status := c.Status()
+		healthy := status.Ready
+		asOf := status.LastSync
+
+		// Serving from a snapshot until the initial sync has finished
+		if !status.Ready && !status.SnapshotGenerated.IsZero() {
+			healthy = true
+			asOf = status.SnapshotGenerated
+		}
+
+		if maxSyncAge > 0 && time.Since(asOf) > maxSyncAge {
+			healthy = false
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+
+		if healthy {
+			w.WriteHeader(http.StatusOK)
+		} else {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+
+		json.NewEncoder(w).Encode(status)
+	})
+}
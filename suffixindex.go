@@ -0,0 +1,222 @@
+package fishfish
+
+import (
+	"fmt"
+	"net"
+	"strings"
+)
+
+type MatchType string
+
+const (
+	// The host itself is listed
+	MatchTypeExact = "exact"
+	// A parent domain of the host is listed
+	MatchTypeParent = "parent"
+	// A wildcard entry such as *.example.com covers the host
+	MatchTypeWildcard = "wildcard"
+)
+
+// The listed domain that applies to a host
+type DomainMatch struct {
+	// The normalized host that was looked up
+	Host      string    `json:"host"`
+	Domain    Domain    `json:"domain"`
+	MatchType MatchType `json:"match_type"`
+}
+
+// Index of listed domain names by their labels in reverse, e.g. com -> example -> www
+type suffixIndex struct {
+	root *suffixNode
+}
+
+type suffixNode struct {
+	children map[string]*suffixNode
+	// Name of the entry listed for exactly this domain
+	name string
+	// Name of the wildcard entry listed for subdomains of this domain
+	wildcardName string
+}
+
+func newSuffixIndex() *suffixIndex {
+	return &suffixIndex{root: &suffixNode{}}
+}
+
+func newSuffixIndexFromDomains(domains map[string]Domain) *suffixIndex {
+	index := newSuffixIndex()
+
+	for name := range domains {
+		index.insert(name)
+	}
+
+	return index
+}
+
+func (i *suffixIndex) insert(name string) {
+	labels, wildcard := indexLabels(name)
+
+	if len(labels) == 0 {
+		return
+	}
+
+	node := i.root
+	for n := len(labels) - 1; n >= 0; n-- {
+		child, ok := node.children[labels[n]]
+
+		if !ok {
+			child = &suffixNode{}
+
+			if node.children == nil {
+				node.children = map[string]*suffixNode{}
+			}
+			node.children[labels[n]] = child
+		}
+
+		node = child
+	}
+
+	if wildcard {
+		node.wildcardName = name
+	} else {
+		node.name = name
+	}
+}
+
+func (i *suffixIndex) remove(name string) {
+	labels, wildcard := indexLabels(name)
+
+	if len(labels) == 0 {
+		return
+	}
+
+	path := []*suffixNode{i.root}
+	node := i.root
+	for n := len(labels) - 1; n >= 0; n-- {
+		child, ok := node.children[labels[n]]
+
+		if !ok {
+			// Not indexed
+			return
+		}
+
+		node = child
+		path = append(path, node)
+	}
+
+	if wildcard {
+		node.wildcardName = ""
+	} else {
+		node.name = ""
+	}
+
+	// Prune nodes that no longer lead to any entry
+	for n := len(path) - 1; n > 0; n-- {
+		current := path[n]
+
+		if current.name != "" || current.wildcardName != "" || len(current.children) > 0 {
+			return
+		}
+
+		delete(path[n-1].children, labels[len(labels)-n])
+	}
+}
+
+// Find the name of the most specific entry covering host, which must already be normalized
+// Listed public suffixes, such as co.uk, don't cover their subdomains unless listed as a wildcard
+func (i *suffixIndex) lookup(host string, suffixList *PublicSuffixList) (string, MatchType, bool) {
+	labels := strings.Split(host, ".")
+	suffixLen, _ := suffixList.suffixLabels(labels)
+
+	var bestName string
+	var bestType MatchType
+	node := i.root
+
+	for n := len(labels) - 1; n >= 0; n-- {
+		child, ok := node.children[labels[n]]
+
+		if !ok {
+			break
+		}
+
+		node = child
+
+		if n == 0 {
+			if node.name != "" {
+				return node.name, MatchTypeExact, true
+			}
+			break
+		}
+
+		// Wildcards only cover subdomains, and are the more explicit rule for them
+		if node.wildcardName != "" {
+			bestName, bestType = node.wildcardName, MatchTypeWildcard
+		} else if node.name != "" && len(labels)-n > suffixLen {
+			bestName, bestType = node.name, MatchTypeParent
+		}
+	}
+
+	return bestName, bestType, bestName != ""
+}
+
+// Split a listed name into normalized labels, reporting whether it is a wildcard entry
+func indexLabels(name string) ([]string, bool) {
+	name = normalizeHost(name)
+	wildcard := strings.HasPrefix(name, "*.")
+
+	if wildcard {
+		name = strings.TrimPrefix(name, "*.")
+	}
+
+	if name == "" {
+		return nil, false
+	}
+
+	return strings.Split(name, "."), wildcard
+}
+
+// Refang and lowercase a host and remove any port, brackets and trailing dot
+func normalizeHost(host string) string {
+	host = Refang(strings.TrimSpace(host))
+
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+
+	host = strings.TrimPrefix(host, "[")
+	host = strings.TrimSuffix(host, "]")
+	host = strings.TrimSuffix(host, ".")
+
+	return strings.ToLower(host)
+}
+
+// Find the most specific listed domain covering host
+// An exact entry always wins, so a safe subdomain can override a malicious parent and vice versa.
+// Parent domains are only considered down to the registrable domain, see EffectiveTLDPlusOne.
+func (c *AutoSyncClient) MatchDomain(host string) (*DomainMatch, error) {
+	match, ok := c.cache.matchDomain(host)
+
+	if !ok {
+		return nil, fmt.Errorf("no listed domain matches %s", normalizeHost(host))
+	}
+
+	return match, nil
+}
+
+func (c *domainCache) matchDomain(host string) (*DomainMatch, bool) {
+	host = normalizeHost(host)
+
+	c.mx.RLock()
+	defer c.mx.RUnlock()
+
+	name, matchType, ok := c.suffixIndex.lookup(host, DefaultPublicSuffixList())
+
+	if !ok {
+		return nil, false
+	}
+
+	return &DomainMatch{
+		Host:      host,
+		Domain:    c.domainIndex[name],
+		MatchType: matchType,
+	}, true
+}
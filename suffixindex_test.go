@@ -0,0 +1,53 @@
+package fishfish_test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/existagon/fishfish-go"
+)
+
+func TestMatchDomain(t *testing.T) {
+	client := newTestAutoSync([]fishfish.Domain{
+		{Domain: "steamcommunity-gift.ru", Category: fishfish.CategoryPhishing},
+		{Domain: "*.free-nitro.example", Category: fishfish.CategoryMalware},
+		{Domain: "sites.example", Category: fishfish.CategoryPhishing},
+		{Domain: "docs.sites.example", Category: fishfish.CategorySafe},
+	}, nil)
+
+	tests := []struct {
+		host      string
+		domain    string
+		matchType fishfish.MatchType
+	}{
+		{"steamcommunity-gift.ru", "steamcommunity-gift.ru", fishfish.MatchTypeExact},
+		{"login.steamcommunity-gift.ru", "steamcommunity-gift.ru", fishfish.MatchTypeParent},
+		{"WWW.SteamCommunity-Gift.ru.", "steamcommunity-gift.ru", fishfish.MatchTypeParent},
+		{"claim.free-nitro.example", "*.free-nitro.example", fishfish.MatchTypeWildcard},
+		{"docs.sites.example", "docs.sites.example", fishfish.MatchTypeExact},
+		{"api.docs.sites.example", "docs.sites.example", fishfish.MatchTypeParent},
+		{"evil.sites.example:8080", "sites.example", fishfish.MatchTypeParent},
+	}
+
+	for _, test := range tests {
+		match, err := client.MatchDomain(test.host)
+		mustPanic(err)
+
+		if match.Domain.Domain != test.domain || match.MatchType != test.matchType {
+			panic(fmt.Errorf("%s: expected %s (%s), got %s (%s)", test.host, test.domain, test.matchType, match.Domain.Domain, match.MatchType))
+		}
+	}
+
+	// A wildcard doesn't cover the domain itself
+	if _, err := client.MatchDomain("free-nitro.example"); err == nil {
+		panic("expected no match for free-nitro.example")
+	}
+
+	mustPanic(client.ApplyEvent(fishfish.WSEvent{Type: fishfish.WSEventTypeDomainDelete, Data: fishfish.WSDeleteDomainData{
+		Domain: "steamcommunity-gift.ru",
+	}}))
+
+	if _, err := client.MatchDomain("login.steamcommunity-gift.ru"); err == nil {
+		panic("expected no match after delete")
+	}
+}
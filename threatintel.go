@@ -0,0 +1,544 @@
+package fishfish
+
+import (
+	"crypto/sha1"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Namespace of the name-based UUIDs of exported objects, so the same entry always gets the same ID
+var threatIntelNamespace = [16]byte{0x6f, 0x1c, 0x53, 0x0e, 0x8d, 0x3a, 0x4b, 0x52, 0x9a, 0x61, 0x0c, 0x7e, 0x2d, 0x44, 0x19, 0xb3}
+
+// A version 5 UUID, see RFC 4122
+func nameUUID(name string) string {
+	h := sha1.New()
+	h.Write(threatIntelNamespace[:])
+	h.Write([]byte(name))
+	sum := h.Sum(nil)
+
+	sum[6] = sum[6]&0x0f | 0x50
+	sum[8] = sum[8]&0x3f | 0x80
+
+	return fmt.Sprintf("%x-%x-%x-%x-%x", sum[0:4], sum[4:6], sum[6:8], sum[8:10], sum[10:16])
+}
+
+const stixTimestampFormat = "2006-01-02T15:04:05.000Z"
+
+func stixTimestamp(t time.Time) string {
+	return t.UTC().Format(stixTimestampFormat)
+}
+
+// The identity every exported indicator is created by
+var stixIdentityID = "identity--" + nameUUID("identity:fishfish")
+
+type ThreatIntelOptions struct {
+	// Categories to include, defaults to phishing and malware
+	Categories []Category
+	// When the export was made, defaults to now
+	Generated time.Time
+	// The info of MISP events, defaults to a description of the export
+	EventInfo string
+}
+
+func (o ThreatIntelOptions) withDefaults() ThreatIntelOptions {
+	if len(o.Categories) == 0 {
+		o.Categories = []Category{CategoryPhishing, CategoryMalware}
+	}
+	if o.Generated.IsZero() {
+		o.Generated = time.Now()
+	}
+
+	return o
+}
+
+// A STIX 2.1 bundle
+type STIXBundle struct {
+	Type    string `json:"type"`
+	ID      string `json:"id"`
+	Objects []any  `json:"objects"`
+}
+
+type STIXIdentity struct {
+	Type          string `json:"type"`
+	SpecVersion   string `json:"spec_version"`
+	ID            string `json:"id"`
+	Created       string `json:"created"`
+	Modified      string `json:"modified"`
+	Name          string `json:"name"`
+	IdentityClass string `json:"identity_class"`
+}
+
+type STIXIndicator struct {
+	Type           string   `json:"type"`
+	SpecVersion    string   `json:"spec_version"`
+	ID             string   `json:"id"`
+	CreatedByRef   string   `json:"created_by_ref"`
+	Created        string   `json:"created"`
+	Modified       string   `json:"modified"`
+	Name           string   `json:"name"`
+	Description    string   `json:"description,omitempty"`
+	IndicatorTypes []string `json:"indicator_types"`
+	Pattern        string   `json:"pattern"`
+	PatternType    string   `json:"pattern_type"`
+	ValidFrom      string   `json:"valid_from"`
+	Labels         []string `json:"labels"`
+	Revoked        bool     `json:"revoked,omitempty"`
+	// The brand or service the entry imitates, a custom property
+	Target string `json:"x_fishfish_target,omitempty"`
+}
+
+// A MISP event, as accepted by the MISP API and feeds
+type MISPEvent struct {
+	Event MISPEventBody `json:"Event"`
+}
+
+type MISPEventBody struct {
+	UUID          string          `json:"uuid"`
+	Info          string          `json:"info"`
+	Date          string          `json:"date"`
+	Timestamp     string          `json:"timestamp"`
+	ThreatLevelID string          `json:"threat_level_id"`
+	Analysis      string          `json:"analysis"`
+	Distribution  string          `json:"distribution"`
+	Tag           []MISPTag       `json:"Tag"`
+	Attribute     []MISPAttribute `json:"Attribute"`
+}
+
+type MISPAttribute struct {
+	UUID      string    `json:"uuid"`
+	Type      string    `json:"type"`
+	Category  string    `json:"category"`
+	Value     string    `json:"value"`
+	ToIDS     bool      `json:"to_ids"`
+	Comment   string    `json:"comment,omitempty"`
+	Timestamp string    `json:"timestamp"`
+	Deleted   bool      `json:"deleted,omitempty"`
+	Tag       []MISPTag `json:"Tag"`
+}
+
+type MISPTag struct {
+	Name string `json:"name"`
+}
+
+// A domain or url in the form shared by every threat intel format
+type threatIntelEntry struct {
+	// domain or url
+	kind        string
+	value       string
+	category    Category
+	description string
+	target      string
+	added       time.Time
+	modified    time.Time
+	deleted     bool
+}
+
+func (e threatIntelEntry) key() string {
+	return e.kind + ":" + e.value
+}
+
+// Zero seconds means the time isn't known, not 1970
+func unixTime(seconds int64) time.Time {
+	if seconds == 0 {
+		return time.Time{}
+	}
+
+	return time.Unix(seconds, 0)
+}
+
+// Entries without an added time fall back to their modification time, or the time of the export
+func (e threatIntelEntry) withFallbackTimes(generated time.Time) threatIntelEntry {
+	if e.added.IsZero() {
+		e.added = e.modified
+	}
+	if e.added.IsZero() {
+		e.added = generated
+	}
+
+	return e
+}
+
+// Entries that were never checked have no modification time
+func (e threatIntelEntry) lastModified() time.Time {
+	if e.modified.Before(e.added) {
+		return e.added
+	}
+
+	return e.modified
+}
+
+func domainEntry(domain Domain) threatIntelEntry {
+	return threatIntelEntry{
+		kind:        "domain",
+		value:       domain.Domain,
+		category:    domain.Category,
+		description: domain.Description,
+		target:      domain.Target,
+		added:       unixTime(domain.Added),
+		modified:    unixTime(domain.Checked),
+	}
+}
+
+func urlEntry(url URL) threatIntelEntry {
+	return threatIntelEntry{
+		kind:        "url",
+		value:       url.URL,
+		category:    url.Category,
+		description: url.Description,
+		target:      url.Target,
+		added:       unixTime(url.Added),
+		modified:    unixTime(url.Checked),
+	}
+}
+
+func stixStringLiteral(value string) string {
+	return "'" + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(value) + "'"
+}
+
+func (e threatIntelEntry) stixIndicator() STIXIndicator {
+	pattern := fmt.Sprintf("[domain-name:value = %s]", stixStringLiteral(e.value))
+	if e.kind == "url" {
+		pattern = fmt.Sprintf("[url:value = %s]", stixStringLiteral(e.value))
+	}
+
+	indicatorType := "malicious-activity"
+	if e.category == CategorySafe {
+		indicatorType = "benign"
+	}
+
+	// Deleted entries that were never seen have no category
+	labels := []string{"fishfish"}
+	category := string(e.category)
+	if category != "" {
+		labels = append(labels, category)
+		category = strings.ToUpper(category[:1]) + category[1:]
+	}
+
+	return STIXIndicator{
+		Type:           "indicator",
+		SpecVersion:    "2.1",
+		ID:             "indicator--" + nameUUID(e.key()),
+		CreatedByRef:   stixIdentityID,
+		Created:        stixTimestamp(e.added),
+		Modified:       stixTimestamp(e.lastModified()),
+		Name:           strings.TrimSpace(fmt.Sprintf("%s %s %s", category, e.kind, e.value)),
+		Description:    e.description,
+		IndicatorTypes: []string{indicatorType},
+		Pattern:        pattern,
+		PatternType:    "stix",
+		ValidFrom:      stixTimestamp(e.added),
+		Labels:         labels,
+		Revoked:        e.deleted,
+		Target:         e.target,
+	}
+}
+
+func (e threatIntelEntry) mispAttribute() MISPAttribute {
+	tags := []MISPTag{{Name: fmt.Sprintf("fishfish:category=\"%s\"", e.category)}}
+	if e.target != "" {
+		tags = append(tags, MISPTag{Name: fmt.Sprintf("fishfish:target=\"%s\"", e.target)})
+	}
+
+	return MISPAttribute{
+		UUID:      nameUUID(e.key()),
+		Type:      e.kind,
+		Category:  "Network activity",
+		Value:     e.value,
+		ToIDS:     e.category != CategorySafe && !e.deleted,
+		Comment:   e.description,
+		Timestamp: strconv.FormatInt(e.lastModified().Unix(), 10),
+		Deleted:   e.deleted,
+		Tag:       tags,
+	}
+}
+
+func selectThreatIntelEntries(domains []Domain, urls []URL, categories []Category) []threatIntelEntry {
+	entries := []threatIntelEntry{}
+
+	for _, domain := range domains {
+		if containsValue(categories, domain.Category) {
+			entries = append(entries, domainEntry(domain))
+		}
+	}
+
+	for _, url := range urls {
+		if containsValue(categories, url.Category) {
+			entries = append(entries, urlEntry(url))
+		}
+	}
+
+	return entries
+}
+
+func newSTIXBundle(entries []threatIntelEntry, generated time.Time) STIXBundle {
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].key() < entries[j].key()
+	})
+
+	keys := make([]string, 0, len(entries))
+	objects := []any{STIXIdentity{
+		Type:          "identity",
+		SpecVersion:   "2.1",
+		ID:            stixIdentityID,
+		Created:       "2022-01-01T00:00:00.000Z",
+		Modified:      "2022-01-01T00:00:00.000Z",
+		Name:          "FishFish",
+		IdentityClass: "organization",
+	}}
+
+	for _, entry := range entries {
+		keys = append(keys, entry.key())
+		objects = append(objects, entry.withFallbackTimes(generated).stixIndicator())
+	}
+
+	return STIXBundle{
+		Type:    "bundle",
+		ID:      "bundle--" + nameUUID(fmt.Sprintf("bundle:%d:%s", generated.UnixNano(), strings.Join(keys, ","))),
+		Objects: objects,
+	}
+}
+
+func newMISPEvent(entries []threatIntelEntry, options ThreatIntelOptions, defaultInfo string) MISPEvent {
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].key() < entries[j].key()
+	})
+
+	info := options.EventInfo
+	if info == "" {
+		info = defaultInfo
+	}
+
+	attributes := make([]MISPAttribute, 0, len(entries))
+	for _, entry := range entries {
+		attributes = append(attributes, entry.withFallbackTimes(options.Generated).mispAttribute())
+	}
+
+	return MISPEvent{Event: MISPEventBody{
+		UUID:          nameUUID(fmt.Sprintf("event:%d:%s", options.Generated.UnixNano(), info)),
+		Info:          info,
+		Date:          options.Generated.UTC().Format("2006-01-02"),
+		Timestamp:     strconv.FormatInt(options.Generated.Unix(), 10),
+		ThreatLevelID: "2",
+		Analysis:      "2",
+		Distribution:  "0",
+		Tag:           []MISPTag{{Name: "tlp:white"}, {Name: "fishfish"}},
+		Attribute:     attributes,
+	}}
+}
+
+// Convert domains and urls to a STIX 2.1 bundle of indicators, with the same indicator ID for the same entry every time
+func ExportSTIX(domains []Domain, urls []URL, options ThreatIntelOptions) STIXBundle {
+	options = options.withDefaults()
+	return newSTIXBundle(selectThreatIntelEntries(domains, urls, options.Categories), options.Generated)
+}
+
+// Convert domains and urls to a MISP event with one attribute per entry
+func ExportMISP(domains []Domain, urls []URL, options ThreatIntelOptions) MISPEvent {
+	options = options.withDefaults()
+	entries := selectThreatIntelEntries(domains, urls, options.Categories)
+
+	return newMISPEvent(entries, options, "FishFish phishing and malware indicators")
+}
+
+// Convert the cached domains and urls to a STIX 2.1 bundle, see ExportSTIX
+func (c *AutoSyncClient) ExportSTIX(options ThreatIntelOptions) STIXBundle {
+	return ExportSTIX(c.GetDomains(), c.GetURLs(), options)
+}
+
+// Convert the cached domains and urls to a MISP event, see ExportMISP
+func (c *AutoSyncClient) ExportMISP(options ThreatIntelOptions) MISPEvent {
+	return ExportMISP(c.GetDomains(), c.GetURLs(), options)
+}
+
+// Collects stream events into incremental STIX bundles and MISP events
+// Deleted entries are exported as revoked indicators and deleted attributes. Events only carry the changed fields,
+// so entries that aren't in the baseline are exported with the time of their first change as their creation time.
+type ThreatIntelChanges struct {
+	mx      sync.Mutex
+	entries map[string]threatIntelEntry
+	// Entries as of the last full export, the starting point of changed entries
+	baseline map[string]threatIntelEntry
+}
+
+func NewThreatIntelChanges() *ThreatIntelChanges {
+	return NewThreatIntelChangesFrom(nil, nil)
+}
+
+// Collect changes to entries that were already exported in full, e.g. with ExportSTIX
+// Changed entries keep the creation time and fields of their baseline entry.
+func NewThreatIntelChangesFrom(domains []Domain, urls []URL) *ThreatIntelChanges {
+	baseline := map[string]threatIntelEntry{}
+
+	for _, domain := range domains {
+		entry := domainEntry(domain)
+		baseline[entry.key()] = entry
+	}
+
+	for _, url := range urls {
+		entry := urlEntry(url)
+		baseline[entry.key()] = entry
+	}
+
+	return &ThreatIntelChanges{entries: map[string]threatIntelEntry{}, baseline: baseline}
+}
+
+// The entry as of its last change, or its baseline entry if it hasn't changed
+// Must be called with the changes locked.
+func (c *ThreatIntelChanges) current(kind, value string) threatIntelEntry {
+	key := kind + ":" + value
+
+	if entry, ok := c.entries[key]; ok {
+		return entry
+	}
+
+	return c.baseline[key]
+}
+
+// Record a stream event received at the specified time, e.g. from a Journal
+func (c *ThreatIntelChanges) Add(event WSEvent, received time.Time) error {
+	c.mx.Lock()
+	defer c.mx.Unlock()
+
+	var entry threatIntelEntry
+
+	switch event.Type {
+	case WSEventTypeDomainCreate:
+		data, err := decodeEventData[WSCreateDomainData](event.Data)
+
+		if err != nil {
+			return err
+		}
+
+		entry = threatIntelEntry{kind: "domain", value: data.Domain, category: data.Category, description: data.Description, target: data.Target}
+		// The indicator ID stays the same, and so does its creation time
+		entry.added = c.current("domain", data.Domain).added
+	case WSEventTypeDomainUpdate:
+		data, err := decodeEventData[WSUpdateDomainData](event.Data)
+
+		if err != nil {
+			return err
+		}
+
+		entry = c.current("domain", data.Domain)
+		entry.kind, entry.value, entry.deleted = "domain", data.Domain, false
+		entry.update(data.Category, data.Description, data.Target)
+	case WSEventTypeDomainDelete:
+		data, err := decodeEventData[WSDeleteDomainData](event.Data)
+
+		if err != nil {
+			return err
+		}
+
+		entry = c.current("domain", data.Domain)
+		entry.kind, entry.value, entry.deleted = "domain", data.Domain, true
+	case WSEventTypeURLCreate:
+		data, err := decodeEventData[WSCreateURLData](event.Data)
+
+		if err != nil {
+			return err
+		}
+
+		entry = threatIntelEntry{kind: "url", value: data.URL, category: data.Category, description: data.Description, target: data.Target}
+		entry.added = c.current("url", data.URL).added
+	case WSEventTypeURLUpdate:
+		data, err := decodeEventData[WSUpdateURLData](event.Data)
+
+		if err != nil {
+			return err
+		}
+
+		entry = c.current("url", data.URL)
+		entry.kind, entry.value, entry.deleted = "url", data.URL, false
+		entry.update(data.Category, data.Description, data.Target)
+	case WSEventTypeURLDelete:
+		data, err := decodeEventData[WSDeleteURLData](event.Data)
+
+		if err != nil {
+			return err
+		}
+
+		entry = c.current("url", data.URL)
+		entry.kind, entry.value, entry.deleted = "url", data.URL, true
+	default:
+		return fmt.Errorf("unknown event type: %s", event.Type)
+	}
+
+	if entry.added.IsZero() {
+		entry.added = received
+	}
+	entry.modified = received
+	c.entries[entry.key()] = entry
+
+	return nil
+}
+
+func (e *threatIntelEntry) update(category Category, description string, target string) {
+	if category != "" {
+		e.category = category
+	}
+	if description != "" {
+		e.description = description
+	}
+	if target != "" {
+		e.target = target
+	}
+}
+
+// The number of changed entries
+func (c *ThreatIntelChanges) Len() int {
+	c.mx.Lock()
+	defer c.mx.Unlock()
+
+	return len(c.entries)
+}
+
+// The changed entries, deleted ones are included regardless of their category since it may not be known
+// Entries whose baseline category was selected but whose current one isn't are included as deleted, so the
+// indicator exported before is revoked.
+func (c *ThreatIntelChanges) selected(categories []Category) []threatIntelEntry {
+	c.mx.Lock()
+	defer c.mx.Unlock()
+
+	entries := []threatIntelEntry{}
+
+	for key, entry := range c.entries {
+		switch {
+		case entry.deleted || containsValue(categories, entry.category):
+			entries = append(entries, entry)
+		case containsValue(categories, c.baseline[key].category):
+			entry.deleted = true
+			entries = append(entries, entry)
+		}
+	}
+
+	return entries
+}
+
+// A STIX 2.1 bundle of the changed entries
+func (c *ThreatIntelChanges) STIXBundle(options ThreatIntelOptions) STIXBundle {
+	options = options.withDefaults()
+	return newSTIXBundle(c.selected(options.Categories), options.Generated)
+}
+
+// A MISP event of the changed entries
+func (c *ThreatIntelChanges) MISPEvent(options ThreatIntelOptions) MISPEvent {
+	options = options.withDefaults()
+	return newMISPEvent(c.selected(options.Categories), options, "FishFish indicator changes")
+}
+
+// Forget every change, e.g. after exporting them
+// The changed entries become the baseline of later changes.
+func (c *ThreatIntelChanges) Reset() {
+	c.mx.Lock()
+	defer c.mx.Unlock()
+
+	for key, entry := range c.entries {
+		c.baseline[key] = entry
+	}
+
+	c.entries = map[string]threatIntelEntry{}
+}
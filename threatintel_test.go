@@ -0,0 +1,164 @@
+package fishfish_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/existagon/fishfish-go"
+)
+
+func TestExportSTIX(t *testing.T) {
+	domains := []fishfish.Domain{
+		{Domain: "steamcommunity-gift.ru", Category: fishfish.CategoryPhishing, Description: "fake trade", Target: "steamcommunity.com", Added: 1700000000, Checked: 1700000100},
+		{Domain: "discord.com", Category: fishfish.CategorySafe},
+	}
+	urls := []fishfish.URL{{URL: "https://sites.example/it's", Category: fishfish.CategoryMalware, Added: 1700000000}}
+	options := fishfish.ThreatIntelOptions{Generated: time.Unix(1700001000, 0)}
+
+	bundle := fishfish.ExportSTIX(domains, urls, options)
+	again := fishfish.ExportSTIX(domains, urls, options)
+
+	first, err := json.Marshal(bundle)
+	mustPanic(err)
+	second, err := json.Marshal(again)
+	mustPanic(err)
+
+	if string(first) != string(second) {
+		panic(fmt.Errorf("expected the same bundle for the same data"))
+	}
+
+	// The identity, then indicators sorted by kind and value
+	if len(bundle.Objects) != 3 {
+		panic(fmt.Errorf("expected 3 objects, got %d", len(bundle.Objects)))
+	}
+
+	domain := bundle.Objects[1].(fishfish.STIXIndicator)
+	url := bundle.Objects[2].(fishfish.STIXIndicator)
+
+	if domain.Pattern != "[domain-name:value = 'steamcommunity-gift.ru']" || domain.ValidFrom != "2023-11-14T22:13:20.000Z" ||
+		domain.Modified != "2023-11-14T22:15:00.000Z" || domain.Target != "steamcommunity.com" || domain.Description != "fake trade" ||
+		domain.Labels[1] != "phishing" || domain.Name != "Phishing domain steamcommunity-gift.ru" {
+		panic(fmt.Errorf("unexpected domain indicator %+v", domain))
+	}
+
+	if url.Pattern != `[url:value = 'https://sites.example/it\'s']` || url.IndicatorTypes[0] != "malicious-activity" || !strings.HasPrefix(url.ID, "indicator--") {
+		panic(fmt.Errorf("unexpected url indicator %+v", url))
+	}
+}
+
+func TestExportMISP(t *testing.T) {
+	domains := []fishfish.Domain{{Domain: "steamcommunity-gift.ru", Category: fishfish.CategoryPhishing, Target: "steamcommunity.com", Added: 1700000000}}
+	event := fishfish.ExportMISP(domains, nil, fishfish.ThreatIntelOptions{Generated: time.Unix(1700001000, 0), EventInfo: "daily"})
+
+	if event.Event.Info != "daily" || event.Event.Date != "2023-11-14" || len(event.Event.Attribute) != 1 {
+		panic(fmt.Errorf("unexpected event %+v", event.Event))
+	}
+
+	attribute := event.Event.Attribute[0]
+	if attribute.Type != "domain" || !attribute.ToIDS || attribute.Value != "steamcommunity-gift.ru" || len(attribute.Tag) != 2 {
+		panic(fmt.Errorf("unexpected attribute %+v", attribute))
+	}
+}
+
+func TestThreatIntelChanges(t *testing.T) {
+	changes := fishfish.NewThreatIntelChanges()
+	created := time.Unix(1700000000, 0)
+	deleted := time.Unix(1700000500, 0)
+
+	mustPanic(changes.Add(fishfish.WSEvent{Type: fishfish.WSEventTypeDomainCreate, Data: fishfish.WSCreateDomainData{
+		Domain: "steamcommunity-gift.ru", Category: fishfish.CategoryPhishing,
+	}}, created))
+	mustPanic(changes.Add(fishfish.WSEvent{Type: fishfish.WSEventTypeURLCreate, Data: fishfish.WSCreateURLData{
+		URL: "https://sites.example/scam", Category: fishfish.CategoryMalware,
+	}}, created))
+	mustPanic(changes.Add(fishfish.WSEvent{Type: fishfish.WSEventTypeURLDelete, Data: fishfish.WSDeleteURLData{
+		URL: "https://sites.example/scam",
+	}}, deleted))
+	mustPanic(changes.Add(fishfish.WSEvent{Type: fishfish.WSEventTypeDomainDelete, Data: fishfish.WSDeleteDomainData{
+		Domain: "never-seen.example",
+	}}, deleted))
+
+	if changes.Len() != 3 {
+		panic(fmt.Errorf("expected 3 changed entries, got %d", changes.Len()))
+	}
+
+	bundle := changes.STIXBundle(fishfish.ThreatIntelOptions{})
+	revoked := 0
+
+	for _, object := range bundle.Objects[1:] {
+		indicator := object.(fishfish.STIXIndicator)
+
+		if indicator.Revoked {
+			revoked++
+		}
+
+		if strings.Contains(indicator.Pattern, "sites.example") && (!indicator.Revoked || indicator.Created != "2023-11-14T22:13:20.000Z" || indicator.Modified != "2023-11-14T22:21:40.000Z") {
+			panic(fmt.Errorf("expected the deleted url to be revoked, got %+v", indicator))
+		}
+	}
+
+	if revoked != 2 {
+		panic(fmt.Errorf("expected 2 revoked indicators, got %d", revoked))
+	}
+
+	event := changes.MISPEvent(fishfish.ThreatIntelOptions{})
+	if len(event.Event.Attribute) != 3 || !event.Event.Attribute[0].Deleted || event.Event.Attribute[1].Deleted {
+		panic(fmt.Errorf("unexpected attributes %+v", event.Event.Attribute))
+	}
+
+	changes.Reset()
+	if changes.Len() != 0 {
+		panic(fmt.Errorf("expected no changes after reset"))
+	}
+}
+
+func TestThreatIntelChangesFromBaseline(t *testing.T) {
+	changes := fishfish.NewThreatIntelChangesFrom([]fishfish.Domain{
+		{Domain: "steamcommunity-gift.ru", Category: fishfish.CategoryPhishing, Added: 1600000000, Checked: 1600000000},
+	}, nil)
+
+	mustPanic(changes.Add(fishfish.WSEvent{Type: fishfish.WSEventTypeDomainUpdate, Data: fishfish.WSUpdateDomainData{
+		Domain: "steamcommunity-gift.ru", Description: "Fake Steam login",
+	}}, time.Unix(1700000000, 0)))
+
+	// The indicator keeps the creation time and category of the full export
+	indicator := changes.STIXBundle(fishfish.ThreatIntelOptions{}).Objects[1].(fishfish.STIXIndicator)
+
+	if indicator.Created != "2020-09-13T12:26:40.000Z" || indicator.ValidFrom != indicator.Created || indicator.Modified != "2023-11-14T22:13:20.000Z" || indicator.Name != "Phishing domain steamcommunity-gift.ru" {
+		panic(fmt.Errorf("unexpected updated indicator %+v", indicator))
+	}
+
+	// An indicator that is no longer phishing is revoked
+	mustPanic(changes.Add(fishfish.WSEvent{Type: fishfish.WSEventTypeDomainUpdate, Data: fishfish.WSUpdateDomainData{
+		Domain: "steamcommunity-gift.ru", Category: fishfish.CategorySafe,
+	}}, time.Unix(1700000100, 0)))
+
+	if indicator := changes.STIXBundle(fishfish.ThreatIntelOptions{}).Objects[1].(fishfish.STIXIndicator); !indicator.Revoked {
+		panic(fmt.Errorf("expected the indicator to be revoked, got %+v", indicator))
+	}
+
+	if attributes := changes.MISPEvent(fishfish.ThreatIntelOptions{}).Event.Attribute; len(attributes) != 1 || !attributes[0].Deleted || attributes[0].ToIDS {
+		panic(fmt.Errorf("expected the attribute to be deleted, got %+v", attributes))
+	}
+
+	// Once exported, the entry is safe in the baseline and not revoked again
+	changes.Reset()
+	mustPanic(changes.Add(fishfish.WSEvent{Type: fishfish.WSEventTypeDomainUpdate, Data: fishfish.WSUpdateDomainData{
+		Domain: "steamcommunity-gift.ru", Description: "Official",
+	}}, time.Unix(1700000200, 0)))
+
+	if objects := changes.STIXBundle(fishfish.ThreatIntelOptions{}).Objects; len(objects) != 1 {
+		panic(fmt.Errorf("expected no indicators for a safe entry, got %+v", objects))
+	}
+
+	// Entries without an added time aren't valid from 1970
+	generated := time.Unix(1700000000, 0)
+	bundle := fishfish.ExportSTIX([]fishfish.Domain{{Domain: "phish.example", Category: fishfish.CategoryPhishing}}, nil, fishfish.ThreatIntelOptions{Generated: generated})
+
+	if indicator := bundle.Objects[1].(fishfish.STIXIndicator); indicator.ValidFrom != "2023-11-14T22:13:20.000Z" {
+		panic(fmt.Errorf("expected the export time as valid_from, got %+v", indicator))
+	}
+}
@@ -0,0 +1,328 @@
+package fishfish
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	// The domain is a misspelling of a protected domain, e.g. dicsord.com
+	SuspicionKindTyposquat = "typosquat"
+	// The domain combines a protected name with other words, e.g. discord-nitro.com
+	SuspicionKindCombosquat = "combosquat"
+	// The domain uses the name of a protected domain under another suffix, e.g. discord.xyz
+	SuspicionKindTLDSwap = "tld_swap"
+)
+
+// Protected labels shorter than this are only matched exactly, too many real domains are a typo away from them
+const minTyposquatLabelLength = 5
+
+// Keys next to each other on a QWERTY keyboard, typos often hit a neighbouring key
+var keyboardRows = []string{"1234567890", "qwertyuiop", "asdfghjkl", "zxcvbnm"}
+
+type keyPosition struct {
+	row, column int
+}
+
+var keyboardPositions = func() map[rune]keyPosition {
+	positions := map[rune]keyPosition{}
+
+	for row, keys := range keyboardRows {
+		for column, key := range keys {
+			positions[key] = keyPosition{row, column}
+		}
+	}
+
+	return positions
+}()
+
+func keyboardAdjacent(a, b rune) bool {
+	pa, okA := keyboardPositions[a]
+	pb, okB := keyboardPositions[b]
+
+	if !okA || !okB || a == b {
+		return false
+	}
+
+	rows, columns := pa.row-pb.row, pa.column-pb.column
+
+	// Rows are staggered, so a key touches the keys below it and one to their left
+	return (rows == 0 && (columns == 1 || columns == -1)) ||
+		(rows == 1 && (columns == 0 || columns == 1)) ||
+		(rows == -1 && (columns == 0 || columns == -1))
+}
+
+// The number of insertions, deletions, substitutions and transpositions of adjacent characters to turn a into b
+// This is the optimal string alignment variant of the Damerau-Levenshtein distance, which isn't a metric.
+func damerauLevenshtein(a, b string) int {
+	return editDistance(a, b, true)
+}
+
+// The number of insertions, deletions and substitutions to turn a into b
+func levenshtein(a, b string) int {
+	return editDistance(a, b, false)
+}
+
+func editDistance(a, b string, transpositions bool) int {
+	ra, rb := []rune(a), []rune(b)
+	rows := make([][]int, len(ra)+1)
+
+	for i := range rows {
+		rows[i] = make([]int, len(rb)+1)
+		rows[i][0] = i
+	}
+	for j := range rows[0] {
+		rows[0][j] = j
+	}
+
+	for i := 1; i <= len(ra); i++ {
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+
+			distance := rows[i-1][j] + 1
+			if d := rows[i][j-1] + 1; d < distance {
+				distance = d
+			}
+			if d := rows[i-1][j-1] + cost; d < distance {
+				distance = d
+			}
+			if transpositions && i > 1 && j > 1 && ra[i-1] == rb[j-2] && ra[i-2] == rb[j-1] {
+				if d := rows[i-2][j-2] + 1; d < distance {
+					distance = d
+				}
+			}
+
+			rows[i][j] = distance
+		}
+	}
+
+	return rows[len(ra)][len(rb)]
+}
+
+// Whether a single edit turning a into b is a substitution with a neighbouring key or a swap of two characters
+func isKeyboardTypo(a, b string) bool {
+	ra, rb := []rune(a), []rune(b)
+
+	if len(ra) != len(rb) {
+		return false
+	}
+
+	diff := []int{}
+	for i := range ra {
+		if ra[i] != rb[i] {
+			diff = append(diff, i)
+		}
+	}
+
+	switch len(diff) {
+	case 1:
+		return keyboardAdjacent(ra[diff[0]], rb[diff[0]])
+	case 2:
+		i, j := diff[0], diff[1]
+		return j == i+1 && ra[i] == rb[j] && ra[j] == rb[i]
+	}
+
+	return false
+}
+
+// A BK-tree of labels, finding every label within an edit distance without comparing against all of them
+// The tree is built on the Levenshtein distance, since pruning relies on the triangle inequality.
+type bkTree struct {
+	root *bkNode
+}
+
+type bkNode struct {
+	label    string
+	children map[int]*bkNode
+}
+
+func (t *bkTree) insert(label string) {
+	if t.root == nil {
+		t.root = &bkNode{label: label, children: map[int]*bkNode{}}
+		return
+	}
+
+	node := t.root
+
+	for {
+		distance := levenshtein(label, node.label)
+
+		if distance == 0 {
+			return
+		}
+
+		child, ok := node.children[distance]
+
+		if !ok {
+			node.children[distance] = &bkNode{label: label, children: map[int]*bkNode{}}
+			return
+		}
+
+		node = child
+	}
+}
+
+// Call fn with every label within maxDistance of the query, by damerauLevenshtein
+func (t *bkTree) search(query string, maxDistance int, fn func(label string, distance int)) {
+	if t.root == nil {
+		return
+	}
+
+	// Each transposition costs two Levenshtein edits, so search twice as far and re-score the candidates
+	radius := maxDistance * 2
+	pending := []*bkNode{t.root}
+
+	for len(pending) > 0 {
+		node := pending[len(pending)-1]
+		pending = pending[:len(pending)-1]
+
+		distance := levenshtein(query, node.label)
+
+		if distance <= radius {
+			if typoDistance := damerauLevenshtein(query, node.label); typoDistance <= maxDistance {
+				fn(node.label, typoDistance)
+			}
+		}
+
+		// By the triangle inequality, matches can only be below children within radius of this distance
+		for childDistance, child := range node.children {
+			if childDistance >= distance-radius && childDistance <= distance+radius {
+				pending = append(pending, child)
+			}
+		}
+	}
+}
+
+// How many edits are allowed for a label to still count as a typo
+func maxTypoDistance(label string) int {
+	switch length := len([]rune(label)); {
+	case length < minTyposquatLabelLength:
+		return 0
+	case length <= 8:
+		return 1
+	}
+
+	return 2
+}
+
+// Detects domains that misspell protected domains and brand names, combine them with other words or use them
+// under another suffix
+type TyposquatDetector struct {
+	// Protected registrable domains, which are never reported
+	registrable map[string]bool
+	// Protected names by their label
+	labels map[string][]protectedName
+	tree   bkTree
+}
+
+// Create a detector for the specified domains and brand names, e.g. discord.com or Discord
+func NewTyposquatDetector(protected []string) *TyposquatDetector {
+	detector := TyposquatDetector{registrable: map[string]bool{}, labels: map[string][]protectedName{}}
+
+	for _, name := range protected {
+		name = strings.TrimSpace(name)
+		entry := protectedName{name: name}
+
+		if strings.Contains(name, ".") {
+			registrable, label, suffix, err := splitRegistrable(name)
+
+			if err != nil {
+				continue
+			}
+
+			entry.registrable, entry.label, entry.suffix = registrable, label, suffix
+			detector.registrable[registrable] = true
+		} else if name != "" {
+			entry.label = strings.ToLower(name)
+		} else {
+			continue
+		}
+
+		detector.labels[entry.label] = append(detector.labels[entry.label], entry)
+		detector.tree.insert(entry.label)
+	}
+
+	return &detector
+}
+
+// Check whether a domain squats a protected name, returning the most likely imitation
+// Protected domains themselves are never reported.
+func (d *TyposquatDetector) Detect(domain string) (*Suspicion, bool) {
+	registrable, label, suffix, err := splitRegistrable(domain)
+
+	if err != nil || d.registrable[registrable] {
+		return nil, false
+	}
+
+	var best *Suspicion
+
+	consider := func(kind SuspicionKind, protected protectedName, score float64, reason string) {
+		if protected.suffix == "" || protected.suffix == suffix {
+			score += 0.05
+		}
+
+		if best == nil || score > best.Score {
+			best = &Suspicion{Kind: kind, Of: protected.name, Score: score, Reason: reason}
+		}
+	}
+
+	// The same name under another suffix
+	if len(label) >= 4 {
+		for _, protected := range d.labels[label] {
+			consider(SuspicionKindTLDSwap, protected, 0.85, fmt.Sprintf("%s uses the name of %s", registrable, protected.name))
+		}
+	}
+
+	// The whole label, or one of its words, is a misspelling
+	words := strings.Split(label, "-")
+	if len(words) > 1 {
+		words = append([]string{label}, words...)
+	}
+
+	for i, word := range words {
+		d.tree.search(word, maxTypoDistance(word), func(match string, distance int) {
+			if distance == 0 {
+				return
+			}
+
+			score := 0.9 - 0.15*float64(distance-1)
+			if distance == 1 && isKeyboardTypo(word, match) {
+				score += 0.05
+			}
+
+			kind := SuspicionKind(SuspicionKindTyposquat)
+			if i > 0 {
+				kind = SuspicionKindCombosquat
+				score -= 0.1
+			}
+
+			for _, protected := range d.labels[match] {
+				consider(kind, protected, score, fmt.Sprintf("%s is %d edit(s) from %s", word, distance, protected.name))
+			}
+		})
+	}
+
+	// A protected name with other words around it, e.g. discordnitro or free-discord-gift
+	runes := []rune(label)
+	for start := 0; start < len(runes); start++ {
+		for end := start + minTyposquatLabelLength; end <= len(runes); end++ {
+			if start == 0 && end == len(runes) {
+				continue
+			}
+
+			word := string(runes[start:end])
+			for _, protected := range d.labels[word] {
+				consider(SuspicionKindCombosquat, protected, 0.8, fmt.Sprintf("%s contains %s", registrable, protected.name))
+			}
+		}
+	}
+
+	if best != nil && best.Score > 1 {
+		best.Score = 1
+	}
+
+	return best, best != nil
+}
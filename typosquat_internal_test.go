@@ -0,0 +1,60 @@
+package fishfish
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+	"testing"
+)
+
+func TestTyposquatTreeMatchesLinearScan(t *testing.T) {
+	random := rand.New(rand.NewSource(1))
+	randomLabel := func() string {
+		runes := make([]rune, 2+random.Intn(5))
+		for i := range runes {
+			runes[i] = rune('a' + random.Intn(4))
+		}
+		return string(runes)
+	}
+
+	labels := []string{"bc", "cb", "abc", "acb", "bac"}
+	for i := 0; i < 300; i++ {
+		labels = append(labels, randomLabel())
+	}
+
+	tree := bkTree{}
+	for _, label := range labels {
+		tree.insert(label)
+	}
+
+	for i := 0; i < 300; i++ {
+		query := randomLabel()
+
+		for maxDistance := 0; maxDistance <= 2; maxDistance++ {
+			expected := map[string]int{}
+			for _, label := range labels {
+				if distance := damerauLevenshtein(query, label); distance <= maxDistance {
+					expected[label] = distance
+				}
+			}
+
+			found := map[string]int{}
+			tree.search(query, maxDistance, func(label string, distance int) {
+				found[label] = distance
+			})
+
+			if fmt.Sprint(sortedMatches(found)) != fmt.Sprint(sortedMatches(expected)) {
+				panic(fmt.Errorf("%s within %d: expected %v, got %v", query, maxDistance, sortedMatches(expected), sortedMatches(found)))
+			}
+		}
+	}
+}
+
+func sortedMatches(matches map[string]int) []string {
+	values := []string{}
+	for label, distance := range matches {
+		values = append(values, fmt.Sprintf("%s:%d", label, distance))
+	}
+	sort.Strings(values)
+	return values
+}
@@ -0,0 +1,66 @@
+package fishfish_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/existagon/fishfish-go"
+)
+
+func TestTyposquatDetector(t *testing.T) {
+	detector := fishfish.NewTyposquatDetector([]string{"discord.com", "steamcommunity.com", "Roblox", "x.com"})
+
+	tests := map[string]struct {
+		of   string
+		kind fishfish.SuspicionKind
+	}{
+		"dicsord.com":            {"discord.com", fishfish.SuspicionKindTyposquat},
+		"discorf.com":            {"discord.com", fishfish.SuspicionKindTyposquat},
+		"steamcomunity.ru":       {"steamcommunity.com", fishfish.SuspicionKindTyposquat},
+		"steamcomnunity.com":     {"steamcommunity.com", fishfish.SuspicionKindTyposquat},
+		"dicsord-nitro.com":      {"discord.com", fishfish.SuspicionKindCombosquat},
+		"free-discordnitro.gift": {"discord.com", fishfish.SuspicionKindCombosquat},
+		"login.discord.xyz":      {"discord.com", fishfish.SuspicionKindTLDSwap},
+		"roblox-free-robux.net":  {"Roblox", fishfish.SuspicionKindCombosquat},
+		"steamcommunity.co.uk":   {"steamcommunity.com", fishfish.SuspicionKindTLDSwap},
+	}
+
+	for domain, test := range tests {
+		suspicion, ok := detector.Detect(domain)
+
+		if !ok || suspicion.Of != test.of || suspicion.Kind != test.kind || suspicion.Score > 1 {
+			panic(fmt.Errorf("%s: expected %s of %s, got %+v", domain, test.kind, test.of, suspicion))
+		}
+	}
+
+	for _, domain := range []string{"discord.com", "cdn.discord.com", "example.com", "y.com", "x.org", "record.com"} {
+		if suspicion, ok := detector.Detect(domain); ok {
+			panic(fmt.Errorf("%s: unexpected suspicion %+v", domain, suspicion))
+		}
+	}
+
+	adjacent, _ := detector.Detect("discorf.com")
+	distant, _ := detector.Detect("discorp.com")
+	if adjacent.Score <= distant.Score {
+		panic(fmt.Errorf("expected keyboard typo to score higher, got %f and %f", adjacent.Score, distant.Score))
+	}
+}
+
+func TestAutoSyncCheckTyposquat(t *testing.T) {
+	client := newTestAutoSync([]fishfish.Domain{
+		{Domain: "discord.com", Category: fishfish.CategorySafe},
+	}, nil)
+
+	verdict := client.Check(context.Background(), "https://dicsord-nitro.com/gift")
+	if !verdict.Suspicious() || verdict.Suspicion.Kind != fishfish.SuspicionKindCombosquat {
+		panic(fmt.Errorf("expected a suspicious verdict, got %+v", verdict))
+	}
+
+	client, err := fishfish.NewAutoSyncWithOptions("", []fishfish.APIPermission{}, fishfish.AutoSyncOptions{DisableHeuristics: true})
+	mustPanic(err)
+
+	if verdict := client.Check(context.Background(), "dicsord.com"); verdict.Suspicious() {
+		panic(fmt.Errorf("expected heuristics to be disabled, got %+v", verdict))
+	}
+}
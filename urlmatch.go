@@ -0,0 +1,442 @@
+package fishfish
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// A host suffix or path prefix of a URL matched a listed URL
+const MatchTypePrefix = "prefix"
+
+// The listed URL or domain that applies to a URL
+type URLMatch struct {
+	// The canonical form of the URL that was looked up
+	Canonical string `json:"canonical"`
+	// The listed URL, nil if only the host matched a listed domain
+	URL *URL `json:"url,omitempty"`
+	// The host and path expression that matched the listed URL
+	Expression string    `json:"expression,omitempty"`
+	MatchType  MatchType `json:"match_type"`
+	// The listed domain covering the host, if no URL matched
+	Domain *DomainMatch `json:"domain,omitempty"`
+}
+
+// Query parameters that only track where a link was shared and never change its destination
+var trackingParams = map[string]bool{
+	"fbclid":  true,
+	"gclid":   true,
+	"dclid":   true,
+	"msclkid": true,
+	"mc_cid":  true,
+	"mc_eid":  true,
+	"igshid":  true,
+	"yclid":   true,
+	"_ga":     true,
+	"ref_src": true,
+}
+
+var defaultPorts = map[string]string{
+	"http":  "80",
+	"https": "443",
+	"ws":    "80",
+	"wss":   "443",
+	"ftp":   "21",
+}
+
+// Canonicalize a URL in the style of Google Safe Browsing
+// Defanged URLs are refanged, URLs without a scheme are treated as http, fragments, credentials, default ports and tracking parameters are removed,
+// the host is lowercased and the path is resolved, escaped consistently and has no trailing slash.
+func CanonicalizeURL(raw string) (string, error) {
+	parsed, err := parseCanonicalURL(raw)
+
+	if err != nil {
+		return "", err
+	}
+
+	return parsed.String(), nil
+}
+
+type canonicalURL struct {
+	scheme string
+	host   string
+	port   string
+	path   string
+	query  string
+}
+
+func (u canonicalURL) hostPort() string {
+	if u.port == "" && strings.Contains(u.host, ":") {
+		// IPv6
+		return "[" + u.host + "]"
+	} else if u.port == "" {
+		return u.host
+	}
+
+	return net.JoinHostPort(u.host, u.port)
+}
+
+func (u canonicalURL) pathQuery() string {
+	if u.query == "" {
+		return u.path
+	}
+
+	return u.path + "?" + u.query
+}
+
+func (u canonicalURL) String() string {
+	return u.scheme + "://" + u.hostPort() + u.pathQuery()
+}
+
+func parseCanonicalURL(raw string) (*canonicalURL, error) {
+	raw = Refang(strings.TrimSpace(raw))
+	raw = strings.NewReplacer("\t", "", "\r", "", "\n", "").Replace(raw)
+
+	if raw == "" {
+		return nil, errors.New("empty url")
+	}
+
+	if !strings.Contains(raw, "://") {
+		raw = "http://" + raw
+	}
+
+	// Fragments are never sent to the server
+	raw, _, _ = strings.Cut(raw, "#")
+
+	scheme, rest, _ := strings.Cut(raw, "://")
+	authority, pathQuery := rest, "/"
+
+	if i := strings.IndexAny(rest, "/?"); i >= 0 {
+		authority, pathQuery = rest[:i], rest[i:]
+	}
+
+	// Credentials don't change which site is visited
+	if i := strings.LastIndex(authority, "@"); i >= 0 {
+		authority = authority[i+1:]
+	}
+
+	scheme = strings.ToLower(scheme)
+	host, port := authority, ""
+
+	if h, p, err := net.SplitHostPort(authority); err == nil {
+		host, port = h, p
+	}
+
+	if port == defaultPorts[scheme] {
+		port = ""
+	}
+
+	host, err := canonicalHost(fullyUnescape(host))
+
+	if err != nil {
+		return nil, err
+	}
+
+	path, query, _ := strings.Cut(pathQuery, "?")
+
+	if !strings.HasPrefix(path, "/") {
+		path = "/" + path
+	}
+
+	return &canonicalURL{
+		scheme: scheme,
+		host:   host,
+		port:   port,
+		path:   canonicalPath(path),
+		query:  canonicalQuery(query),
+	}, nil
+}
+
+// Unescape until nothing changes, so multiply-encoded input can't hide from lookups
+func fullyUnescape(s string) string {
+	for i := 0; i < 16; i++ {
+		unescaped, err := url.PathUnescape(s)
+
+		if err != nil || unescaped == s {
+			return s
+		}
+
+		s = unescaped
+	}
+
+	return s
+}
+
+// Escape control characters, spaces, non-ASCII bytes, # and %
+func escapeCanonical(s string) string {
+	var b strings.Builder
+
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+
+		if c <= 0x20 || c >= 0x7f || c == '#' || c == '%' {
+			fmt.Fprintf(&b, "%%%02X", c)
+		} else {
+			b.WriteByte(c)
+		}
+	}
+
+	return b.String()
+}
+
+func canonicalHost(host string) (string, error) {
+	host = normalizeHost(host)
+	host = strings.Trim(host, ".")
+
+	for strings.Contains(host, "..") {
+		host = strings.ReplaceAll(host, "..", ".")
+	}
+
+	if host == "" {
+		return "", errors.New("url has no host")
+	}
+
+	if ip := parseLooseIPv4(host); ip != nil {
+		return ip.String(), nil
+	}
+
+	return escapeCanonical(host), nil
+}
+
+// Parse IPv4 addresses written as a single number or with octal or hex parts, e.g. 0x7f.1 or 2130706433
+func parseLooseIPv4(host string) net.IP {
+	if ip := net.ParseIP(host); ip != nil {
+		return ip
+	}
+
+	parts := strings.Split(host, ".")
+
+	if len(parts) > 4 {
+		return nil
+	}
+
+	values := make([]uint64, len(parts))
+	for i, part := range parts {
+		value, err := strconv.ParseUint(part, 0, 32)
+
+		if err != nil {
+			return nil
+		}
+
+		values[i] = value
+	}
+
+	// The last part fills all remaining bytes
+	var ip uint64
+	for i, value := range values[:len(values)-1] {
+		if value > 255 {
+			return nil
+		}
+
+		ip |= value << (8 * (3 - i))
+	}
+
+	last := values[len(values)-1]
+	if last >= 1<<(8*(5-len(values))) {
+		return nil
+	}
+
+	ip |= last
+
+	return net.IPv4(byte(ip>>24), byte(ip>>16), byte(ip>>8), byte(ip))
+}
+
+// Resolve /./ and /../, and remove repeated and trailing slashes
+func canonicalPath(path string) string {
+	path = fullyUnescape(path)
+	segments := strings.Split(path, "/")
+	resolved := []string{}
+
+	for _, segment := range segments[1:] {
+		switch segment {
+		case "", ".":
+			continue
+		case "..":
+			if len(resolved) > 0 {
+				resolved = resolved[:len(resolved)-1]
+			}
+		default:
+			resolved = append(resolved, segment)
+		}
+	}
+
+	return escapeCanonical("/" + strings.Join(resolved, "/"))
+}
+
+// Remove tracking parameters, keeping the order of everything else
+func canonicalQuery(query string) string {
+	if query == "" {
+		return ""
+	}
+
+	kept := []string{}
+	for _, param := range strings.Split(query, "&") {
+		name, _, _ := strings.Cut(param, "=")
+		name = strings.ToLower(fullyUnescape(name))
+
+		if trackingParams[name] || strings.HasPrefix(name, "utm_") {
+			continue
+		}
+
+		kept = append(kept, param)
+	}
+
+	return escapeCanonical(fullyUnescape(strings.Join(kept, "&")))
+}
+
+// Host suffixes of a canonical URL to look up, most specific first
+// Besides the host itself, at most four suffixes are built from the last five labels, stopping before the public suffix.
+func (u canonicalURL) hostExpressions() []string {
+	hosts := []string{u.hostPort()}
+
+	if net.ParseIP(u.host) != nil {
+		return hosts
+	}
+
+	labels := strings.Split(u.host, ".")
+	suffixLen, _ := DefaultPublicSuffixList().suffixLabels(labels)
+
+	start := len(labels) - 5
+	if start < 1 {
+		start = 1
+	}
+
+	for i := start; i < len(labels)-suffixLen; i++ {
+		hosts = append(hosts, strings.Join(labels[i:], "."))
+	}
+
+	return hosts
+}
+
+// Path prefixes of a canonical URL to look up, most specific first
+// The full path with and without the query, then up to four prefixes of whole path segments down to the root.
+func (u canonicalURL) pathExpressions() []string {
+	paths := []string{u.pathQuery()}
+
+	if u.query != "" {
+		paths = append(paths, u.path)
+	}
+
+	segments := strings.Split(strings.TrimPrefix(u.path, "/"), "/")
+	prefixes := []string{"/"}
+
+	for i := 1; i < len(segments) && len(prefixes) < 4; i++ {
+		prefixes = append(prefixes, "/"+strings.Join(segments[:i], "/"))
+	}
+
+	for i := len(prefixes) - 1; i >= 0; i-- {
+		if prefixes[i] != u.path {
+			paths = append(paths, prefixes[i])
+		}
+	}
+
+	return paths
+}
+
+// The key a listed URL is indexed by, its canonical host and path
+func urlIndexKey(raw string) (string, bool) {
+	parsed, err := parseCanonicalURL(raw)
+
+	if err != nil {
+		return "", false
+	}
+
+	return parsed.hostPort() + parsed.pathQuery(), true
+}
+
+func newURLExpressionIndex(urls map[string]URL) map[string]map[string]bool {
+	index := make(map[string]map[string]bool, len(urls))
+
+	for name := range urls {
+		addURLExpression(index, name)
+	}
+
+	return index
+}
+
+func addURLExpression(index map[string]map[string]bool, name string) {
+	key, ok := urlIndexKey(name)
+
+	if !ok {
+		return
+	}
+
+	if index[key] == nil {
+		index[key] = map[string]bool{}
+	}
+
+	index[key][name] = true
+}
+
+// The first of the names sharing a canonical form, so matches don't depend on map order
+func firstURLName(names map[string]bool) string {
+	first := ""
+
+	for name := range names {
+		if first == "" || name < first {
+			first = name
+		}
+	}
+
+	return first
+}
+
+// Find the listed URL that applies to a URL, falling back to the listed domain covering its host
+// The URL is canonicalized and every combination of its host suffixes and path prefixes is looked up.
+func (c *AutoSyncClient) MatchURL(raw string) (*URLMatch, error) {
+	parsed, err := parseCanonicalURL(raw)
+
+	if err != nil {
+		return nil, fmt.Errorf("invalid url %s: %s", raw, err)
+	}
+
+	if match, ok := c.cache.matchURL(parsed); ok {
+		return match, nil
+	}
+
+	return nil, fmt.Errorf("no listed url or domain matches %s", parsed.String())
+}
+
+// Find the listed URL that applies to a canonical URL, falling back to the listed domain covering its host
+func (c *domainCache) matchURL(parsed *canonicalURL) (*URLMatch, bool) {
+	match := URLMatch{Canonical: parsed.String()}
+	exact := parsed.hostPort() + parsed.pathQuery()
+
+	c.mx.RLock()
+	for _, host := range parsed.hostExpressions() {
+		for _, path := range parsed.pathExpressions() {
+			names, ok := c.urlExpressionIndex[host+path]
+
+			if !ok {
+				continue
+			}
+
+			url := c.urlIndex[firstURLName(names)]
+			match.URL = &url
+			match.Expression = host + path
+			match.MatchType = MatchTypePrefix
+
+			if match.Expression == exact {
+				match.MatchType = MatchTypeExact
+			}
+
+			c.mx.RUnlock()
+			return &match, true
+		}
+	}
+	c.mx.RUnlock()
+
+	domain, ok := c.matchDomain(parsed.host)
+
+	if !ok {
+		return nil, false
+	}
+
+	match.Domain = domain
+	match.MatchType = domain.MatchType
+
+	return &match, true
+}
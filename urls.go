@@ -2,6 +2,7 @@ package fishfish
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -18,8 +19,12 @@ type URL struct {
 }
 
 func (c *RawClient) GetURL(url string) (*URL, error) {
-	path := fmt.Sprintf("/urls/%s", url)
-	res, err := c.makeRequest("GET", path, nil, nil, c.defaultAuthType)
+	return c.getURL(context.Background(), url)
+}
+
+func (c *RawClient) getURL(ctx context.Context, url string) (*URL, error) {
+	path := fmt.Sprintf("/urls/%s", escapePathSegment(url))
+	res, err := c.makeRequestContext(ctx, "GET", path, nil, nil, c.defaultAuthType)
 
 	if err != nil {
 		return nil, err
@@ -29,10 +34,14 @@ func (c *RawClient) GetURL(url string) (*URL, error) {
 }
 
 func (c *RawClient) GetURLs(category Category) (*[]string, error) {
+	return c.getURLs(context.Background(), category)
+}
+
+func (c *RawClient) getURLs(ctx context.Context, category Category) (*[]string, error) {
 	query := makeQuery(map[string]string{
 		"category": string(category),
 	})
-	res, err := c.makeRequest("GET", "/urls", query, nil, c.defaultAuthType)
+	res, err := c.makeRequestContext(ctx, "GET", "/urls", query, nil, c.defaultAuthType)
 
 	if err != nil {
 		return nil, err
@@ -42,13 +51,17 @@ func (c *RawClient) GetURLs(category Category) (*[]string, error) {
 }
 
 func (c *RawClient) GetURLsFull() (*[]URL, error) {
+	return c.getURLsFull(context.Background())
+}
+
+func (c *RawClient) getURLsFull(ctx context.Context) (*[]URL, error) {
 	// Requires auth
 	if c.defaultAuthType == authTypeNone {
 		return nil, errors.New("GetURLsFull requires authentication")
 	}
 
 	query := makeQuery(map[string]string{"full": strconv.FormatBool(true)})
-	res, err := c.makeRequest("GET", "/urls", query, nil, authTypeSession)
+	res, err := c.makeRequestContext(ctx, "GET", "/urls", query, nil, authTypeSession)
 
 	if err != nil {
 		return nil, err
@@ -74,7 +87,7 @@ func (c *RawClient) AddURL(url string, options CreateURLRequest) (*URL, error) {
 		return nil, fmt.Errorf("error creating body for AddURL: %s", err)
 	}
 
-	path := fmt.Sprintf("/urls/%s", url)
+	path := fmt.Sprintf("/urls/%s", escapePathSegment(url))
 	res, err := c.makeRequest("POST", path, nil, bytes.NewBuffer(body), authTypeSession)
 
 	if err != nil {
@@ -101,7 +114,7 @@ func (c *RawClient) UpdateURL(url string, options UpdateURLRequest) error {
 		return fmt.Errorf("error creating body for UpdateURLs: %s", err)
 	}
 
-	path := fmt.Sprintf("/urls/%s", url)
+	path := fmt.Sprintf("/urls/%s", escapePathSegment(url))
 	_, err = c.makeRequest("PATCH", path, nil, bytes.NewBuffer(body), authTypeSession)
 
 	return err
@@ -112,7 +125,7 @@ func (c *RawClient) DeleteURL(url string) error {
 		return errors.New("missing permission: urls")
 	}
 
-	path := fmt.Sprintf("/urls/%s", url)
+	path := fmt.Sprintf("/urls/%s", escapePathSegment(url))
 	_, err := c.makeRequest("DELETE", path, nil, nil, authTypeSession)
 
 	return err
@@ -3,7 +3,7 @@ package fishfish_test
 import (
 	"testing"
 
-	"github.com/existentiality/fishfish-go"
+	"github.com/existagon/fishfish-go"
 )
 
 func TestGetURLs(t *testing.T) {
@@ -34,7 +34,7 @@ type CreateUserRequest struct {
 	Username          string `json:"username"`
 }
 
-func (c *RawClient) CreateUser(options CreateDomainRequest) (*User, error) {
+func (c *RawClient) CreateUser(options CreateUserRequest) (*User, error) {
 	if !c.HasPermission(APIPermissionAdmin) {
 		return nil, errors.New("missing permission: admin")
 	}
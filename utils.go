@@ -2,6 +2,11 @@ package fishfish
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
 )
 
 // Converts a map of JSON values to a struct
@@ -20,3 +25,71 @@ func JSONStructToMap[T any](m map[string]interface{}) (*T, error) {
 
 	return &finalStruct, nil
 }
+
+// Converts the data of a stream event to the specified struct
+// Data received from the WebSocket is a map, while events created in-process may already be structs
+func decodeEventData[T any](data any) (*T, error) {
+	if data == nil {
+		return nil, errors.New("event has no data")
+	}
+
+	jsonString, err := json.Marshal(data)
+
+	if err != nil {
+		return nil, fmt.Errorf("unable to marshal event data: %s", err)
+	}
+
+	var finalStruct T
+	if err := json.Unmarshal(jsonString, &finalStruct); err != nil {
+		return nil, fmt.Errorf("unable to unmarshal event data: %s", err)
+	}
+
+	return &finalStruct, nil
+}
+
+// Keys of a map in sorted order, for deterministic iteration
+func sortedKeys[T any](m map[string]T) []string {
+	keys := make([]string, 0, len(m))
+
+	for k := range m {
+		keys = append(keys, k)
+	}
+
+	sort.Strings(keys)
+
+	return keys
+}
+
+// Write a file by renaming a temporary file over it, so readers never see a partial write
+// An existing file keeps its permissions, new files are created with mode 0644.
+func writeFileAtomic(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+
+	if err != nil {
+		return err
+	}
+
+	defer os.Remove(tmp.Name())
+
+	// Temporary files are only readable by their owner, keep the mode of the file being replaced instead
+	mode := os.FileMode(0o644)
+	if info, err := os.Stat(path); err == nil {
+		mode = info.Mode().Perm()
+	}
+
+	if err := tmp.Chmod(mode); err != nil {
+		tmp.Close()
+		return err
+	}
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
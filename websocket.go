@@ -6,6 +6,8 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
+	"net/url"
+	"strings"
 	"time"
 
 	"nhooyr.io/websocket"
@@ -76,26 +78,51 @@ func (c *RawClient) ConnectWS(ctx context.Context, ch chan WSEvent) error {
 	}
 
 	headers := http.Header{}
-	headers.Add("Authorization", c.sessionToken.Token)
+	headers.Add("Authorization", c.GetSessionToken().Token)
 	headers.Add("User-Agent", "fishfish-go")
 
-	conn, res, err := websocket.Dial(ctx, "wss://api.fishfish.gg/v1/stream", &websocket.DialOptions{
+	streamURL, err := url.JoinPath(c.apiUrl, "/stream")
+
+	if err != nil {
+		return fmt.Errorf("unable to join path: %s", err)
+	}
+
+	// The stream is served from the same host as the API
+	streamURL = strings.Replace(streamURL, "https://", "wss://", 1)
+	streamURL = strings.Replace(streamURL, "http://", "ws://", 1)
+
+	conn, res, err := websocket.Dial(ctx, streamURL, &websocket.DialOptions{
 		HTTPHeader: headers,
 	})
 
 	if err != nil {
-		fmt.Println(res)
+		if res != nil {
+			return fmt.Errorf("could not connect to websocket (%s): %w", res.Status, err)
+		}
+
 		return fmt.Errorf("could not connect to websocket: %w", err)
 	}
 
-	go keepAlive(conn, ctx)
+	notifyConnected(ctx)
+
+	// Stop the keep alive and wait for it to exit before returning
+	keepAliveCtx, stopKeepAlive := context.WithCancel(ctx)
+	keepAliveDone := make(chan struct{})
+	defer func() {
+		stopKeepAlive()
+		<-keepAliveDone
+	}()
+
+	go func() {
+		defer close(keepAliveDone)
+		keepAlive(conn, keepAliveCtx)
+	}()
 
 	for {
 		var eventData WSEvent
 		err := wsjson.Read(ctx, conn, &eventData)
 
 		if err != nil {
-			fmt.Println(err)
 			// Context was Cancelled
 			if errors.Is(err, ctx.Err()) {
 				conn.Close(websocket.StatusNormalClosure, "")
@@ -114,12 +141,15 @@ func (c *RawClient) ConnectWS(ctx context.Context, ch chan WSEvent) error {
 
 // Send a byte every 10 seconds to keep the connection from closing
 func keepAlive(conn *websocket.Conn, ctx context.Context) {
-	for range time.Tick(time.Second * 10) {
+	ticker := time.NewTicker(time.Second * 10)
+	defer ticker.Stop()
+
+	for {
 		select {
 		case <-ctx.Done():
 			// Websocket Cancelled
 			return
-		default:
+		case <-ticker.C:
 			// Ping the server
 			conn.Write(ctx, websocket.MessageBinary, []byte{1})
 		}